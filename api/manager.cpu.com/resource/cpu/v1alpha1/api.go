@@ -0,0 +1,178 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package v1alpha1
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer/json"
+)
+
+const (
+	GroupName = "cpu.resource.manager.cpu.com"
+	Version   = "v1alpha1"
+
+	CpuConfigKind = "CpuConfig"
+)
+
+// Decoder implements a decoder for objects in this API group.
+var Decoder runtime.Decoder
+
+// PinningMode tells how containers are pinned to the CPUs of a claim.
+type PinningMode string
+
+const (
+	// ExclusivePinning pins the container to the claim's CPUs, which no
+	// other container may use.
+	ExclusivePinning PinningMode = "Exclusive"
+	// SharedPinning pins the container to the claim's CPUs while allowing
+	// other containers to run on them too.
+	SharedPinning PinningMode = "Shared"
+	// NoPinning only advertises the claim's CPUs to the container.
+	NoPinning PinningMode = "None"
+)
+
+// SMTPolicy tells whether a claim may get some, but not all, hyperthreads
+// of a physical core.
+type SMTPolicy string
+
+const (
+	// SMTAllow accepts any set of logical CPUs.
+	SMTAllow SMTPolicy = "Allow"
+	// SMTFullCores requires the claim to be made of whole physical cores,
+	// so that no sibling is shared with another workload.
+	SMTFullCores SMTPolicy = "FullCores"
+)
+
+// EnvFormat selects the environment variables describing the claim's CPUs
+// that are injected into containers.
+type EnvFormat string
+
+const (
+	// EnvFormatList injects CPU lists such as "0-3,8".
+	EnvFormatList EnvFormat = "List"
+	// EnvFormatMask injects hexadecimal affinity masks such as "0x10f".
+	EnvFormatMask EnvFormat = "Mask"
+	// EnvFormatAll injects both forms.
+	EnvFormatAll EnvFormat = "All"
+)
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// CpuConfig holds the set of parameters for configuring the CPUs of a claim.
+type CpuConfig struct {
+	metav1.TypeMeta `json:",inline"`
+	Pinning         PinningMode   `json:"pinning,omitempty"`
+	SMTPolicy       SMTPolicy     `json:"smtPolicy,omitempty"`
+	PowerProfile    *PowerProfile `json:"powerProfile,omitempty"`
+	// IRQIsolation keeps hardware interrupts away from the claim's CPUs.
+	IRQIsolation bool `json:"irqIsolation,omitempty"`
+	// HousekeepingIsolation moves unbound workqueues and the kernel
+	// threads that can be moved onto the reserved CPUs while the claim is
+	// prepared.
+	HousekeepingIsolation bool `json:"housekeepingIsolation,omitempty"`
+	// RDT requests a share of the L3 cache and of the memory bandwidth
+	// for the CPUs of the claim.
+	RDT       *RDTConfig `json:"rdt,omitempty"`
+	EnvFormat EnvFormat  `json:"envFormat,omitempty"`
+}
+
+// PowerProfile holds the frequency scaling and idle state settings applied
+// to the CPUs of a claim. Unset fields are left untouched.
+type PowerProfile struct {
+	// Governor is the cpufreq scaling governor, e.g. "performance".
+	Governor string `json:"governor,omitempty"`
+	// MinFrequencyKHz is the minimum scaling frequency in kHz.
+	MinFrequencyKHz *int64 `json:"minFrequencyKHz,omitempty"`
+	// MaxFrequencyKHz is the maximum scaling frequency in kHz.
+	MaxFrequencyKHz *int64 `json:"maxFrequencyKHz,omitempty"`
+	// ResumeLatencyUs is the PM QoS resume latency limit in microseconds.
+	// It disables the idle states with a longer exit latency.
+	ResumeLatencyUs *int64 `json:"resumeLatencyUs,omitempty"`
+}
+
+// RDTConfig holds the Intel RDT allocations, made through resctrl, of the
+// CPUs of a claim. Unset fields are left to the defaults of the node.
+type RDTConfig struct {
+	// CacheWays is the number of L3 cache ways dedicated to the claim: they
+	// are taken from the CPUs of the node outside of claims too, which keep
+	// at least the minimum number of ways of an allocation.
+	CacheWays int `json:"cacheWays,omitempty"`
+	// MemoryBandwidthPercent caps the memory bandwidth of the CPUs of
+	// the claim, rounded up to what the hardware supports.
+	MemoryBandwidthPercent int `json:"memoryBandwidthPercent,omitempty"`
+}
+
+// DefaultCpuConfig provides the default CPU configuration.
+func DefaultCpuConfig() *CpuConfig {
+	return &CpuConfig{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: GroupName + "/" + Version,
+			Kind:       CpuConfigKind,
+		},
+		Pinning:   ExclusivePinning,
+		SMTPolicy: SMTAllow,
+		EnvFormat: EnvFormatAll,
+	}
+}
+
+// Normalize updates a CpuConfig config with implied default values based on other settings.
+func (c *CpuConfig) Normalize() error {
+	if c == nil {
+		return fmt.Errorf("config is 'nil'")
+	}
+	if c.Pinning == "" {
+		c.Pinning = ExclusivePinning
+	}
+	if c.SMTPolicy == "" {
+		c.SMTPolicy = SMTAllow
+	}
+	if c.EnvFormat == "" {
+		c.EnvFormat = EnvFormatAll
+	}
+	return nil
+}
+
+func init() {
+	// Create a new scheme and add our types to it. If at some point in the
+	// future a new version of the configuration API becomes necessary, then
+	// conversion functions can be generated and registered to continue
+	// supporting older versions.
+	scheme := runtime.NewScheme()
+	schemeGroupVersion := schema.GroupVersion{
+		Group:   GroupName,
+		Version: Version,
+	}
+	scheme.AddKnownTypes(schemeGroupVersion,
+		&CpuConfig{},
+	)
+	metav1.AddToGroupVersion(scheme, schemeGroupVersion)
+
+	// Set up a json serializer to decode our types.
+	Decoder = json.NewSerializerWithOptions(
+		json.DefaultMetaFactory,
+		scheme,
+		scheme,
+		json.SerializerOptions{
+			Pretty: true, Strict: true,
+		},
+	)
+}
@@ -0,0 +1,132 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package v1alpha1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+)
+
+func TestDecodeCpuConfig(t *testing.T) {
+	tests := map[string]struct {
+		raw       string
+		expected  *CpuConfig
+		expectErr bool
+	}{
+		"defaults": {
+			raw:      `{"apiVersion": "cpu.resource.manager.cpu.com/v1alpha1", "kind": "CpuConfig"}`,
+			expected: DefaultCpuConfig(),
+		},
+		"all fields": {
+			raw: `{
+				"apiVersion": "cpu.resource.manager.cpu.com/v1alpha1",
+				"kind": "CpuConfig",
+				"pinning": "Exclusive",
+				"smtPolicy": "FullCores",
+				"irqIsolation": true,
+				"housekeepingIsolation": true,
+				"envFormat": "Mask",
+				"powerProfile": {"governor": "performance", "minFrequencyKHz": 2000000, "resumeLatencyUs": 0},
+				"rdt": {"cacheWays": 4, "memoryBandwidthPercent": 50}
+			}`,
+			expected: &CpuConfig{
+				TypeMeta:              DefaultCpuConfig().TypeMeta,
+				Pinning:               ExclusivePinning,
+				SMTPolicy:             SMTFullCores,
+				IRQIsolation:          true,
+				HousekeepingIsolation: true,
+				EnvFormat:             EnvFormatMask,
+				PowerProfile: &PowerProfile{
+					Governor:        "performance",
+					MinFrequencyKHz: ptr.To[int64](2000000),
+					ResumeLatencyUs: ptr.To[int64](0),
+				},
+				RDT: &RDTConfig{CacheWays: 4, MemoryBandwidthPercent: 50},
+			},
+		},
+		"unknown field": {
+			raw:       `{"apiVersion": "cpu.resource.manager.cpu.com/v1alpha1", "kind": "CpuConfig", "sharing": {}}`,
+			expectErr: true,
+		},
+		"unknown kind": {
+			raw:       `{"apiVersion": "cpu.resource.manager.cpu.com/v1alpha1", "kind": "GpuConfig"}`,
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			obj, err := runtime.Decode(Decoder, []byte(test.raw))
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			config, ok := obj.(*CpuConfig)
+			if !ok {
+				t.Fatalf("unexpected type %T", obj)
+			}
+			assert.NoError(t, config.Normalize())
+			assert.NoError(t, config.Validate())
+			assert.Equal(t, test.expected, config)
+		})
+	}
+}
+
+func TestValidateCpuConfig(t *testing.T) {
+	tests := map[string]*CpuConfig{
+		"unknown pinning":    {Pinning: "Loose", SMTPolicy: SMTAllow, EnvFormat: EnvFormatAll},
+		"unknown SMT policy": {Pinning: ExclusivePinning, SMTPolicy: "Never", EnvFormat: EnvFormatAll},
+		"unknown env format": {Pinning: ExclusivePinning, SMTPolicy: SMTAllow, EnvFormat: "Json"},
+		"IRQ isolation of shared CPUs": {
+			Pinning: SharedPinning, SMTPolicy: SMTAllow, EnvFormat: EnvFormatAll, IRQIsolation: true,
+		},
+		"housekeeping isolation without pinning": {
+			Pinning: NoPinning, SMTPolicy: SMTAllow, EnvFormat: EnvFormatAll, HousekeepingIsolation: true,
+		},
+		"unknown governor": {
+			Pinning: ExclusivePinning, SMTPolicy: SMTAllow, EnvFormat: EnvFormatAll,
+			PowerProfile: &PowerProfile{Governor: "turbo"},
+		},
+		"minimum above maximum frequency": {
+			Pinning: ExclusivePinning, SMTPolicy: SMTAllow, EnvFormat: EnvFormatAll,
+			PowerProfile: &PowerProfile{MinFrequencyKHz: ptr.To[int64](3000000), MaxFrequencyKHz: ptr.To[int64](2000000)},
+		},
+		"empty RDT config": {
+			Pinning: ExclusivePinning, SMTPolicy: SMTAllow, EnvFormat: EnvFormatAll,
+			RDT: &RDTConfig{},
+		},
+		"memory bandwidth above 100%": {
+			Pinning: ExclusivePinning, SMTPolicy: SMTAllow, EnvFormat: EnvFormatAll,
+			RDT: &RDTConfig{MemoryBandwidthPercent: 150},
+		},
+		"power profile of shared CPUs": {
+			Pinning: SharedPinning, SMTPolicy: SMTAllow, EnvFormat: EnvFormatAll,
+			PowerProfile: &PowerProfile{Governor: "performance"},
+		},
+	}
+
+	for name, config := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Error(t, config.Validate())
+		})
+	}
+}
@@ -1,5 +1,5 @@
 /*
- * Copyright 2023 The Kubernetes Authors.
+ * Copyright 2025 The Kubernetes Authors.
  *
  * Licensed under the Apache License, Version 2.0 (the "License");
  * you may not use this file except in compliance with the License.
@@ -14,7 +14,10 @@
  * limitations under the License.
  */
 
+// Package v1alpha1 contains the opaque configuration that ResourceClaims and
+// DeviceClasses can pass to the CPU driver.
+//
 // +k8s:deepcopy-gen=package
-// +groupName=gpu.resource.example.com
+// +groupName=cpu.resource.manager.cpu.com
 
 package v1alpha1
@@ -0,0 +1,122 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package v1alpha1
+
+import (
+	"fmt"
+	"slices"
+)
+
+// governors lists the cpufreq scaling governors shipped with Linux.
+var governors = []string{"performance", "powersave", "schedutil", "ondemand", "conservative", "userspace"}
+
+// Validate ensures that PinningMode has a valid set of values.
+func (m PinningMode) Validate() error {
+	switch m {
+	case ExclusivePinning, SharedPinning, NoPinning:
+		return nil
+	}
+	return fmt.Errorf("unknown pinning mode: %v", m)
+}
+
+// Validate ensures that SMTPolicy has a valid set of values.
+func (p SMTPolicy) Validate() error {
+	switch p {
+	case SMTAllow, SMTFullCores:
+		return nil
+	}
+	return fmt.Errorf("unknown SMT policy: %v", p)
+}
+
+// Validate ensures that EnvFormat has a valid set of values.
+func (f EnvFormat) Validate() error {
+	switch f {
+	case EnvFormatList, EnvFormatMask, EnvFormatAll:
+		return nil
+	}
+	return fmt.Errorf("unknown env format: %v", f)
+}
+
+// Validate ensures that PowerProfile has a valid set of values.
+func (p *PowerProfile) Validate() error {
+	if p.Governor != "" && !slices.Contains(governors, p.Governor) {
+		return fmt.Errorf("unknown cpufreq governor: %v", p.Governor)
+	}
+	if p.MinFrequencyKHz != nil && *p.MinFrequencyKHz <= 0 {
+		return fmt.Errorf("invalid minimum frequency: %v", *p.MinFrequencyKHz)
+	}
+	if p.MaxFrequencyKHz != nil && *p.MaxFrequencyKHz <= 0 {
+		return fmt.Errorf("invalid maximum frequency: %v", *p.MaxFrequencyKHz)
+	}
+	if p.MinFrequencyKHz != nil && p.MaxFrequencyKHz != nil && *p.MinFrequencyKHz > *p.MaxFrequencyKHz {
+		return fmt.Errorf("minimum frequency %v is above maximum frequency %v", *p.MinFrequencyKHz, *p.MaxFrequencyKHz)
+	}
+	if p.ResumeLatencyUs != nil && *p.ResumeLatencyUs < 0 {
+		return fmt.Errorf("invalid resume latency: %v", *p.ResumeLatencyUs)
+	}
+	return nil
+}
+
+// Validate ensures that RDTConfig has a valid set of values.
+func (r *RDTConfig) Validate() error {
+	if r.CacheWays < 0 {
+		return fmt.Errorf("invalid number of cache ways: %v", r.CacheWays)
+	}
+	if r.MemoryBandwidthPercent < 0 || r.MemoryBandwidthPercent > 100 {
+		return fmt.Errorf("invalid memory bandwidth percentage: %v", r.MemoryBandwidthPercent)
+	}
+	if r.CacheWays == 0 && r.MemoryBandwidthPercent == 0 {
+		return fmt.Errorf("RDT config requests neither cache ways nor memory bandwidth")
+	}
+	return nil
+}
+
+// Validate ensures that CpuConfig has a valid set of values.
+func (c *CpuConfig) Validate() error {
+	if err := c.Pinning.Validate(); err != nil {
+		return err
+	}
+	if err := c.SMTPolicy.Validate(); err != nil {
+		return err
+	}
+	if err := c.EnvFormat.Validate(); err != nil {
+		return err
+	}
+	if c.PowerProfile != nil {
+		if err := c.PowerProfile.Validate(); err != nil {
+			return err
+		}
+		if c.Pinning != ExclusivePinning {
+			return fmt.Errorf("power profile requires %s pinning", ExclusivePinning)
+		}
+	}
+	if c.RDT != nil {
+		if err := c.RDT.Validate(); err != nil {
+			return err
+		}
+		if c.Pinning != ExclusivePinning {
+			return fmt.Errorf("RDT allocation requires %s pinning", ExclusivePinning)
+		}
+	}
+	if c.IRQIsolation && c.Pinning != ExclusivePinning {
+		return fmt.Errorf("IRQ isolation requires %s pinning", ExclusivePinning)
+	}
+	if c.HousekeepingIsolation && c.Pinning != ExclusivePinning {
+		return fmt.Errorf("housekeeping isolation requires %s pinning", ExclusivePinning)
+	}
+	return nil
+}
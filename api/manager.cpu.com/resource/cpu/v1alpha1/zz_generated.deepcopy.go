@@ -25,28 +25,33 @@ import (
 )
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *GpuConfig) DeepCopyInto(out *GpuConfig) {
+func (in *CpuConfig) DeepCopyInto(out *CpuConfig) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
-	if in.Sharing != nil {
-		in, out := &in.Sharing, &out.Sharing
-		*out = new(GpuSharing)
+	if in.PowerProfile != nil {
+		in, out := &in.PowerProfile, &out.PowerProfile
+		*out = new(PowerProfile)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.RDT != nil {
+		in, out := &in.RDT, &out.RDT
+		*out = new(RDTConfig)
+		**out = **in
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GpuConfig.
-func (in *GpuConfig) DeepCopy() *GpuConfig {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CpuConfig.
+func (in *CpuConfig) DeepCopy() *CpuConfig {
 	if in == nil {
 		return nil
 	}
-	out := new(GpuConfig)
+	out := new(CpuConfig)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *GpuConfig) DeepCopyObject() runtime.Object {
+func (in *CpuConfig) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
@@ -54,56 +59,46 @@ func (in *GpuConfig) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *GpuSharing) DeepCopyInto(out *GpuSharing) {
+func (in *PowerProfile) DeepCopyInto(out *PowerProfile) {
 	*out = *in
-	if in.TimeSlicingConfig != nil {
-		in, out := &in.TimeSlicingConfig, &out.TimeSlicingConfig
-		*out = new(TimeSlicingConfig)
+	if in.MinFrequencyKHz != nil {
+		in, out := &in.MinFrequencyKHz, &out.MinFrequencyKHz
+		*out = new(int64)
 		**out = **in
 	}
-	if in.SpacePartitioningConfig != nil {
-		in, out := &in.SpacePartitioningConfig, &out.SpacePartitioningConfig
-		*out = new(SpacePartitioningConfig)
+	if in.MaxFrequencyKHz != nil {
+		in, out := &in.MaxFrequencyKHz, &out.MaxFrequencyKHz
+		*out = new(int64)
 		**out = **in
 	}
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GpuSharing.
-func (in *GpuSharing) DeepCopy() *GpuSharing {
-	if in == nil {
-		return nil
+	if in.ResumeLatencyUs != nil {
+		in, out := &in.ResumeLatencyUs, &out.ResumeLatencyUs
+		*out = new(int64)
+		**out = **in
 	}
-	out := new(GpuSharing)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *SpacePartitioningConfig) DeepCopyInto(out *SpacePartitioningConfig) {
-	*out = *in
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SpacePartitioningConfig.
-func (in *SpacePartitioningConfig) DeepCopy() *SpacePartitioningConfig {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PowerProfile.
+func (in *PowerProfile) DeepCopy() *PowerProfile {
 	if in == nil {
 		return nil
 	}
-	out := new(SpacePartitioningConfig)
+	out := new(PowerProfile)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *TimeSlicingConfig) DeepCopyInto(out *TimeSlicingConfig) {
+func (in *RDTConfig) DeepCopyInto(out *RDTConfig) {
 	*out = *in
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TimeSlicingConfig.
-func (in *TimeSlicingConfig) DeepCopy() *TimeSlicingConfig {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RDTConfig.
+func (in *RDTConfig) DeepCopy() *RDTConfig {
 	if in == nil {
 		return nil
 	}
-	out := new(TimeSlicingConfig)
+	out := new(RDTConfig)
 	in.DeepCopyInto(out)
 	return out
 }
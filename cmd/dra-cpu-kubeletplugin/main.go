@@ -22,6 +22,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"k8s.io/klog/v2"
 
@@ -30,6 +31,7 @@ import (
 	"github.com/Tal-or/dra-cpu-driver/pkg/config"
 	"github.com/Tal-or/dra-cpu-driver/pkg/driver"
 	"github.com/Tal-or/dra-cpu-driver/pkg/flags"
+	"github.com/Tal-or/dra-cpu-driver/pkg/nri"
 )
 
 func main() {
@@ -58,6 +60,55 @@ func newApp() *cli.App {
 			Destination: &progArgs.CdiRoot,
 			EnvVars:     []string{"CDI_ROOT"},
 		},
+		&cli.StringFlag{
+			Name:        "config",
+			Usage:       "Absolute path to a YAML or JSON file describing the CPU pools. Cannot be combined with --reserved-cpus, --shared-cpus and --allocatable-cpus.",
+			Value:       "",
+			Destination: &progArgs.ConfigFile,
+			EnvVars:     []string{"CONFIG_FILE"},
+		},
+		&cli.StringFlag{
+			Name:        "sysfs-root",
+			Usage:       "Absolute path to the sysfs mount used to discover the CPU topology.",
+			Value:       "/sys",
+			Destination: &progArgs.SysfsRoot,
+			EnvVars:     []string{"SYSFS_ROOT"},
+		},
+		&cli.StringFlag{
+			Name:        "procfs-root",
+			Usage:       "Absolute path to the procfs mount used to change the affinity of IRQs.",
+			Value:       "/proc",
+			Destination: &progArgs.ProcfsRoot,
+			EnvVars:     []string{"PROCFS_ROOT"},
+		},
+		&cli.StringFlag{
+			Name:        "resctrl-root",
+			Usage:       "Absolute path to the resctrl mount used to allocate L3 cache ways and memory bandwidth to claims.",
+			Value:       "/sys/fs/resctrl",
+			Destination: &progArgs.ResctrlRoot,
+			EnvVars:     []string{"RESCTRL_ROOT"},
+		},
+		&cli.StringFlag{
+			Name:        "cgroup-root",
+			Usage:       "Absolute path to the cgroup v2 mount under which the cpuset partitions of claims are created.",
+			Value:       "/sys/fs/cgroup",
+			Destination: &progArgs.CgroupRoot,
+			EnvVars:     []string{"CGROUP_ROOT"},
+		},
+		&cli.StringFlag{
+			Name:        "device-granularity",
+			Usage:       "Publish one device per logical CPU (\"cpu\") or one device per physical core carrying all of its thread siblings (\"core\").",
+			Value:       "cpu",
+			Destination: &progArgs.Granularity,
+			EnvVars:     []string{"DEVICE_GRANULARITY"},
+		},
+		&cli.StringFlag{
+			Name:        "aggregate-devices",
+			Usage:       "Comma separated list of aggregate devices to publish in addition to CPUs or cores: \"numa\" for whole NUMA nodes, \"llc\" for whole last level cache domains.",
+			Value:       "",
+			Destination: &progArgs.Aggregates,
+			EnvVars:     []string{"AGGREGATE_DEVICES"},
+		},
 		&cli.StringFlag{
 			Name:        "reserved-cpus",
 			Usage:       "reserved-cpus",
@@ -79,6 +130,62 @@ func newApp() *cli.App {
 			Destination: &progArgs.Shared,
 			EnvVars:     []string{"SHARED_CPUS"},
 		},
+		&cli.IntFlag{
+			Name:        "shared-cpu-slots",
+			Usage:       "Publish every shared CPU as that many devices, so that as many claims can share it.",
+			Value:       0,
+			Destination: &progArgs.SharedSlots,
+			EnvVars:     []string{"SHARED_CPU_SLOTS"},
+		},
+		&cli.BoolFlag{
+			Name:        "dynamic-shared-pool",
+			Usage:       "Pin containers using shared CPUs to every CPU of every pool but the reserved one, minus the CPUs prepared for exclusive use, and update them as claims are prepared and unprepared. Requires --nri.",
+			Value:       false,
+			Destination: &progArgs.DynamicSharedPool,
+			EnvVars:     []string{"DYNAMIC_SHARED_POOL"},
+		},
+		&cli.BoolFlag{
+			Name:        "housekeeping-dry-run",
+			Usage:       "Only log the changes to the workqueue cpumask and to the affinity of kernel threads that claims requesting housekeeping isolation would make.",
+			Value:       false,
+			Destination: &progArgs.HousekeepingDryRun,
+			EnvVars:     []string{"HOUSEKEEPING_DRY_RUN"},
+		},
+		&cli.BoolFlag{
+			Name:        "cpu-partitions",
+			Usage:       "Back the CPUs of every claim pinned exclusively with an isolated cgroup v2 cpuset partition, so that the scheduler stops load balancing onto them. Their containers are moved out of their pod cgroup into the partition: the limits of the pod cgroup, the kubelet pod stats and eviction no longer account for them, only the limits of the containers themselves apply. Requires --nri and the cgroupfs cgroup driver.",
+			Value:       false,
+			Destination: &progArgs.CPUPartitions,
+			EnvVars:     []string{"CPU_PARTITIONS"},
+		},
+		&cli.DurationFlag{
+			Name:        "gc-interval",
+			Usage:       "Period at which prepared claims that no longer exist or are no longer allocated on the node are unprepared, and orphaned CDI spec files deleted. Zero disables it.",
+			Value:       10 * time.Minute,
+			Destination: &progArgs.GCInterval,
+			EnvVars:     []string{"GC_INTERVAL"},
+		},
+		&cli.IntFlag{
+			Name:        "prepare-workers",
+			Usage:       "Maximum number of claims of a single request prepared or unprepared concurrently.",
+			Value:       4,
+			Destination: &progArgs.PrepareWorkers,
+			EnvVars:     []string{"PREPARE_WORKERS"},
+		},
+		&cli.BoolFlag{
+			Name:        "nri",
+			Usage:       "Also run as an NRI plugin pinning containers to the CPUs of their claims.",
+			Value:       false,
+			Destination: &progArgs.NRI,
+			EnvVars:     []string{"NRI"},
+		},
+		&cli.StringFlag{
+			Name:        "nri-socket",
+			Usage:       "Absolute path to the NRI socket of the container runtime.",
+			Value:       "/var/run/nri/nri.sock",
+			Destination: &progArgs.NRISocket,
+			EnvVars:     []string{"NRI_SOCKET"},
+		},
 	}
 	cliFlags = append(cliFlags, progArgs.KubeClientConfig.Flags()...)
 	cliFlags = append(cliFlags, progArgs.LoggingConfig.Flags()...)
@@ -86,6 +193,7 @@ func newApp() *cli.App {
 	app := &cli.App{
 		Name:            "dra-cpu-kubeletplugin",
 		Usage:           "dra-cpu-kubeletplugin implements a DRA driver plugin.",
+		Version:         config.DriverVersion,
 		ArgsUsage:       " ",
 		HideHelpCommand: true,
 		Flags:           cliFlags,
@@ -115,6 +223,19 @@ func newApp() *cli.App {
 }
 
 func StartPlugin(ctx context.Context, cfg *config.Config) error {
+	if cfg.ProgArgs.DynamicSharedPool && !cfg.ProgArgs.NRI {
+		return fmt.Errorf("--dynamic-shared-pool requires --nri")
+	}
+	if cfg.ProgArgs.CPUPartitions && !cfg.ProgArgs.NRI {
+		return fmt.Errorf("--cpu-partitions requires --nri")
+	}
+	if cfg.ProgArgs.CPUPartitions {
+		klog.Warningf("CPU partitions are enabled: the containers of claims pinned exclusively run outside of their pod cgroup, which no longer limits nor accounts for them")
+	}
+	if cfg.ProgArgs.PrepareWorkers < 1 {
+		return fmt.Errorf("--prepare-workers must be at least 1")
+	}
+
 	err := os.MkdirAll(config.DriverPluginPath, 0750)
 	if err != nil {
 		return err
@@ -125,9 +246,42 @@ func StartPlugin(ctx context.Context, cfg *config.Config) error {
 		return err
 	}
 
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if cfg.ProgArgs.NRI {
+		plugin := nri.NewPlugin(drv.State)
+		drv.State.SetSharedPoolNotifier(plugin.SharedPoolChanged)
+		if err := nri.Start(ctx, plugin, cfg.ProgArgs.NRISocket); err != nil {
+			return fmt.Errorf("unable to start NRI plugin: %w", err)
+		}
+	}
+
+	if err := drv.StartClaimInformer(ctx, cfg.ProgArgs.NodeName); err != nil {
+		return err
+	}
+
+	if cfg.ProgArgs.GCInterval > 0 {
+		drv.StartGarbageCollector(ctx, cfg.ProgArgs.NodeName, cfg.ProgArgs.GCInterval)
+	}
+
+	if cfg.ProgArgs.ConfigFile != "" {
+		if err := drv.WatchConfigFile(ctx, cfg.ProgArgs.ConfigFile); err != nil {
+			return err
+		}
+	}
+
 	sigc := make(chan os.Signal, 1)
 	signal.Notify(sigc, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
-	<-sigc
+	// SIGHUP reloads the CPU pools, any other signal stops the driver.
+	for sig := range sigc {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		if err := drv.Reload(ctx); err != nil {
+			klog.FromContext(ctx).Error(err, "Unable to reload CPU pools")
+		}
+	}
 
 	err = drv.Shutdown(ctx)
 	if err != nil {
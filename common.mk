@@ -20,8 +20,8 @@ MODULE := $(DRIVER_NAME)
 VERSION  ?= v0.1.0
 vVERSION := v$(VERSION:v%=%)
 
-VENDOR := example.com
-APIS := gpu/v1alpha1
+VENDOR := manager.cpu.com
+APIS := cpu/v1alpha1
 
 PLURAL_EXCEPTIONS  = DeviceClassParameters:DeviceClassParameters
 PLURAL_EXCEPTIONS += CpuClaimParameters:CpuClaimParameters
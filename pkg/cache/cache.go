@@ -47,6 +47,17 @@ func (c *Cache[K, V]) Clear() {
 	c.data = make(map[K]V)
 }
 
+// Values returns all the values in the cache, in no particular order.
+func (c *Cache[K, V]) Values() []V {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	values := make([]V, 0, len(c.data))
+	for _, val := range c.data {
+		values = append(values, val)
+	}
+	return values
+}
+
 // Len returns the number of items in the cache.
 func (c *Cache[K, V]) Len() int {
 	c.mu.RLock()
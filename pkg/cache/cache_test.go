@@ -0,0 +1,72 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache(t *testing.T) {
+	c := New[string, int]()
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("a", 3)
+
+	val, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 3, val)
+	assert.Equal(t, 2, c.Len())
+	assert.ElementsMatch(t, []int{3, 2}, c.Values())
+
+	c.Delete("a")
+	_, ok = c.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, []int{2}, c.Values())
+
+	c.Clear()
+	assert.Equal(t, 0, c.Len())
+	assert.Empty(t, c.Values())
+}
+
+func TestCacheConcurrentAccess(t *testing.T) {
+	c := New[string, int]()
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			key := fmt.Sprintf("key-%d", i)
+			for j := range 100 {
+				c.Set(key, j)
+				c.Get(key)
+				c.Values()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 10, c.Len())
+	for i := range 10 {
+		val, ok := c.Get(fmt.Sprintf("key-%d", i))
+		assert.True(t, ok)
+		assert.Equal(t, 99, val)
+	}
+}
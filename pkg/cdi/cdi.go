@@ -20,6 +20,8 @@ import (
 	"fmt"
 	"github.com/Tal-or/dra-cpu-driver/pkg/devices"
 	"os"
+	"path/filepath"
+	"strings"
 
 	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
 	cdiparser "tags.cncf.io/container-device-interface/pkg/parser"
@@ -37,7 +39,8 @@ const (
 )
 
 type Handler struct {
-	cache *cdiapi.Cache
+	cache   *cdiapi.Cache
+	cdiRoot string
 }
 
 func NewHandler(config *config.Config) (*Handler, error) {
@@ -48,7 +51,8 @@ func NewHandler(config *config.Config) (*Handler, error) {
 		return nil, fmt.Errorf("unable to create a new CDI cache: %w", err)
 	}
 	handler := &Handler{
-		cache: cache,
+		cache:   cache,
+		cdiRoot: config.ProgArgs.CdiRoot,
 	}
 
 	return handler, nil
@@ -84,7 +88,7 @@ func (cdi *Handler) CreateCommonSpecFile() error {
 	return cdi.cache.WriteSpec(spec, specName)
 }
 
-func (cdi *Handler) CreateClaimSpecFile(claimUID string, devices devices.PreparedDevices) error {
+func (cdi *Handler) CreateClaimSpecFile(claimUID string, preparedDevices devices.PreparedDevices) error {
 	specName := cdiapi.GenerateTransientSpecName(cdiVendor, cdiClass, claimUID)
 
 	spec := &cdispec.Spec{
@@ -92,13 +96,9 @@ func (cdi *Handler) CreateClaimSpecFile(claimUID string, devices devices.Prepare
 		Devices: []cdispec.Device{},
 	}
 
-	for _, device := range devices {
+	for _, device := range preparedDevices {
 		claimEdits := cdiapi.ContainerEdits{
-			ContainerEdits: &cdispec.ContainerEdits{
-				Env: []string{
-					fmt.Sprintf("GPU_DEVICE_%s_RESOURCE_CLAIM=%s", device.DeviceName[4:], claimUID),
-				},
-			},
+			ContainerEdits: &cdispec.ContainerEdits{},
 		}
 		claimEdits.Append(device.ContainerEdits)
 
@@ -124,6 +124,31 @@ func (cdi *Handler) DeleteClaimSpecFile(claimUID string) error {
 	return cdi.cache.RemoveSpec(specName)
 }
 
+// ListClaimSpecFiles returns the UIDs of the claims having a spec file in the
+// CDI root, whether the driver still knows about them or not.
+func (cdi *Handler) ListClaimSpecFiles() ([]string, error) {
+	entries, err := os.ReadDir(cdi.cdiRoot)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list CDI spec files: %w", err)
+	}
+
+	prefix := cdiapi.GenerateTransientSpecName(cdiVendor, cdiClass, "")
+	var claimUIDs []string
+	for _, entry := range entries {
+		name := entry.Name()
+		ext := filepath.Ext(name)
+		if ext != ".json" && ext != ".yaml" {
+			continue
+		}
+		claimUID, found := strings.CutPrefix(strings.TrimSuffix(name, ext), prefix)
+		if !found || claimUID == cdiCommonDeviceName {
+			continue
+		}
+		claimUIDs = append(claimUIDs, claimUID)
+	}
+	return claimUIDs, nil
+}
+
 func (cdi *Handler) GetClaimDevices(claimUID string, devices []string) []string {
 	cdiDevices := []string{
 		cdiparser.QualifiedName(cdiVendor, cdiClass, cdiCommonDeviceName),
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"time"
+
 	coreclientset "k8s.io/client-go/kubernetes"
 
 	"github.com/Tal-or/dra-cpu-driver/pkg/flags"
@@ -13,15 +15,47 @@ const (
 	DriverPluginSocketPath       = DriverPluginPath + "/Plugin.sock"
 )
 
+// DriverVersion is the version of the driver, recorded in the checkpoint. It
+// is set at build time with
+// -ldflags "-X github.com/Tal-or/dra-cpu-driver/pkg/config.DriverVersion=<version>".
+var DriverVersion = "devel"
+
 type ProgArgs struct {
 	KubeClientConfig flags.KubeClientConfig
 	LoggingConfig    *flags.LoggingConfig
 
 	CdiRoot     string
+	ConfigFile  string
 	NodeName    string
+	SysfsRoot   string
+	ProcfsRoot  string
+	ResctrlRoot string
+	CgroupRoot  string
+	Granularity string
+	Aggregates  string
 	Reserved    string
 	Allocatable string
 	Shared      string
+	SharedSlots int
+	// DynamicSharedPool pins shared pool containers to every non reserved
+	// CPU not prepared for exclusive use.
+	DynamicSharedPool bool
+	NRI               bool
+	NRISocket         string
+	// HousekeepingDryRun only logs the changes that would be made to move
+	// the housekeeping work of the kernel away from isolated CPUs.
+	HousekeepingDryRun bool
+	// CPUPartitions backs the CPUs of every claim pinned exclusively with an
+	// isolated cgroup v2 cpuset partition. Their containers are moved out of
+	// their pod cgroup, whose limits, stats and eviction accounting then no
+	// longer apply to them.
+	CPUPartitions bool
+	// GCInterval is the period of the garbage collection of stale claims,
+	// zero disables it.
+	GCInterval time.Duration
+	// PrepareWorkers bounds the number of claims of a single request that
+	// are prepared or unprepared concurrently.
+	PrepareWorkers int
 }
 
 type Config struct {
@@ -0,0 +1,195 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	resourceapi "k8s.io/api/resource/v1beta1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+)
+
+// Names of the pools created from the --reserved-cpus, --shared-cpus and
+// --allocatable-cpus flags.
+const (
+	ReservedPool    = "reserved"
+	SharedPool      = "shared"
+	AllocatablePool = "allocatable"
+)
+
+// MaxDriverAttributes is the largest number of attributes the driver itself
+// publishes on a device: a slot device of a CPU with a cpufreq driver, on a
+// node with resctrl. The attributes of pools come on top of them.
+const MaxDriverAttributes = 18
+
+// DriverConfig is the content of the file given with --config. It can be
+// written either in YAML or in JSON.
+type DriverConfig struct {
+	Pools []PoolConfig `json:"pools"`
+}
+
+// PoolConfig describes a named set of CPUs that is published with the same
+// attributes.
+type PoolConfig struct {
+	// Name identifies the pool and must be a DNS label. Every device gets a
+	// boolean attribute per pool telling whether the device belongs to it,
+	// named after the pool with dashes turned into underscores, see
+	// PoolAttributeName.
+	Name string `json:"name"`
+	// CPUs is an explicit list of CPUs, e.g. "0-3,8". Mutually exclusive
+	// with Selector.
+	CPUs string `json:"cpus,omitempty"`
+	// Selector picks the CPUs of the pool from the machine topology.
+	// Mutually exclusive with CPUs.
+	Selector *CPUSelector `json:"selector,omitempty"`
+	// Granularity overrides --device-granularity for the pool.
+	Granularity string `json:"granularity,omitempty"`
+	// Slots publishes every CPU of the pool as that many devices, so that
+	// as many claims can share it. Only valid with the cpu granularity.
+	Slots int `json:"slots,omitempty"`
+	// Shared makes Shared the pinning of the devices of the pool when the
+	// config of a claim does not set one. Devices of other pools default to
+	// Exclusive pinning.
+	Shared bool `json:"shared,omitempty"`
+	// Attributes are published on every device of the pool in addition to
+	// the attributes set by the driver.
+	Attributes map[resourceapi.QualifiedName]resourceapi.DeviceAttribute `json:"attributes,omitempty"`
+}
+
+// CPUSelector selects CPUs by their place in the topology. All the CPUs
+// matching every non-empty field are selected, minus the excluded ones,
+// e.g. "all CPUs on NUMA node 1 except core 0".
+type CPUSelector struct {
+	NUMANodes    []int  `json:"numaNodes,omitempty"`
+	Sockets      []int  `json:"sockets,omitempty"`
+	ExcludeCores []int  `json:"excludeCores,omitempty"`
+	ExcludeCPUs  string `json:"excludeCpus,omitempty"`
+}
+
+// PoolAttributeName returns the name of the boolean attribute published for
+// a pool. Pool names are DNS labels, whose dashes are not valid in attribute
+// names.
+func PoolAttributeName(pool string) resourceapi.QualifiedName {
+	return resourceapi.QualifiedName(strings.ReplaceAll(pool, "-", "_"))
+}
+
+// LoadDriverConfig reads and validates the driver configuration file. Unknown
+// fields are rejected.
+func LoadDriverConfig(path string) (*DriverConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config file: %w", err)
+	}
+	cfg := &DriverConfig{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("unable to parse config file %s: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// NewDriverConfigFromFlags builds the configuration equivalent to the
+// --reserved-cpus, --shared-cpus and --allocatable-cpus flags.
+func NewDriverConfigFromFlags(progArgs *ProgArgs) *DriverConfig {
+	cfg := &DriverConfig{}
+	for _, pool := range []PoolConfig{
+		{Name: ReservedPool, CPUs: progArgs.Reserved},
+		{Name: SharedPool, CPUs: progArgs.Shared, Slots: progArgs.SharedSlots, Shared: true},
+		{Name: AllocatablePool, CPUs: progArgs.Allocatable},
+	} {
+		if pool.CPUs != "" {
+			cfg.Pools = append(cfg.Pools, pool)
+		}
+	}
+	return cfg
+}
+
+// Validate checks the configuration for errors that do not depend on the
+// machine it runs on. CPU overlaps and offline CPUs are checked once the
+// pools are resolved against the topology.
+func (c *DriverConfig) Validate() error {
+	if len(c.Pools) == 0 {
+		return fmt.Errorf("no pools configured")
+	}
+	var names []resourceapi.QualifiedName
+	for i := range c.Pools {
+		pool := &c.Pools[i]
+		if err := pool.Validate(); err != nil {
+			return fmt.Errorf("pool %q: %w", pool.Name, err)
+		}
+		if slices.Contains(names, PoolAttributeName(pool.Name)) {
+			return fmt.Errorf("duplicate pool %q", pool.Name)
+		}
+		names = append(names, PoolAttributeName(pool.Name))
+	}
+	// The attributes of pools are published on every device, so they must
+	// not clash with the extra attributes of any pool.
+	for _, pool := range c.Pools {
+		for name := range pool.Attributes {
+			if slices.Contains(names, name) {
+				return fmt.Errorf("pool %q: attribute %q clashes with a pool name", pool.Name, name)
+			}
+		}
+		// Every device carries the attributes of the driver, one per
+		// pool and those of its own pool, and the whole ResourceSlice is
+		// rejected if a single device has too many.
+		if count := MaxDriverAttributes + len(c.Pools) + len(pool.Attributes); count > resourceapi.ResourceSliceMaxAttributesAndCapacitiesPerDevice {
+			return fmt.Errorf("pool %q: devices would have %d attributes, more than the %d allowed: configure fewer pools or attributes", pool.Name, count, resourceapi.ResourceSliceMaxAttributesAndCapacitiesPerDevice)
+		}
+	}
+	return nil
+}
+
+// Validate checks a single pool.
+func (p *PoolConfig) Validate() error {
+	if errs := validation.IsDNS1123Label(p.Name); len(errs) > 0 {
+		return fmt.Errorf("invalid pool name: %v", errs)
+	}
+	if len(validation.IsCIdentifier(string(PoolAttributeName(p.Name)))) > 0 {
+		return fmt.Errorf("invalid pool name: must start with a letter")
+	}
+	if len(p.Name) > resourceapi.DeviceMaxIDLength {
+		return fmt.Errorf("invalid pool name: must be no more than %d characters", resourceapi.DeviceMaxIDLength)
+	}
+	if (p.CPUs == "") == (p.Selector == nil) {
+		return fmt.Errorf("exactly one of cpus or selector must be set")
+	}
+	if p.Slots < 0 {
+		return fmt.Errorf("invalid slots %d: must not be negative", p.Slots)
+	}
+	for name, attribute := range p.Attributes {
+		if errs := validation.IsCIdentifier(string(name)); len(errs) > 0 {
+			return fmt.Errorf("invalid attribute name %q: %v", name, errs)
+		}
+		set := 0
+		for _, value := range []bool{attribute.BoolValue != nil, attribute.IntValue != nil, attribute.StringValue != nil, attribute.VersionValue != nil} {
+			if value {
+				set++
+			}
+		}
+		if set != 1 {
+			return fmt.Errorf("attribute %q must have exactly one value", name)
+		}
+	}
+	return nil
+}
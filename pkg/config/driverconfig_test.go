@@ -0,0 +1,94 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	resourceapi "k8s.io/api/resource/v1beta1"
+	"k8s.io/utils/ptr"
+)
+
+func TestDriverConfigValidate(t *testing.T) {
+	tests := map[string]struct {
+		pools     []PoolConfig
+		expectErr bool
+	}{
+		"DNS label pool names": {
+			pools: []PoolConfig{
+				{Name: "low-latency", CPUs: "0"},
+				{Name: "batch", CPUs: "1"},
+			},
+		},
+		"pool name with an underscore": {
+			pools: []PoolConfig{
+				{Name: "low_latency", CPUs: "0"},
+			},
+			expectErr: true,
+		},
+		"pool name starting with a digit": {
+			pools: []PoolConfig{
+				{Name: "1st", CPUs: "0"},
+			},
+			expectErr: true,
+		},
+		"duplicate pools": {
+			pools: []PoolConfig{
+				{Name: "batch", CPUs: "0"},
+				{Name: "batch", CPUs: "1"},
+			},
+			expectErr: true,
+		},
+		"too many attributes": {
+			pools: []PoolConfig{
+				{Name: "reserved", CPUs: "0"},
+				{Name: "batch", CPUs: "1", Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+					"a": {BoolValue: ptr.To(true)}, "b": {BoolValue: ptr.To(true)}, "c": {BoolValue: ptr.To(true)},
+					"d": {BoolValue: ptr.To(true)}, "e": {BoolValue: ptr.To(true)}, "f": {BoolValue: ptr.To(true)},
+					"g": {BoolValue: ptr.To(true)}, "h": {BoolValue: ptr.To(true)}, "i": {BoolValue: ptr.To(true)},
+					"j": {BoolValue: ptr.To(true)}, "k": {BoolValue: ptr.To(true)}, "l": {BoolValue: ptr.To(true)},
+					"m": {BoolValue: ptr.To(true)}, "n": {BoolValue: ptr.To(true)}, "o": {BoolValue: ptr.To(true)},
+					"p": {BoolValue: ptr.To(true)}, "q": {BoolValue: ptr.To(true)}, "r": {BoolValue: ptr.To(true)},
+					"s": {BoolValue: ptr.To(true)}, "t": {BoolValue: ptr.To(true)}, "u": {BoolValue: ptr.To(true)},
+				}},
+			},
+			expectErr: true,
+		},
+		"attribute clashing with a pool": {
+			pools: []PoolConfig{
+				{Name: "low-latency", CPUs: "0"},
+				{Name: "batch", CPUs: "1", Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+					"low_latency": {BoolValue: ptr.To(true)},
+				}},
+			},
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := (&DriverConfig{Pools: test.pools}).Validate()
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
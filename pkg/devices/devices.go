@@ -1,8 +1,14 @@
 package devices
 
 import (
+	"fmt"
+
+	"k8s.io/utils/cpuset"
+
 	drapbv1 "k8s.io/kubelet/pkg/apis/dra/v1beta1"
 	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
+
+	configapi "github.com/Tal-or/dra-cpu-driver/api/manager.cpu.com/resource/cpu/v1alpha1"
 )
 
 type PreparedDevices []*PreparedDevice
@@ -10,6 +16,24 @@ type PreparedClaims map[string]PreparedDevices
 
 type PreparedDevice struct {
 	drapbv1.Device
+	// CPUPool is the name of the driver's CPU pool the device belongs to.
+	CPUPool string `json:"cpuPool,omitempty"`
+	// CPUs is the list of logical CPUs backing the device, e.g. all
+	// thread siblings of a physical core.
+	CPUs string `json:"cpus,omitempty"`
+	// Pinning is the pinning mode of the config applied to the device.
+	Pinning string `json:"pinning,omitempty"`
+	// IRQIsolation tells whether hardware interrupts are kept away from
+	// the CPUs of the device.
+	IRQIsolation bool `json:"irqIsolation,omitempty"`
+	// HousekeepingIsolation tells whether the housekeeping work of the
+	// kernel is moved away from the CPUs of the device.
+	HousekeepingIsolation bool `json:"housekeepingIsolation,omitempty"`
+	// PowerProfile is the power profile applied to the CPUs of the device.
+	PowerProfile *configapi.PowerProfile `json:"powerProfile,omitempty"`
+	// RDT is the share of the L3 cache and memory bandwidth of the CPUs
+	// of the device.
+	RDT            *configapi.RDTConfig `json:"rdt,omitempty"`
 	ContainerEdits *cdiapi.ContainerEdits
 }
 
@@ -20,3 +44,21 @@ func (pds PreparedDevices) GetDevices() []*drapbv1.Device {
 	}
 	return devices
 }
+
+// CPUSet returns the logical CPUs backing the device.
+func (pd *PreparedDevice) CPUSet() (cpuset.CPUSet, error) {
+	return cpuset.Parse(pd.CPUs)
+}
+
+// CPUSet returns the logical CPUs backing all the devices.
+func (pds PreparedDevices) CPUSet() (cpuset.CPUSet, error) {
+	cpus := cpuset.New()
+	for _, pd := range pds {
+		deviceCPUs, err := pd.CPUSet()
+		if err != nil {
+			return cpuset.New(), fmt.Errorf("invalid CPUs of device %s: %w", pd.DeviceName, err)
+		}
+		cpus = cpus.Union(deviceCPUs)
+	}
+	return cpus, nil
+}
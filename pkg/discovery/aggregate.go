@@ -0,0 +1,137 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package discovery
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	resourceapi "k8s.io/api/resource/v1beta1"
+	"k8s.io/utils/cpuset"
+	"k8s.io/utils/ptr"
+
+	"github.com/Tal-or/dra-cpu-driver/pkg/topology"
+)
+
+// ParseAggregateTypes validates a comma separated list of aggregate device
+// types, e.g. "numa,llc".
+func ParseAggregateTypes(s string) ([]DeviceType, error) {
+	var types []DeviceType
+	for _, field := range strings.Split(s, ",") {
+		t := DeviceType(strings.TrimSpace(field))
+		if t == "" {
+			continue
+		}
+		if !t.IsAggregate() {
+			return nil, fmt.Errorf("unknown aggregate device type: %q", t)
+		}
+		if !slices.Contains(types, t) {
+			types = append(types, t)
+		}
+	}
+	return types, nil
+}
+
+// enumerateAggregateDevicesForPool publishes one device per NUMA node or last
+// level cache domain whose CPUs all belong to the pool. Domains that are only
+// partially in the pool cannot be handed out as a whole and are skipped.
+func enumerateAggregateDevicesForPool(nodeName string, pool *Pool, poolNames []string, topo *topology.Topology, aggregates []DeviceType) AllocatableDevices {
+	devices := make(AllocatableDevices)
+	for _, aggregate := range aggregates {
+		switch aggregate {
+		case DeviceTypeNUMA:
+			nodes := sortedKeys(topo.NUMANodes)
+			for _, node := range nodes {
+				cpus := topo.NUMANodes[node]
+				if cpus.IsEmpty() || !cpus.IsSubsetOf(pool.CPUs) {
+					continue
+				}
+				device := newAggregateDevice(nodeName, fmt.Sprintf("numa-%d", node), aggregate, pool.Name, cpus)
+				device.Basic.Attributes["zone"] = resourceapi.DeviceAttribute{IntValue: ptr.To(int64(node))}
+				device.Basic.Attributes["numaNode"] = resourceapi.DeviceAttribute{IntValue: ptr.To(int64(node))}
+				fillInPoolAttributes(device.Basic, pool, poolNames)
+				devices[device.Name] = device
+			}
+		case DeviceTypeLLC:
+			caches := sortedKeys(topo.Caches)
+			for _, id := range caches {
+				cache := topo.Caches[id]
+				if cache.CPUs.IsEmpty() || !cache.CPUs.IsSubsetOf(pool.CPUs) {
+					continue
+				}
+				device := newAggregateDevice(nodeName, fmt.Sprintf("llc-%d", id), aggregate, pool.Name, cache.CPUs)
+				device.Basic.Attributes["cacheLevel"] = resourceapi.DeviceAttribute{IntValue: ptr.To(int64(cache.Level))}
+				device.Basic.Attributes["cacheSize"] = resourceapi.DeviceAttribute{IntValue: ptr.To(cache.Size)}
+				// With sub-NUMA clustering a cache domain spans several
+				// NUMA nodes, it is then in none of their zones.
+				var nodes []int
+				for _, cpu := range cache.CPUs.List() {
+					nodes = append(nodes, topo.CPUs[cpu].NUMANode)
+				}
+				numaNodes := cpuset.New(nodes...)
+				device.Basic.Attributes["numaNodes"] = resourceapi.DeviceAttribute{StringValue: ptr.To(numaNodes.String())}
+				if numaNodes.Size() == 1 {
+					node := int64(numaNodes.List()[0])
+					device.Basic.Attributes["zone"] = resourceapi.DeviceAttribute{IntValue: ptr.To(node)}
+					device.Basic.Attributes["numaNode"] = resourceapi.DeviceAttribute{IntValue: ptr.To(node)}
+				}
+				fillInPoolAttributes(device.Basic, pool, poolNames)
+				devices[device.Name] = device
+			}
+		}
+	}
+	return devices
+}
+
+// newAggregateDevice creates an aggregate device. NUMA node and cache IDs are
+// hardware identities, so the device name doubles as the UUID identity.
+func newAggregateDevice(nodeName, name string, t DeviceType, pool string, cpus cpuset.CPUSet) *AllocatableDevice {
+	return &AllocatableDevice{
+		Device: resourceapi.Device{
+			Name: name,
+			Basic: &resourceapi.BasicDevice{
+				Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+					"uuid": {
+						StringValue: ptr.To(generateUUID(nodeName, name)),
+					},
+					"type": {
+						StringValue: ptr.To(string(t)),
+					},
+					"cpus": {
+						StringValue: ptr.To(cpus.String()),
+					},
+					"cpuCount": {
+						IntValue: ptr.To(int64(cpus.Size())),
+					},
+				},
+			},
+		},
+		Type: t,
+		Pool: pool,
+		CPUs: cpus,
+	}
+}
+
+func sortedKeys[V any](m map[int]V) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -18,30 +18,106 @@ package discovery
 
 import (
 	"fmt"
-	"math/rand"
+	"strings"
 
 	resourceapi "k8s.io/api/resource/v1beta1"
 	"k8s.io/utils/cpuset"
 	"k8s.io/utils/ptr"
 
 	"github.com/google/uuid"
+
+	"github.com/Tal-or/dra-cpu-driver/pkg/config"
+	"github.com/Tal-or/dra-cpu-driver/pkg/resctrl"
+	"github.com/Tal-or/dra-cpu-driver/pkg/topology"
+)
+
+// Granularity controls how many logical CPUs a single published device
+// stands for.
+type Granularity string
+
+const (
+	// GranularityCPU publishes one device per logical CPU.
+	GranularityCPU Granularity = "cpu"
+	// GranularityCore publishes one device per physical core, carrying all
+	// of its thread siblings, so SMT siblings are always allocated together.
+	GranularityCore Granularity = "core"
 )
 
-type AllocatableDevices map[string]resourceapi.Device
+// ParseGranularity validates a device granularity given on the command line.
+func ParseGranularity(s string) (Granularity, error) {
+	switch g := Granularity(s); g {
+	case GranularityCPU, GranularityCore:
+		return g, nil
+	}
+	return "", fmt.Errorf("unknown device granularity: %q", s)
+}
+
+// DeviceType tells which part of the machine a published device stands for.
+type DeviceType string
+
+const (
+	DeviceTypeCPU  DeviceType = "cpu"
+	DeviceTypeCore DeviceType = "core"
+	DeviceTypeNUMA DeviceType = "numa"
+	DeviceTypeLLC  DeviceType = "llc"
+)
+
+// IsAggregate returns true for devices that group several cores, such as a
+// whole NUMA node or L3 cache domain.
+func (t DeviceType) IsAggregate() bool {
+	return t == DeviceTypeNUMA || t == DeviceTypeLLC
+}
+
+// AllocatableDevice is a device published in the ResourceSlice together with
+// the logical CPUs it stands for.
+type AllocatableDevice struct {
+	resourceapi.Device
+	Type DeviceType
+	Pool string
+	CPUs cpuset.CPUSet
+}
+
+type AllocatableDevices map[string]*AllocatableDevice
+
+// EnumerateAllPossibleDevices builds the devices published for the given
+// pools. nodeName makes device UUIDs unique across the cluster. All devices
+// are published in a single ResourceSlice, so they must not exceed the
+// number of devices a ResourceSlice can hold.
+func EnumerateAllPossibleDevices(nodeName string, pools []*Pool, topo *topology.Topology, aggregates []DeviceType) (AllocatableDevices, error) {
+	var poolNames []string
+	for _, pool := range pools {
+		poolNames = append(poolNames, pool.Name)
+	}
 
-func EnumerateAllPossibleDevices(cpus map[string]*cpuset.CPUSet) (AllocatableDevices, error) {
 	allDevices := make(AllocatableDevices)
-	for class, list := range cpus {
-		devices := enumerateDevicesForCPUClass(class, list)
+	for _, pool := range pools {
+		var devices AllocatableDevices
+		var err error
+		switch pool.Granularity {
+		case GranularityCore:
+			devices, err = enumerateCoreDevicesForPool(nodeName, pool, poolNames, topo)
+		default:
+			devices, err = enumerateDevicesForPool(nodeName, pool, poolNames, topo)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error enumerating %s CPUs: %w", pool.Name, err)
+		}
 		allDevices = MergeMaps(allDevices, devices)
+		allDevices = MergeMaps(allDevices, enumerateAggregateDevicesForPool(nodeName, pool, poolNames, topo, aggregates))
+	}
+	if len(allDevices) > resourceapi.ResourceSliceMaxDevices {
+		return nil, fmt.Errorf("%d devices exceed the %d devices a ResourceSlice can hold: use core granularity, fewer slots or fewer aggregate devices", len(allDevices), resourceapi.ResourceSliceMaxDevices)
 	}
 	return allDevices, nil
 }
 
-func enumerateDevicesForCPUClass(class string, set *cpuset.CPUSet) AllocatableDevices {
+func enumerateDevicesForPool(nodeName string, pool *Pool, poolNames []string, topo *topology.Topology) (AllocatableDevices, error) {
 	devices := make(AllocatableDevices)
-	uuids := generateUUIDs(class, set.Size())
-	for i, cpuID := range set.List() {
+	for _, cpuID := range pool.CPUs.List() {
+		info, err := topo.CPU(cpuID)
+		if err != nil {
+			return nil, err
+		}
 		device := resourceapi.Device{
 			Name: fmt.Sprintf("cpu-%d", cpuID),
 			Basic: &resourceapi.BasicDevice{
@@ -50,58 +126,159 @@ func enumerateDevicesForCPUClass(class string, set *cpuset.CPUSet) AllocatableDe
 						IntValue: ptr.To(int64(cpuID)),
 					},
 					"uuid": {
-						StringValue: ptr.To(uuids[i]),
+						StringValue: ptr.To(generateUUID(nodeName, cpuIdentity(info))),
 					},
-					"zone": {
-						IntValue: ptr.To(int64(0)),
+					"type": {
+						StringValue: ptr.To(string(DeviceTypeCPU)),
 					},
 				},
 			},
 		}
-		fillInMissingAttributes(device.Basic, class)
-		devices[device.Name] = device
+		fillInTopologyAttributes(device.Basic, info)
+		fillInFrequencyAttributes(device.Basic, info)
+		fillInPoolAttributes(device.Basic, pool, poolNames)
+		if pool.Slots > 1 {
+			for _, slot := range newSlotDevices(nodeName, device, info, pool.Slots) {
+				devices[slot.Name] = &AllocatableDevice{
+					Device: slot,
+					Type:   DeviceTypeCPU,
+					Pool:   pool.Name,
+					CPUs:   cpuset.New(cpuID),
+				}
+			}
+			continue
+		}
+		devices[device.Name] = &AllocatableDevice{
+			Device: device,
+			Type:   DeviceTypeCPU,
+			Pool:   pool.Name,
+			CPUs:   cpuset.New(cpuID),
+		}
 	}
-	return devices
+	return devices, nil
 }
 
-func fillInMissingAttributes(basicDevice *resourceapi.BasicDevice, cpuClass string) {
-	switch cpuClass {
-	case "reserved":
-		basicDevice.Attributes["reserved"] = resourceapi.DeviceAttribute{BoolValue: ptr.To(true)}
-		basicDevice.Attributes["shared"] = resourceapi.DeviceAttribute{BoolValue: ptr.To(false)}
-		basicDevice.Attributes["allocatable"] = resourceapi.DeviceAttribute{BoolValue: ptr.To(false)}
-	case "allocatable":
-		basicDevice.Attributes["reserved"] = resourceapi.DeviceAttribute{BoolValue: ptr.To(false)}
-		basicDevice.Attributes["shared"] = resourceapi.DeviceAttribute{BoolValue: ptr.To(false)}
-		basicDevice.Attributes["allocatable"] = resourceapi.DeviceAttribute{BoolValue: ptr.To(true)}
-	case "shared":
-		basicDevice.Attributes["reserved"] = resourceapi.DeviceAttribute{BoolValue: ptr.To(false)}
-		basicDevice.Attributes["shared"] = resourceapi.DeviceAttribute{BoolValue: ptr.To(true)}
-		basicDevice.Attributes["allocatable"] = resourceapi.DeviceAttribute{BoolValue: ptr.To(false)}
+// enumerateCoreDevicesForPool publishes one device per physical core. Every
+// thread sibling of a core must belong to the same pool, otherwise the core
+// would leak CPUs into another pool.
+func enumerateCoreDevicesForPool(nodeName string, pool *Pool, poolNames []string, topo *topology.Topology) (AllocatableDevices, error) {
+	var cores []*topology.CPUInfo
+	seen := cpuset.New()
+	for _, cpuID := range pool.CPUs.List() {
+		if seen.Contains(cpuID) {
+			continue
+		}
+		info, err := topo.CPU(cpuID)
+		if err != nil {
+			return nil, err
+		}
+		if !info.Siblings.IsSubsetOf(pool.CPUs) {
+			return nil, fmt.Errorf("core of CPU %d has thread siblings %s outside of the %s CPUs", cpuID, info.Siblings, pool.Name)
+		}
+		seen = seen.Union(info.Siblings)
+		cores = append(cores, info)
+	}
+
+	devices := make(AllocatableDevices)
+	for _, info := range cores {
+		device := resourceapi.Device{
+			// Core ids are only unique within a die.
+			Name: fmt.Sprintf("core-%d-%d-%d", info.Socket, info.Die, info.Core),
+			Basic: &resourceapi.BasicDevice{
+				Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+					"uuid": {
+						StringValue: ptr.To(generateUUID(nodeName, coreIdentity(info))),
+					},
+					"type": {
+						StringValue: ptr.To(string(DeviceTypeCore)),
+					},
+				},
+			},
+		}
+		if _, exists := devices[device.Name]; exists {
+			return nil, fmt.Errorf("duplicate core device %s", device.Name)
+		}
+		fillInTopologyAttributes(device.Basic, info)
+		fillInFrequencyAttributes(device.Basic, info)
+		fillInPoolAttributes(device.Basic, pool, poolNames)
+		devices[device.Name] = &AllocatableDevice{
+			Device: device,
+			Type:   DeviceTypeCore,
+			Pool:   pool.Name,
+			CPUs:   info.Siblings,
+		}
 	}
-	return
+	return devices, nil
 }
 
-func generateUUIDs(seed string, count int) []string {
-	rand := rand.New(rand.NewSource(hash(seed)))
+// fillInTopologyAttributes publishes where a CPU sits in the machine
+// topology. The "zone" attribute is kept as an alias of the NUMA node so that
+// existing matchAttribute constraints keep packing CPUs on a single node.
+func fillInTopologyAttributes(basicDevice *resourceapi.BasicDevice, info *topology.CPUInfo) {
+	basicDevice.Attributes["zone"] = resourceapi.DeviceAttribute{IntValue: ptr.To(int64(info.NUMANode))}
+	basicDevice.Attributes["numaNode"] = resourceapi.DeviceAttribute{IntValue: ptr.To(int64(info.NUMANode))}
+	basicDevice.Attributes["socket"] = resourceapi.DeviceAttribute{IntValue: ptr.To(int64(info.Socket))}
+	basicDevice.Attributes["die"] = resourceapi.DeviceAttribute{IntValue: ptr.To(int64(info.Die))}
+	basicDevice.Attributes["core"] = resourceapi.DeviceAttribute{IntValue: ptr.To(int64(info.Core))}
+	basicDevice.Attributes["siblings"] = resourceapi.DeviceAttribute{StringValue: ptr.To(info.Siblings.String())}
+}
 
-	uuids := make([]string, count)
-	for i := 0; i < count; i++ {
-		charset := make([]byte, 16)
-		rand.Read(charset)
-		uuid, _ := uuid.FromBytes(charset)
-		uuids[i] = "cpu-" + uuid.String()
+// fillInFrequencyAttributes publishes the frequency range and the scaling
+// governors of a CPU, which the power profile of a claim may select from.
+// Nothing is published for CPUs without a cpufreq driver.
+func fillInFrequencyAttributes(basicDevice *resourceapi.BasicDevice, info *topology.CPUInfo) {
+	if info.Freq == nil {
+		return
 	}
+	basicDevice.Attributes["minFrequencyKHz"] = resourceapi.DeviceAttribute{IntValue: ptr.To(info.Freq.MinKHz)}
+	basicDevice.Attributes["maxFrequencyKHz"] = resourceapi.DeviceAttribute{IntValue: ptr.To(info.Freq.MaxKHz)}
+	basicDevice.Attributes["governors"] = resourceapi.DeviceAttribute{StringValue: ptr.To(strings.Join(info.Freq.Governors, ","))}
+}
 
-	return uuids
+// FillInRDTAttributes publishes the resource control capabilities of the
+// node, which DeviceClasses can select RDT capable nodes with. ResourceSlices
+// have no node level attributes, so every device carries them. Nothing is
+// published without resctrl.
+func FillInRDTAttributes(devices AllocatableDevices, info *resctrl.Info) {
+	if info == nil {
+		return
+	}
+	for _, device := range devices {
+		attributes := device.Basic.Attributes
+		attributes["rdtClosCount"] = resourceapi.DeviceAttribute{IntValue: ptr.To(int64(info.CLOSCount))}
+		attributes["rdtCacheWays"] = resourceapi.DeviceAttribute{IntValue: ptr.To(int64(info.CacheWays))}
+		attributes["rdtMemoryBandwidth"] = resourceapi.DeviceAttribute{BoolValue: ptr.To(info.MemoryBandwidth)}
+	}
 }
 
-func hash(s string) int64 {
-	h := int64(0)
-	for _, c := range s {
-		h = 31*h + int64(c)
+// fillInPoolAttributes publishes which pool a device belongs to: the pool
+// name, and one boolean attribute per configured pool, see
+// config.PoolAttributeName, which is only true for the device's own pool.
+// The extra attributes configured for the pool follow.
+func fillInPoolAttributes(basicDevice *resourceapi.BasicDevice, pool *Pool, poolNames []string) {
+	basicDevice.Attributes["pool"] = resourceapi.DeviceAttribute{StringValue: ptr.To(pool.Name)}
+	for _, name := range poolNames {
+		basicDevice.Attributes[config.PoolAttributeName(name)] = resourceapi.DeviceAttribute{BoolValue: ptr.To(name == pool.Name)}
+	}
+	for name, attribute := range pool.Attributes {
+		basicDevice.Attributes[name] = attribute
 	}
-	return h
+}
+
+// generateUUID derives a device UUID from the node name and the hardware
+// identity of the device. The same CPU always gets the same UUID on a node,
+// regardless of restarts or of the pool it is configured in, while CPUs of
+// different nodes never collide.
+func generateUUID(nodeName, identity string) string {
+	return "cpu-" + uuid.NewSHA1(uuid.NameSpaceOID, []byte(nodeName+"/"+identity)).String()
+}
+
+func cpuIdentity(info *topology.CPUInfo) string {
+	return fmt.Sprintf("socket-%d/die-%d/core-%d/cpu-%d", info.Socket, info.Die, info.Core, info.ID)
+}
+
+func coreIdentity(info *topology.CPUInfo) string {
+	return fmt.Sprintf("socket-%d/die-%d/core-%d", info.Socket, info.Die, info.Core)
 }
 
 func MergeMaps[K comparable, V any](a, b map[K]V) map[K]V {
@@ -0,0 +1,440 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package discovery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	resourceapi "k8s.io/api/resource/v1beta1"
+	"k8s.io/utils/cpuset"
+	"k8s.io/utils/ptr"
+
+	"github.com/Tal-or/dra-cpu-driver/pkg/config"
+	"github.com/Tal-or/dra-cpu-driver/pkg/resctrl"
+	"github.com/Tal-or/dra-cpu-driver/pkg/topology"
+)
+
+// newTestTopology returns a single socket machine with two NUMA nodes,
+// two cores per node and two threads per core. CPU n and n+4 are siblings.
+func newTestTopology() *topology.Topology {
+	topo := &topology.Topology{
+		CPUs:   make(map[int]*topology.CPUInfo),
+		Online: cpuset.New(0, 1, 2, 3, 4, 5, 6, 7),
+		NUMANodes: map[int]cpuset.CPUSet{
+			0: cpuset.New(0, 1, 4, 5),
+			1: cpuset.New(2, 3, 6, 7),
+		},
+	}
+	for id := 0; id < 8; id++ {
+		core := id % 4
+		topo.CPUs[id] = &topology.CPUInfo{
+			ID:       id,
+			NUMANode: core / 2,
+			Core:     core,
+			Siblings: cpuset.New(core, core+4),
+		}
+	}
+	return topo
+}
+
+func TestEnumerateAllPossibleDevices(t *testing.T) {
+	tests := map[string]struct {
+		cpus        map[string]cpuset.CPUSet
+		granularity Granularity
+		slots       int
+		aggregates  []DeviceType
+		expected    map[string]cpuset.CPUSet
+		expectErr   bool
+	}{
+		"one device per CPU": {
+			cpus: map[string]cpuset.CPUSet{
+				"reserved":    cpuset.New(0, 4),
+				"allocatable": cpuset.New(1, 5),
+			},
+			granularity: GranularityCPU,
+			expected: map[string]cpuset.CPUSet{
+				"cpu-0": cpuset.New(0),
+				"cpu-4": cpuset.New(4),
+				"cpu-1": cpuset.New(1),
+				"cpu-5": cpuset.New(5),
+			},
+		},
+		"one device per core": {
+			cpus: map[string]cpuset.CPUSet{
+				"reserved":    cpuset.New(0, 4),
+				"allocatable": cpuset.New(1, 2, 5, 6),
+			},
+			granularity: GranularityCore,
+			expected: map[string]cpuset.CPUSet{
+				"core-0-0-0": cpuset.New(0, 4),
+				"core-0-0-1": cpuset.New(1, 5),
+				"core-0-0-2": cpuset.New(2, 6),
+			},
+		},
+		"whole NUMA nodes only": {
+			cpus: map[string]cpuset.CPUSet{
+				"reserved":    cpuset.New(0),
+				"allocatable": cpuset.New(1, 2, 3, 5, 6, 7),
+			},
+			granularity: GranularityCPU,
+			aggregates:  []DeviceType{DeviceTypeNUMA},
+			expected: map[string]cpuset.CPUSet{
+				"cpu-0":  cpuset.New(0),
+				"cpu-1":  cpuset.New(1),
+				"cpu-2":  cpuset.New(2),
+				"cpu-3":  cpuset.New(3),
+				"cpu-5":  cpuset.New(5),
+				"cpu-6":  cpuset.New(6),
+				"cpu-7":  cpuset.New(7),
+				"numa-1": cpuset.New(2, 3, 6, 7),
+			},
+		},
+		"slots of shared CPUs": {
+			cpus: map[string]cpuset.CPUSet{
+				"shared": cpuset.New(2, 3),
+			},
+			granularity: GranularityCPU,
+			slots:       2,
+			expected: map[string]cpuset.CPUSet{
+				"cpu-2-slot-0": cpuset.New(2),
+				"cpu-2-slot-1": cpuset.New(2),
+				"cpu-3-slot-0": cpuset.New(3),
+				"cpu-3-slot-1": cpuset.New(3),
+			},
+		},
+		"more devices than a ResourceSlice holds": {
+			cpus: map[string]cpuset.CPUSet{
+				"shared": cpuset.New(0, 1, 2, 3, 4, 5, 6, 7),
+			},
+			granularity: GranularityCPU,
+			slots:       17,
+			expectErr:   true,
+		},
+		"siblings split across pools": {
+			cpus: map[string]cpuset.CPUSet{
+				"reserved":    cpuset.New(0),
+				"allocatable": cpuset.New(4),
+			},
+			granularity: GranularityCore,
+			expectErr:   true,
+		},
+		"CPU is not online": {
+			cpus: map[string]cpuset.CPUSet{
+				"allocatable": cpuset.New(8),
+			},
+			granularity: GranularityCPU,
+			expectErr:   true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var pools []*Pool
+			for name, cpus := range test.cpus {
+				pools = append(pools, &Pool{Name: name, CPUs: cpus, Granularity: test.granularity, Slots: test.slots})
+			}
+			devices, err := EnumerateAllPossibleDevices("node-0", pools, newTestTopology(), test.aggregates)
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			actual := make(map[string]cpuset.CPUSet)
+			for name, device := range devices {
+				actual[name] = device.CPUs
+			}
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestCoreDevicesAcrossDies(t *testing.T) {
+	// Two dies of a socket whose core ids both start from 0.
+	topo := &topology.Topology{
+		CPUs:   make(map[int]*topology.CPUInfo),
+		Online: cpuset.New(0, 1, 2, 3),
+	}
+	for id := 0; id < 4; id++ {
+		topo.CPUs[id] = &topology.CPUInfo{ID: id, Die: id / 2, Core: id % 2, Siblings: cpuset.New(id)}
+	}
+
+	devices, err := EnumerateAllPossibleDevices("node-0", []*Pool{
+		{Name: "allocatable", CPUs: cpuset.New(0, 1, 2, 3), Granularity: GranularityCore},
+	}, topo, nil)
+	assert.NoError(t, err)
+
+	actual := make(map[string]cpuset.CPUSet)
+	for name, device := range devices {
+		actual[name] = device.CPUs
+	}
+	assert.Equal(t, map[string]cpuset.CPUSet{
+		"core-0-0-0": cpuset.New(0),
+		"core-0-0-1": cpuset.New(1),
+		"core-0-1-0": cpuset.New(2),
+		"core-0-1-1": cpuset.New(3),
+	}, actual)
+}
+
+func TestLLCAcrossNUMANodes(t *testing.T) {
+	topo := newTestTopology()
+	// Sub-NUMA clustering splits the second cache domain into two nodes.
+	topo.CPUs[3].NUMANode = 2
+	topo.CPUs[7].NUMANode = 2
+	topo.Caches = map[int]*topology.Cache{
+		0: {ID: 0, Level: 3, CPUs: cpuset.New(0, 1, 4, 5)},
+		1: {ID: 1, Level: 3, CPUs: cpuset.New(2, 3, 6, 7)},
+	}
+
+	devices, err := EnumerateAllPossibleDevices("node-0", []*Pool{
+		{Name: "allocatable", CPUs: topo.Online},
+	}, topo, []DeviceType{DeviceTypeLLC})
+	assert.NoError(t, err)
+
+	llc0 := devices["llc-0"].Basic.Attributes
+	assert.Equal(t, "0", *llc0["numaNodes"].StringValue)
+	assert.Equal(t, int64(0), *llc0["numaNode"].IntValue)
+	assert.Equal(t, int64(0), *llc0["zone"].IntValue)
+
+	llc1 := devices["llc-1"].Basic.Attributes
+	assert.Equal(t, "1-2", *llc1["numaNodes"].StringValue)
+	assert.NotContains(t, llc1, resourceapi.QualifiedName("numaNode"))
+	assert.NotContains(t, llc1, resourceapi.QualifiedName("zone"))
+}
+
+func TestGenerateUUID(t *testing.T) {
+	topo := newTestTopology()
+
+	devices, err := EnumerateAllPossibleDevices("node-0", []*Pool{
+		{Name: "allocatable", CPUs: cpuset.New(1, 2)},
+	}, topo, nil)
+	assert.NoError(t, err)
+
+	// Moving a CPU to another pool must not change its UUID.
+	moved, err := EnumerateAllPossibleDevices("node-0", []*Pool{
+		{Name: "reserved", CPUs: cpuset.New(1)},
+		{Name: "allocatable", CPUs: cpuset.New(2)},
+	}, topo, nil)
+	assert.NoError(t, err)
+
+	other, err := EnumerateAllPossibleDevices("node-1", []*Pool{
+		{Name: "allocatable", CPUs: cpuset.New(1, 2)},
+	}, topo, nil)
+	assert.NoError(t, err)
+
+	uuid := func(devices AllocatableDevices, name string) string {
+		return *devices[name].Basic.Attributes["uuid"].StringValue
+	}
+	assert.Equal(t, uuid(devices, "cpu-1"), uuid(moved, "cpu-1"))
+	assert.Equal(t, uuid(devices, "cpu-2"), uuid(moved, "cpu-2"))
+	assert.NotEqual(t, uuid(devices, "cpu-1"), uuid(devices, "cpu-2"))
+	assert.NotEqual(t, uuid(devices, "cpu-1"), uuid(other, "cpu-1"))
+}
+
+func TestResolvePools(t *testing.T) {
+	tests := map[string]struct {
+		config    string
+		expected  map[string]cpuset.CPUSet
+		expectErr bool
+	}{
+		"explicit cpus and selector": {
+			config: `
+pools:
+- name: reserved
+  cpus: "0,4"
+- name: allocatable
+  selector:
+    numaNodes: [1]
+    excludeCores: [3]
+  granularity: core
+  attributes:
+    tier:
+      string: gold
+`,
+			expected: map[string]cpuset.CPUSet{
+				"reserved":    cpuset.New(0, 4),
+				"allocatable": cpuset.New(2, 6),
+			},
+		},
+		"overlapping pools": {
+			config: `
+pools:
+- name: reserved
+  cpus: "0-1"
+- name: shared
+  cpus: "1-2"
+`,
+			expectErr: true,
+		},
+		"offline CPUs": {
+			config: `
+pools:
+- name: reserved
+  cpus: "0,8"
+`,
+			expectErr: true,
+		},
+		"invalid granularity": {
+			config: `
+pools:
+- name: reserved
+  cpus: "0"
+  granularity: socket
+`,
+			expectErr: true,
+		},
+		"slots with core granularity": {
+			config: `
+pools:
+- name: shared
+  cpus: "0,4"
+  granularity: core
+  slots: 4
+`,
+			expectErr: true,
+		},
+		"driver attribute": {
+			config: `
+pools:
+- name: reserved
+  cpus: "0"
+  attributes:
+    numaNode:
+      int: 3
+`,
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(test.config), 0644); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := config.LoadDriverConfig(path)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			pools, err := ResolvePools(cfg, newTestTopology(), GranularityCPU)
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			actual := make(map[string]cpuset.CPUSet)
+			for _, pool := range pools {
+				actual[pool.Name] = pool.CPUs
+			}
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestPoolAttributes(t *testing.T) {
+	devices, err := EnumerateAllPossibleDevices("node-0", []*Pool{
+		{Name: "low-latency", CPUs: cpuset.New(1)},
+		{Name: "batch", CPUs: cpuset.New(2), Attributes: map[resourceapi.QualifiedName]resourceapi.DeviceAttribute{
+			"tier": {StringValue: ptr.To("bronze")},
+		}},
+	}, newTestTopology(), nil)
+	assert.NoError(t, err)
+
+	lowLatency := devices["cpu-1"].Basic.Attributes
+	assert.Equal(t, "low-latency", *lowLatency["pool"].StringValue)
+	assert.True(t, *lowLatency["low_latency"].BoolValue)
+	assert.False(t, *lowLatency["batch"].BoolValue)
+	assert.NotContains(t, lowLatency, resourceapi.QualifiedName("tier"))
+
+	batch := devices["cpu-2"].Basic.Attributes
+	assert.Equal(t, "batch", *batch["pool"].StringValue)
+	assert.False(t, *batch["low_latency"].BoolValue)
+	assert.True(t, *batch["batch"].BoolValue)
+	assert.Equal(t, "bronze", *batch["tier"].StringValue)
+}
+
+func TestMaxDriverAttributes(t *testing.T) {
+	topo := newTestTopology()
+	topo.CPUs[1].Freq = &topology.CPUFreq{MinKHz: 800000, MaxKHz: 3500000, Governors: []string{"performance"}}
+
+	devices, err := EnumerateAllPossibleDevices("node-0", []*Pool{
+		{Name: "shared", CPUs: cpuset.New(1), Slots: 2},
+	}, topo, nil)
+	assert.NoError(t, err)
+	FillInRDTAttributes(devices, &resctrl.Info{CLOSCount: 16, CacheWays: 12, MemoryBandwidth: true})
+
+	// The attributes of the driver and the one of the pool.
+	assert.Len(t, devices["cpu-1-slot-0"].Basic.Attributes, config.MaxDriverAttributes+1)
+}
+
+func TestSlotDevices(t *testing.T) {
+	devices, err := EnumerateAllPossibleDevices("node-0", []*Pool{
+		{Name: "shared", CPUs: cpuset.New(2), Slots: 2},
+	}, newTestTopology(), nil)
+	assert.NoError(t, err)
+
+	slot0 := devices["cpu-2-slot-0"].Basic.Attributes
+	slot1 := devices["cpu-2-slot-1"].Basic.Attributes
+	assert.Equal(t, int64(2), *slot0["physicalCpu"].IntValue)
+	assert.Equal(t, int64(2), *slot1["physicalCpu"].IntValue)
+	assert.Equal(t, int64(0), *slot0["slot"].IntValue)
+	assert.Equal(t, int64(1), *slot1["slot"].IntValue)
+	assert.Equal(t, *slot0["numaNode"].IntValue, *slot1["numaNode"].IntValue)
+	assert.NotEqual(t, *slot0["uuid"].StringValue, *slot1["uuid"].StringValue)
+
+	assert.Equal(t, "cpu-2", PhysicalDeviceName("cpu-2-slot-1"))
+	assert.Equal(t, "core-0-0-1", PhysicalDeviceName("core-0-0-1"))
+	assert.True(t, IsSlotDevice("cpu-2-slot-1"))
+	assert.False(t, IsSlotDevice("cpu-2"))
+}
+
+func TestFrequencyAttributes(t *testing.T) {
+	topo := newTestTopology()
+	topo.CPUs[1].Freq = &topology.CPUFreq{MinKHz: 800000, MaxKHz: 3500000, Governors: []string{"performance", "powersave"}}
+
+	devices, err := EnumerateAllPossibleDevices("node-0", []*Pool{
+		{Name: "allocatable", CPUs: cpuset.New(1, 2)},
+	}, topo, nil)
+	assert.NoError(t, err)
+
+	cpu1 := devices["cpu-1"].Basic.Attributes
+	assert.Equal(t, int64(800000), *cpu1["minFrequencyKHz"].IntValue)
+	assert.Equal(t, int64(3500000), *cpu1["maxFrequencyKHz"].IntValue)
+	assert.Equal(t, "performance,powersave", *cpu1["governors"].StringValue)
+	assert.NotContains(t, devices["cpu-2"].Basic.Attributes, resourceapi.QualifiedName("governors"))
+}
+
+func TestRDTAttributes(t *testing.T) {
+	devices, err := EnumerateAllPossibleDevices("node-0", []*Pool{
+		{Name: "allocatable", CPUs: cpuset.New(1, 2, 3, 5, 6, 7)},
+	}, newTestTopology(), []DeviceType{DeviceTypeNUMA})
+	assert.NoError(t, err)
+
+	FillInRDTAttributes(devices, &resctrl.Info{CLOSCount: 16, CacheWays: 12, MemoryBandwidth: true})
+	for name, device := range devices {
+		attributes := device.Basic.Attributes
+		assert.LessOrEqual(t, len(attributes), config.MaxDriverAttributes+1, name)
+		assert.Equal(t, int64(16), *attributes["rdtClosCount"].IntValue, name)
+		assert.Equal(t, int64(12), *attributes["rdtCacheWays"].IntValue, name)
+		assert.True(t, *attributes["rdtMemoryBandwidth"].BoolValue, name)
+	}
+}
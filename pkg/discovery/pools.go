@@ -0,0 +1,156 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package discovery
+
+import (
+	"fmt"
+	"slices"
+
+	resourceapi "k8s.io/api/resource/v1beta1"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/cpuset"
+
+	"github.com/Tal-or/dra-cpu-driver/pkg/config"
+	"github.com/Tal-or/dra-cpu-driver/pkg/topology"
+)
+
+// driverAttributes are set by the driver itself and cannot be overridden by
+// the pool configuration.
+var driverAttributes = []resourceapi.QualifiedName{
+	"index", "uuid", "type", "pool", "zone", "numaNode", "numaNodes", "socket", "die", "core",
+	"siblings", "cpus", "cpuCount", "cacheLevel", "cacheSize", "physicalCpu", "slot",
+	"minFrequencyKHz", "maxFrequencyKHz", "governors",
+	"rdtClosCount", "rdtCacheWays", "rdtMemoryBandwidth",
+}
+
+// Pool is a named set of CPUs whose devices are published with the same
+// attributes.
+type Pool struct {
+	Name        string
+	CPUs        cpuset.CPUSet
+	Granularity Granularity
+	// Slots is the number of devices published for every CPU of the pool,
+	// no slot devices are published when it is lower than 2.
+	Slots int
+	// Shared tells whether the devices of the pool default to Shared
+	// pinning.
+	Shared     bool
+	Attributes map[resourceapi.QualifiedName]resourceapi.DeviceAttribute
+}
+
+// ResolvePools turns the pool configuration into concrete sets of CPUs. Pools
+// must only contain online CPUs and must not overlap. Online CPUs that are
+// not part of any pool are reported, as they can never be allocated.
+func ResolvePools(cfg *config.DriverConfig, topo *topology.Topology, defaultGranularity Granularity) ([]*Pool, error) {
+	var pools []*Pool
+	assigned := cpuset.New()
+	for _, poolConfig := range cfg.Pools {
+		pool, err := resolvePool(&poolConfig, topo, defaultGranularity)
+		if err != nil {
+			return nil, fmt.Errorf("pool %q: %w", poolConfig.Name, err)
+		}
+		if pool.CPUs.IsEmpty() {
+			klog.Warningf("Pool %q does not contain any CPU", pool.Name)
+		}
+		if overlap := assigned.Intersection(pool.CPUs); !overlap.IsEmpty() {
+			return nil, fmt.Errorf("pool %q: CPUs %s are already part of another pool", pool.Name, overlap)
+		}
+		assigned = assigned.Union(pool.CPUs)
+		pools = append(pools, pool)
+	}
+
+	if unassigned := topo.Online.Difference(assigned); !unassigned.IsEmpty() {
+		klog.Warningf("Online CPUs %s are not part of any pool and will not be published", unassigned)
+	}
+
+	return pools, nil
+}
+
+func resolvePool(poolConfig *config.PoolConfig, topo *topology.Topology, defaultGranularity Granularity) (*Pool, error) {
+	granularity := defaultGranularity
+	if poolConfig.Granularity != "" {
+		var err error
+		granularity, err = ParseGranularity(poolConfig.Granularity)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if poolConfig.Slots > 1 && granularity != GranularityCPU {
+		return nil, fmt.Errorf("slots require the %s granularity", GranularityCPU)
+	}
+
+	if slices.Contains(driverAttributes, config.PoolAttributeName(poolConfig.Name)) {
+		return nil, fmt.Errorf("pool name clashes with attribute %q set by the driver", poolConfig.Name)
+	}
+	for name := range poolConfig.Attributes {
+		if slices.Contains(driverAttributes, name) {
+			return nil, fmt.Errorf("attribute %q is reserved for the driver", name)
+		}
+	}
+
+	var cpus cpuset.CPUSet
+	if poolConfig.Selector != nil {
+		var err error
+		cpus, err = selectCPUs(poolConfig.Selector, topo)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		cpus, err = cpuset.Parse(poolConfig.CPUs)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cpus %q: %w", poolConfig.CPUs, err)
+		}
+	}
+	if offline := cpus.Difference(topo.Online); !offline.IsEmpty() {
+		return nil, fmt.Errorf("CPUs %s are not online", offline)
+	}
+
+	return &Pool{
+		Name:        poolConfig.Name,
+		CPUs:        cpus,
+		Granularity: granularity,
+		Slots:       poolConfig.Slots,
+		Shared:      poolConfig.Shared,
+		Attributes:  poolConfig.Attributes,
+	}, nil
+}
+
+// selectCPUs returns the online CPUs matching the selector.
+func selectCPUs(selector *config.CPUSelector, topo *topology.Topology) (cpuset.CPUSet, error) {
+	excluded, err := cpuset.Parse(selector.ExcludeCPUs)
+	if err != nil {
+		return cpuset.New(), fmt.Errorf("invalid excludeCpus %q: %w", selector.ExcludeCPUs, err)
+	}
+
+	var selected []int
+	for _, id := range topo.Online.List() {
+		info := topo.CPUs[id]
+		if len(selector.NUMANodes) > 0 && !slices.Contains(selector.NUMANodes, info.NUMANode) {
+			continue
+		}
+		if len(selector.Sockets) > 0 && !slices.Contains(selector.Sockets, info.Socket) {
+			continue
+		}
+		if slices.Contains(selector.ExcludeCores, info.Core) || excluded.Contains(id) {
+			continue
+		}
+		selected = append(selected, id)
+	}
+	return cpuset.New(selected...), nil
+}
@@ -0,0 +1,74 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package discovery
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+
+	resourceapi "k8s.io/api/resource/v1beta1"
+	"k8s.io/utils/ptr"
+
+	"github.com/Tal-or/dra-cpu-driver/pkg/topology"
+)
+
+// A device can only be allocated to a single claim. To let several claims
+// share a CPU, the CPUs of pools with slots are published as several slot
+// devices ("cpu-2-slot-0", "cpu-2-slot-1", ...) which all stand for the same
+// physical CPU, published in their "physicalCpu" attribute.
+const slotSeparator = "-slot-"
+
+// SlotDeviceName returns the name of a slot of a device.
+func SlotDeviceName(deviceName string, slot int) string {
+	return fmt.Sprintf("%s%s%d", deviceName, slotSeparator, slot)
+}
+
+// PhysicalDeviceName returns the name of the device a slot device stands for.
+// Other device names are returned as is.
+func PhysicalDeviceName(deviceName string) string {
+	if i := strings.LastIndex(deviceName, slotSeparator); i >= 0 {
+		return deviceName[:i]
+	}
+	return deviceName
+}
+
+// IsSlotDevice tells whether a device is a slot of a shared CPU.
+func IsSlotDevice(deviceName string) bool {
+	return strings.Contains(deviceName, slotSeparator)
+}
+
+// newSlotDevices returns the slot devices of a CPU device. Every slot has its
+// own UUID and carries all the attributes of the CPU.
+func newSlotDevices(nodeName string, device resourceapi.Device, info *topology.CPUInfo, slots int) []resourceapi.Device {
+	var devices []resourceapi.Device
+	for slot := 0; slot < slots; slot++ {
+		attributes := maps.Clone(device.Basic.Attributes)
+		attributes["uuid"] = resourceapi.DeviceAttribute{
+			StringValue: ptr.To(generateUUID(nodeName, fmt.Sprintf("%s/slot-%d", cpuIdentity(info), slot))),
+		}
+		attributes["physicalCpu"] = resourceapi.DeviceAttribute{IntValue: ptr.To(int64(info.ID))}
+		attributes["slot"] = resourceapi.DeviceAttribute{IntValue: ptr.To(int64(slot))}
+		devices = append(devices, resourceapi.Device{
+			Name: SlotDeviceName(device.Name, slot),
+			Basic: &resourceapi.BasicDevice{
+				Attributes: attributes,
+			},
+		})
+	}
+	return devices
+}
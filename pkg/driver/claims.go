@@ -0,0 +1,217 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package driver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	resourceapi "k8s.io/api/resource/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/wait"
+	resourceinformers "k8s.io/client-go/informers/resource/v1beta1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	drapbv1 "k8s.io/kubelet/pkg/apis/dra/v1beta1"
+
+	"github.com/Tal-or/dra-cpu-driver/pkg/config"
+)
+
+// Prepare looks the ResourceClaims up in a cache fed by an informer rather
+// than getting them from the API server, which would consume the client's
+// small QPS budget on every pod start. ResourceClaims have no field selector
+// on their allocation, so the driver labels the claims it prepares with its
+// node and the informer only watches the claims carrying that label. A claim
+// missing from the cache, e.g. because it is prepared for the first time or
+// the informer has not caught up yet, is fetched with a live GET.
+
+// NodeLabel is the label the driver sets on the ResourceClaims it prepares,
+// holding the label value of its node name.
+const NodeLabel = config.DriverName + "/node"
+
+// claimFetchBackoff bounds the retries of the GET of a ResourceClaim.
+var claimFetchBackoff = wait.Backoff{
+	Duration: 100 * time.Millisecond,
+	Factor:   2,
+	Jitter:   0.1,
+	Steps:    5,
+}
+
+func claimKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// nodeLabelValue returns the value of NodeLabel for a node. Node names longer
+// than a label value are replaced by a hash.
+func nodeLabelValue(nodeName string) string {
+	if len(validation.IsValidLabelValue(nodeName)) == 0 {
+		return nodeName
+	}
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(nodeName)))[:validation.LabelValueMaxLength]
+}
+
+// StartClaimInformer keeps the ResourceClaims allocated on the node in the
+// claim cache until ctx is cancelled.
+func (d *Driver) StartClaimInformer(ctx context.Context, nodeName string) error {
+	selector := labels.SelectorFromSet(labels.Set{NodeLabel: nodeLabelValue(nodeName)}).String()
+	informer := resourceinformers.NewFilteredResourceClaimInformer(d.Client, metav1.NamespaceAll, 0, cache.Indexers{}, func(options *metav1.ListOptions) {
+		options.LabelSelector = selector
+	})
+
+	// Managed fields are never used and take a large part of the memory of
+	// every claim.
+	err := informer.SetTransform(func(obj any) (any, error) {
+		if accessor, err := meta.Accessor(obj); err == nil {
+			accessor.SetManagedFields(nil)
+		}
+		return obj, nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to set ResourceClaim informer transform: %w", err)
+	}
+
+	set := func(obj any) {
+		if claim, ok := claimFromObject(obj); ok {
+			d.claimCache.Set(claimKey(claim.Namespace, claim.Name), claim)
+		}
+	}
+	_, err = informer.AddEventHandler(cache.FilteringResourceEventHandler{
+		// Claims which stop matching, e.g. because they were deallocated,
+		// are handed to DeleteFunc.
+		FilterFunc: func(obj any) bool {
+			claim, ok := claimFromObject(obj)
+			return ok && isAllocatedOnNode(claim, nodeName)
+		},
+		Handler: cache.ResourceEventHandlerFuncs{
+			AddFunc: set,
+			UpdateFunc: func(_, obj any) {
+				set(obj)
+			},
+			DeleteFunc: func(obj any) {
+				if claim, ok := claimFromObject(obj); ok {
+					d.claimCache.Delete(claimKey(claim.Namespace, claim.Name))
+				}
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to add ResourceClaim informer handler: %w", err)
+	}
+
+	d.claimCacheSynced = informer.HasSynced
+	go informer.Run(ctx.Done())
+	go func() {
+		if cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+			klog.Infof("ResourceClaim informer synced, %d claims allocated on node %s", d.claimCache.Len(), nodeName)
+		}
+	}()
+	return nil
+}
+
+// claimFromObject returns the ResourceClaim of an informer event, including
+// the last known state of a claim whose deletion was missed.
+func claimFromObject(obj any) (*resourceapi.ResourceClaim, bool) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	claim, ok := obj.(*resourceapi.ResourceClaim)
+	return claim, ok
+}
+
+// getResourceClaim returns the ResourceClaim of a request. The cached claim is
+// only used if it has the requested UID, a claim recreated under the same
+// name may not have reached the cache yet.
+func (d *Driver) getResourceClaim(ctx context.Context, claim *drapbv1.Claim) (*resourceapi.ResourceClaim, error) {
+	if cached, found := d.claimCache.Get(claimKey(claim.Namespace, claim.Name)); found && string(cached.UID) == claim.UID {
+		return cached, nil
+	}
+	return fetchResourceClaim(ctx, claim, claimFetchBackoff, func(ctx context.Context) (*resourceapi.ResourceClaim, error) {
+		return d.Client.ResourceV1beta1().ResourceClaims(claim.Namespace).Get(ctx, claim.Name, metav1.GetOptions{})
+	})
+}
+
+// labelResourceClaim sets NodeLabel on a claim prepared on the node so that
+// the claim informer watches it. The UID in the patch makes it fail on a claim
+// recreated under the same name. An unlabelled claim only costs live GETs, so
+// failures are logged rather than returned.
+func (d *Driver) labelResourceClaim(ctx context.Context, claim *resourceapi.ResourceClaim, nodeName string) {
+	value := nodeLabelValue(nodeName)
+	if claim.Labels[NodeLabel] == value {
+		return
+	}
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"uid":    claim.UID,
+			"labels": map[string]string{NodeLabel: value},
+		},
+	})
+	if err != nil {
+		klog.Warningf("Unable to build the label patch of ResourceClaim %s: %v", claimKey(claim.Namespace, claim.Name), err)
+		return
+	}
+	_, err = d.Client.ResourceV1beta1().ResourceClaims(claim.Namespace).Patch(ctx, claim.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		klog.Warningf("Unable to label ResourceClaim %s: %v", claimKey(claim.Namespace, claim.Name), err)
+	}
+}
+
+// fetchResourceClaim gets the ResourceClaim of a request, retrying transient
+// errors with backoff, and makes sure it is the requested claim.
+func fetchResourceClaim(ctx context.Context, claim *drapbv1.Claim, backoff wait.Backoff, get func(context.Context) (*resourceapi.ResourceClaim, error)) (*resourceapi.ResourceClaim, error) {
+	var resourceClaim *resourceapi.ResourceClaim
+	var lastErr error
+	err := wait.ExponentialBackoffWithContext(ctx, backoff, func(ctx context.Context) (bool, error) {
+		resourceClaim, lastErr = get(ctx)
+		if lastErr == nil {
+			return true, nil
+		}
+		if isPermanentError(lastErr) {
+			return false, lastErr
+		}
+		klog.V(4).Infof("Retrying GET of ResourceClaim %s: %v", claimKey(claim.Namespace, claim.Name), lastErr)
+		return false, nil
+	})
+	if err != nil {
+		if lastErr != nil {
+			err = lastErr
+		}
+		return nil, fmt.Errorf("failed to fetch ResourceClaim %s in namespace %s: %w", claim.Name, claim.Namespace, err)
+	}
+
+	if string(resourceClaim.UID) != claim.UID {
+		return nil, fmt.Errorf("ResourceClaim %s in namespace %s has UID %s instead of %s", claim.Name, claim.Namespace, resourceClaim.UID, claim.UID)
+	}
+	return resourceClaim, nil
+}
+
+// isPermanentError tells whether retrying a failed request cannot succeed.
+func isPermanentError(err error) bool {
+	return apierrors.IsNotFound(err) ||
+		apierrors.IsForbidden(err) ||
+		apierrors.IsUnauthorized(err) ||
+		apierrors.IsBadRequest(err) ||
+		apierrors.IsInvalid(err) ||
+		apierrors.IsMethodNotSupported(err)
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package driver
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	resourceapi "k8s.io/api/resource/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/wait"
+	drapbv1 "k8s.io/kubelet/pkg/apis/dra/v1beta1"
+
+	drivercache "github.com/Tal-or/dra-cpu-driver/pkg/cache"
+)
+
+func TestFetchResourceClaim(t *testing.T) {
+	request := &drapbv1.Claim{Namespace: "default", Name: "cpus", UID: "uid-0"}
+	claim := &resourceapi.ResourceClaim{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cpus", UID: "uid-0"},
+	}
+	recreated := &resourceapi.ResourceClaim{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cpus", UID: "uid-1"},
+	}
+	transient := apierrors.NewServiceUnavailable("unavailable")
+	notFound := apierrors.NewNotFound(schema.GroupResource{Group: "resource.k8s.io", Resource: "resourceclaims"}, "cpus")
+
+	tests := map[string]struct {
+		responses     []*resourceapi.ResourceClaim
+		errors        []error
+		expectedCalls int
+		expectErr     bool
+	}{
+		"found": {
+			responses:     []*resourceapi.ResourceClaim{claim},
+			errors:        []error{nil},
+			expectedCalls: 1,
+		},
+		"transient errors are retried": {
+			responses:     []*resourceapi.ResourceClaim{nil, nil, claim},
+			errors:        []error{transient, transient, nil},
+			expectedCalls: 3,
+		},
+		"retries are bounded": {
+			responses:     []*resourceapi.ResourceClaim{nil, nil, nil},
+			errors:        []error{transient, transient, transient},
+			expectedCalls: 3,
+			expectErr:     true,
+		},
+		"not found is not retried": {
+			responses:     []*resourceapi.ResourceClaim{nil},
+			errors:        []error{notFound},
+			expectedCalls: 1,
+			expectErr:     true,
+		},
+		"different UID": {
+			responses:     []*resourceapi.ResourceClaim{recreated},
+			errors:        []error{nil},
+			expectedCalls: 1,
+			expectErr:     true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			calls := 0
+			get := func(context.Context) (*resourceapi.ResourceClaim, error) {
+				calls++
+				return test.responses[calls-1], test.errors[calls-1]
+			}
+			backoff := wait.Backoff{Duration: 1, Steps: 3}
+			actual, err := fetchResourceClaim(context.Background(), request, backoff, get)
+			assert.Equal(t, test.expectedCalls, calls)
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, claim, actual)
+		})
+	}
+}
+
+func TestGetResourceClaimFromCache(t *testing.T) {
+	claim := &resourceapi.ResourceClaim{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cpus", UID: "uid-0"},
+	}
+	d := &Driver{claimCache: drivercache.New[string, *resourceapi.ResourceClaim]()}
+	d.claimCache.Set(claimKey("default", "cpus"), claim)
+
+	// No client is set: a cache hit must not reach the API server.
+	actual, err := d.getResourceClaim(context.Background(), &drapbv1.Claim{Namespace: "default", Name: "cpus", UID: "uid-0"})
+	assert.NoError(t, err)
+	assert.Equal(t, claim, actual)
+}
+
+func TestNodeLabelValue(t *testing.T) {
+	long := strings.Repeat("node.", 50) + "example"
+
+	tests := map[string]struct {
+		nodeName string
+		expected string
+	}{
+		"valid label value": {
+			nodeName: "worker-0.example.com",
+			expected: "worker-0.example.com",
+		},
+		"too long": {
+			nodeName: long,
+			expected: fmt.Sprintf("%x", sha256.Sum256([]byte(long)))[:validation.LabelValueMaxLength],
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			actual := nodeLabelValue(test.nodeName)
+			assert.Equal(t, test.expected, actual)
+			assert.Empty(t, validation.IsValidLabelValue(actual))
+		})
+	}
+}
+
+func TestLabelResourceClaimAlreadyLabelled(t *testing.T) {
+	claim := &resourceapi.ResourceClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "cpus",
+			UID:       "uid-0",
+			Labels:    map[string]string{NodeLabel: "worker-0"},
+		},
+	}
+
+	// No client is set: a labelled claim must not be patched.
+	d := &Driver{}
+	d.labelResourceClaim(context.Background(), claim, "worker-0")
+}
@@ -20,12 +20,14 @@ import (
 	"context"
 	"fmt"
 
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	resourceapi "k8s.io/api/resource/v1beta1"
 	coreclientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/workqueue"
 	"k8s.io/dynamic-resource-allocation/kubeletplugin"
 	"k8s.io/klog/v2"
 	drapbv1 "k8s.io/kubelet/pkg/apis/dra/v1beta1"
 
+	drivercache "github.com/Tal-or/dra-cpu-driver/pkg/cache"
 	"github.com/Tal-or/dra-cpu-driver/pkg/config"
 	"github.com/Tal-or/dra-cpu-driver/pkg/state"
 )
@@ -36,11 +38,25 @@ type Driver struct {
 	Client coreclientset.Interface
 	Plugin kubeletplugin.DRAPlugin
 	State  *state.DeviceState
+	// nodeName is the node the driver runs on.
+	nodeName string
+	// workers bounds the number of claims of a request handled
+	// concurrently.
+	workers int
+	// claimCache holds the ResourceClaims allocated on the node, by
+	// namespace and name.
+	claimCache *drivercache.Cache[string, *resourceapi.ResourceClaim]
+	// claimCacheSynced tells whether the claim cache holds all the claims
+	// allocated on the node. It is nil until the informer is started.
+	claimCacheSynced func() bool
 }
 
 func New(ctx context.Context, cfg *config.Config) (*Driver, error) {
 	drv := &Driver{
-		Client: cfg.Coreclient,
+		Client:     cfg.Coreclient,
+		nodeName:   cfg.ProgArgs.NodeName,
+		workers:    cfg.ProgArgs.PrepareWorkers,
+		claimCache: drivercache.New[string, *resourceapi.ResourceClaim](),
 	}
 
 	deviceState, err := state.NewDeviceState(cfg)
@@ -63,18 +79,30 @@ func New(ctx context.Context, cfg *config.Config) (*Driver, error) {
 	}
 	drv.Plugin = plugin
 
-	var resources kubeletplugin.Resources
-	for _, device := range deviceState.Allocatable {
-		resources.Devices = append(resources.Devices, device)
-	}
-	klog.InfoS("publishing resources", "resources", resources)
-	if err := plugin.PublishResources(ctx, resources); err != nil {
+	if err := drv.publishResources(ctx); err != nil {
 		return nil, err
 	}
 
 	return drv, nil
 }
 
+// Reload recomputes the allocatable devices from the current pool
+// configuration and republishes the ResourceSlice.
+func (d *Driver) Reload(ctx context.Context) error {
+	if err := d.State.Reload(); err != nil {
+		return err
+	}
+	return d.publishResources(ctx)
+}
+
+func (d *Driver) publishResources(ctx context.Context) error {
+	resources := kubeletplugin.Resources{
+		Devices: d.State.Devices(),
+	}
+	klog.InfoS("publishing resources", "resources", resources)
+	return d.Plugin.PublishResources(ctx, resources)
+}
+
 func (d *Driver) Shutdown(ctx context.Context) error {
 	d.Plugin.Stop()
 	return nil
@@ -84,21 +112,28 @@ func (d *Driver) NodePrepareResources(ctx context.Context, req *drapbv1.NodePrep
 	klog.Infof("NodePrepareResource is called: number of claims: %d", len(req.Claims))
 	preparedResources := &drapbv1.NodePrepareResourcesResponse{Claims: map[string]*drapbv1.NodePrepareResourceResponse{}}
 
-	for _, claim := range req.Claims {
-		preparedResources.Claims[claim.UID] = d.nodePrepareResource(ctx, claim)
+	responses := make([]*drapbv1.NodePrepareResourceResponse, len(req.Claims))
+	workqueue.ParallelizeUntil(ctx, d.workers, len(req.Claims), func(i int) {
+		responses[i] = d.nodePrepareResource(ctx, req.Claims[i])
+	})
+
+	for i, claim := range req.Claims {
+		if responses[i] == nil {
+			responses[i] = &drapbv1.NodePrepareResourceResponse{
+				Error: fmt.Sprintf("claim %v was not prepared: %v", claim.UID, ctx.Err()),
+			}
+		}
+		preparedResources.Claims[claim.UID] = responses[i]
 	}
 
 	return preparedResources, nil
 }
 
 func (d *Driver) nodePrepareResource(ctx context.Context, claim *drapbv1.Claim) *drapbv1.NodePrepareResourceResponse {
-	resourceClaim, err := d.Client.ResourceV1beta1().ResourceClaims(claim.Namespace).Get(
-		ctx,
-		claim.Name,
-		metav1.GetOptions{})
+	resourceClaim, err := d.getResourceClaim(ctx, claim)
 	if err != nil {
 		return &drapbv1.NodePrepareResourceResponse{
-			Error: fmt.Sprintf("failed to fetch ResourceClaim %s in namespace %s", claim.Name, claim.Namespace),
+			Error: err.Error(),
 		}
 	}
 
@@ -109,6 +144,8 @@ func (d *Driver) nodePrepareResource(ctx context.Context, claim *drapbv1.Claim)
 		}
 	}
 
+	d.labelResourceClaim(ctx, resourceClaim, d.nodeName)
+
 	klog.Infof("Returning newly prepared devices for claim '%v': %v", claim.UID, prepared)
 	return &drapbv1.NodePrepareResourceResponse{Devices: prepared}
 }
@@ -117,8 +154,18 @@ func (d *Driver) NodeUnprepareResources(ctx context.Context, req *drapbv1.NodeUn
 	klog.Infof("NodeUnPrepareResource is called: number of claims: %d", len(req.Claims))
 	unpreparedResources := &drapbv1.NodeUnprepareResourcesResponse{Claims: map[string]*drapbv1.NodeUnprepareResourceResponse{}}
 
-	for _, claim := range req.Claims {
-		unpreparedResources.Claims[claim.UID] = d.nodeUnprepareResource(ctx, claim)
+	responses := make([]*drapbv1.NodeUnprepareResourceResponse, len(req.Claims))
+	workqueue.ParallelizeUntil(ctx, d.workers, len(req.Claims), func(i int) {
+		responses[i] = d.nodeUnprepareResource(ctx, req.Claims[i])
+	})
+
+	for i, claim := range req.Claims {
+		if responses[i] == nil {
+			responses[i] = &drapbv1.NodeUnprepareResourceResponse{
+				Error: fmt.Sprintf("claim %v was not unprepared: %v", claim.UID, ctx.Err()),
+			}
+		}
+		unpreparedResources.Claims[claim.UID] = responses[i]
 	}
 
 	return unpreparedResources, nil
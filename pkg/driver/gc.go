@@ -0,0 +1,139 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	resourceapi "k8s.io/api/resource/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+
+	"github.com/Tal-or/dra-cpu-driver/pkg/config"
+)
+
+// If the kubelet never unprepares a claim, e.g. because the node crashed or
+// its state was lost, the claim stays in the checkpoint and keeps its CPUs
+// forever. The garbage collector periodically unprepares the claims that no
+// longer exist or are no longer allocated on this node, and deletes the CDI
+// spec files no prepared claim owns.
+//
+// The claims are looked up in the claim cache rather than listed from the API
+// server, which would fetch every ResourceClaim of the cluster on every node.
+// The cache may lag behind the claims prepared after a live GET, or miss a
+// claim whose labelling failed, so a claim missing from it is only unprepared
+// once the API server confirms it is stale. Claims confirmed live are
+// labelled again so that they reach the cache.
+
+// StartGarbageCollector runs the garbage collector every interval until ctx
+// is cancelled.
+func (d *Driver) StartGarbageCollector(ctx context.Context, nodeName string, interval time.Duration) {
+	go wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := d.collectGarbage(ctx, nodeName); err != nil {
+			klog.FromContext(ctx).Error(err, "Unable to garbage collect prepared claims")
+		}
+	}, interval)
+}
+
+func (d *Driver) collectGarbage(ctx context.Context, nodeName string) error {
+	if d.claimCacheSynced == nil || !d.claimCacheSynced() {
+		klog.V(2).Infof("Skipping garbage collection until the ResourceClaim informer is synced")
+		return nil
+	}
+
+	// Only the claims prepared before reading the cache are considered, a
+	// claim prepared in the meantime might be missing from it.
+	prepared := d.State.PreparedClaimUIDs()
+
+	for _, claimUID := range staleClaims(prepared, d.claimCache.Values(), nodeName) {
+		stale, err := d.confirmStale(ctx, claimUID, nodeName)
+		if err != nil {
+			return err
+		}
+		if !stale {
+			continue
+		}
+		klog.Infof("Unpreparing stale claim %s", claimUID)
+		if err := d.State.Unprepare(claimUID); err != nil {
+			return fmt.Errorf("unable to unprepare stale claim %s: %w", claimUID, err)
+		}
+	}
+
+	if _, err := d.State.RemoveOrphanedCDISpecs(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// confirmStale gets a prepared claim missing from the claim cache from the API
+// server, and tells whether it does not exist anymore or is not allocated on
+// the node. Live claims are labelled for the claim informer. Claims whose
+// name was not recorded cannot be looked up and are stale.
+func (d *Driver) confirmStale(ctx context.Context, claimUID, nodeName string) (bool, error) {
+	namespace, name := d.State.PreparedClaimName(claimUID)
+	if name == "" {
+		return true, nil
+	}
+	claim, err := d.Client.ResourceV1beta1().ResourceClaims(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("unable to get ResourceClaim %s: %w", claimKey(namespace, name), err)
+	}
+	if string(claim.UID) != claimUID || !isAllocatedOnNode(claim, nodeName) {
+		return true, nil
+	}
+	d.labelResourceClaim(ctx, claim, nodeName)
+	return false, nil
+}
+
+// staleClaims returns the prepared claims which do not exist anymore or are
+// not allocated devices of this node's pool.
+func staleClaims(prepared []string, claims []*resourceapi.ResourceClaim, nodeName string) []string {
+	live := sets.New[string]()
+	for _, claim := range claims {
+		if isAllocatedOnNode(claim, nodeName) {
+			live.Insert(string(claim.UID))
+		}
+	}
+
+	var stale []string
+	for _, claimUID := range prepared {
+		if !live.Has(claimUID) {
+			stale = append(stale, claimUID)
+		}
+	}
+	return stale
+}
+
+func isAllocatedOnNode(claim *resourceapi.ResourceClaim, nodeName string) bool {
+	if claim.Status.Allocation == nil {
+		return false
+	}
+	for _, result := range claim.Status.Allocation.Devices.Results {
+		if result.Driver == config.DriverName && result.Pool == nodeName {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	resourceapi "k8s.io/api/resource/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/Tal-or/dra-cpu-driver/pkg/config"
+)
+
+func TestStaleClaims(t *testing.T) {
+	newClaim := func(uid types.UID, driver, pool string) *resourceapi.ResourceClaim {
+		claim := &resourceapi.ResourceClaim{
+			ObjectMeta: metav1.ObjectMeta{UID: uid},
+		}
+		if pool != "" {
+			claim.Status.Allocation = &resourceapi.AllocationResult{
+				Devices: resourceapi.DeviceAllocationResult{
+					Results: []resourceapi.DeviceRequestAllocationResult{
+						{Request: "cpus", Driver: driver, Pool: pool, Device: "cpu-0"},
+					},
+				},
+			}
+		}
+		return claim
+	}
+
+	tests := map[string]struct {
+		prepared []string
+		claims   []*resourceapi.ResourceClaim
+		expected []string
+	}{
+		"allocated on this node": {
+			prepared: []string{"uid-0"},
+			claims:   []*resourceapi.ResourceClaim{newClaim("uid-0", config.DriverName, "node-0")},
+		},
+		"claim deleted": {
+			prepared: []string{"uid-0", "uid-1"},
+			claims:   []*resourceapi.ResourceClaim{newClaim("uid-1", config.DriverName, "node-0")},
+			expected: []string{"uid-0"},
+		},
+		"claim deallocated": {
+			prepared: []string{"uid-0"},
+			claims:   []*resourceapi.ResourceClaim{newClaim("uid-0", "", "")},
+			expected: []string{"uid-0"},
+		},
+		"claim allocated on another node": {
+			prepared: []string{"uid-0"},
+			claims:   []*resourceapi.ResourceClaim{newClaim("uid-0", config.DriverName, "node-1")},
+			expected: []string{"uid-0"},
+		},
+		"claim allocated by another driver": {
+			prepared: []string{"uid-0"},
+			claims:   []*resourceapi.ResourceClaim{newClaim("uid-0", "gpu.example.com", "node-0")},
+			expected: []string{"uid-0"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.expected, staleClaims(test.prepared, test.claims, "node-0"))
+		})
+	}
+}
+
+func TestCollectGarbageBeforeSync(t *testing.T) {
+	// Neither a client nor a state is set: until the claim cache is synced,
+	// nothing must be looked up or unprepared.
+	tests := map[string]struct {
+		synced func() bool
+	}{
+		"informer not started": {},
+		"informer not synced": {
+			synced: func() bool { return false },
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := &Driver{claimCacheSynced: test.synced}
+			assert.NoError(t, d.collectGarbage(context.Background(), "node-0"))
+		})
+	}
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+
+	"k8s.io/klog/v2"
+)
+
+// configMapDataDir is the symlink that kubelet atomically swaps when a
+// mounted ConfigMap is updated.
+const configMapDataDir = "..data"
+
+// WatchConfigFile reloads the CPU pools whenever the configuration file
+// changes, until ctx is done. The parent directory is watched rather than the
+// file itself so that atomic replacements, as done for mounted ConfigMaps,
+// are noticed too.
+func (d *Driver) WatchConfigFile(ctx context.Context, path string) error {
+	return watchConfigFile(ctx, path, d.Reload)
+}
+
+func watchConfigFile(ctx context.Context, path string, reload func(context.Context) error) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("unable to create config file watcher: %w", err)
+	}
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return fmt.Errorf("unable to watch config file %s: %w", path, err)
+	}
+
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				name := filepath.Base(event.Name)
+				if name != filepath.Base(path) && name != configMapDataDir {
+					continue
+				}
+				if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) {
+					continue
+				}
+				klog.Infof("Config file %s changed, reloading CPU pools", path)
+				if err := reload(ctx); err != nil {
+					klog.Errorf("Unable to reload CPU pools: %v", err)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				klog.Errorf("Error watching config file %s: %v", path, err)
+			}
+		}
+	}()
+
+	return nil
+}
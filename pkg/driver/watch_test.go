@@ -0,0 +1,103 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package driver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Tal-or/dra-cpu-driver/pkg/config"
+)
+
+func TestWatchConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte("pools: []\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// The reload only loads the config, as the CPU pools are loaded by the
+	// device state.
+	reloads := make(chan error, 16)
+	err := watchConfigFile(ctx, path, func(context.Context) error {
+		_, err := config.LoadDriverConfig(path)
+		reloads <- err
+		return err
+	})
+	assert.NoError(t, err)
+
+	// expectReload waits for a reload, and for the events of the same change
+	// to settle, and returns the error of the last reload.
+	expectReload := func(msg string) error {
+		t.Helper()
+		var err error
+		select {
+		case err = <-reloads:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no reload: %s", msg)
+		}
+		time.Sleep(100 * time.Millisecond)
+		for len(reloads) > 0 {
+			err = <-reloads
+		}
+		return err
+	}
+	expectNoReload := func(msg string) {
+		t.Helper()
+		select {
+		case <-reloads:
+			t.Fatalf("unexpected reload: %s", msg)
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("pools: [{name: reserved, cpus: \"0\"}]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, expectReload("config file rewritten"))
+
+	if err := os.WriteFile(filepath.Join(dir, "other.yaml"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expectNoReload("another file written")
+
+	// Mounted ConfigMaps are updated by swapping the ..data symlink.
+	if err := os.Symlink(dir, filepath.Join(dir, configMapDataDir)); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, expectReload("ConfigMap updated"))
+
+	// An invalid config is rejected, without stopping the watch.
+	if err := os.WriteFile(path, []byte("pools: [\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	assert.Error(t, expectReload("invalid config written"))
+
+	cancel()
+	time.Sleep(100 * time.Millisecond)
+	if err := os.WriteFile(path, []byte("pools: []\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expectNoReload("watch stopped")
+}
@@ -0,0 +1,358 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package housekeeping
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/cpuset"
+
+	"github.com/Tal-or/dra-cpu-driver/pkg/topology"
+)
+
+// Types of the settings changed to isolate CPUs from housekeeping work.
+const (
+	// WorkqueueCPUMask is the set of CPUs unbound workqueues may run on.
+	WorkqueueCPUMask = "workqueueCpumask"
+	// KThreadAffinity is the affinity of a kernel thread.
+	KThreadAffinity = "kthreadAffinity"
+)
+
+const (
+	workqueueCPUMaskFile = "devices/virtual/workqueue/cpumask"
+
+	// Process flags found in /proc/<pid>/stat.
+	pfKThread       = 0x00200000
+	pfNoSetAffinity = 0x04000000
+)
+
+// Setting is a housekeeping setting as it was before any CPU was isolated.
+type Setting struct {
+	Type string
+	// Path is the workqueue cpumask file, or the procfs directory of a
+	// kernel thread.
+	Path     string
+	Original string
+}
+
+// Manager moves the housekeeping work of the kernel, i.e. unbound workqueues
+// and the kernel threads that may be moved, such as the RCU callback
+// offloading threads, onto the housekeeping CPUs while at least one claim
+// requests it. The settings are restored when the last such claim is gone.
+type Manager struct {
+	sysfsRoot  string
+	procfsRoot string
+	// dryRun only logs the changes that would be made.
+	dryRun bool
+	// setAffinity sets the affinity of a thread.
+	setAffinity func(pid int, cpus cpuset.CPUSet) error
+
+	mutex sync.Mutex
+	// claims are the claims the housekeeping work is isolated for.
+	claims map[string]struct{}
+	// original are the settings to restore once no claim is left.
+	original []Setting
+}
+
+// NewManager returns a manager changing the settings found under sysfsRoot
+// and procfsRoot (normally /sys and /proc).
+func NewManager(sysfsRoot, procfsRoot string, dryRun bool) *Manager {
+	return &Manager{
+		sysfsRoot:   sysfsRoot,
+		procfsRoot:  procfsRoot,
+		dryRun:      dryRun,
+		setAffinity: schedSetAffinity,
+		claims:      make(map[string]struct{}),
+	}
+}
+
+// Settings returns the settings to record for a claim about to isolate CPUs,
+// so that they can be restored even after a restart. They are read from the
+// node unless CPUs are already isolated, in which case the settings found
+// before the first claim are returned. Kernel threads already confined to
+// the housekeeping CPUs are left out.
+func (m *Manager) Settings(housekeeping cpuset.CPUSet) ([]Setting, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if len(m.claims) > 0 {
+		return slices.Clone(m.original), nil
+	}
+
+	path := filepath.Join(m.sysfsRoot, workqueueCPUMaskFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read workqueue cpumask: %w", err)
+	}
+	settings := []Setting{{Type: WorkqueueCPUMask, Path: path, Original: strings.TrimSpace(string(data))}}
+
+	kthreads, err := m.movableKThreads()
+	if err != nil {
+		return nil, err
+	}
+	for _, pid := range kthreads {
+		affinity, err := m.affinity(pid)
+		if errors.Is(err, os.ErrNotExist) {
+			// The thread exited since the threads were listed.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if affinity.IsSubsetOf(housekeeping) {
+			continue
+		}
+		settings = append(settings, Setting{Type: KThreadAffinity, Path: m.kthreadPath(pid), Original: affinity.String()})
+	}
+	return settings, nil
+}
+
+// Acquire isolates CPUs for a claim. The housekeeping work is moved onto the
+// housekeeping CPUs when the claim is the first one, the settings must then
+// be the ones just returned by Settings.
+func (m *Manager) Acquire(claimUID string, settings []Setting, housekeeping cpuset.CPUSet) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if len(m.claims) > 0 {
+		m.claims[claimUID] = struct{}{}
+		return nil
+	}
+
+	// Register the claim first, so that releasing it restores the settings
+	// even if they were only partly changed.
+	m.claims[claimUID] = struct{}{}
+	m.original = settings
+
+	for _, setting := range settings {
+		switch setting.Type {
+		case WorkqueueCPUMask:
+			if err := m.writeWorkqueueCPUMask(setting.Path, housekeeping); err != nil {
+				return err
+			}
+		case KThreadAffinity:
+			original, err := cpuset.Parse(setting.Original)
+			if err != nil {
+				return fmt.Errorf("invalid affinity %q of %s: %v", setting.Original, setting.Path, err)
+			}
+			// Threads bound to some CPUs, e.g. of a NUMA node, are
+			// kept on the housekeeping CPUs among them if any.
+			cpus := original.Intersection(housekeeping)
+			if cpus.IsEmpty() {
+				cpus = housekeeping
+			}
+			if err := m.setKThreadAffinity(setting.Path, cpus); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Release ends the isolation of CPUs for a claim, and restores the settings
+// found before the first claim when it was the last one.
+func (m *Manager) Release(claimUID string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, exists := m.claims[claimUID]; !exists {
+		return nil
+	}
+	if len(m.claims) > 1 {
+		delete(m.claims, claimUID)
+		return nil
+	}
+
+	for _, setting := range slices.Backward(m.original) {
+		switch setting.Type {
+		case WorkqueueCPUMask:
+			original, err := topology.ParseCPUMask(setting.Original)
+			if err != nil {
+				return fmt.Errorf("invalid cpumask %q of %s: %v", setting.Original, setting.Path, err)
+			}
+			if err := m.writeWorkqueueCPUMask(setting.Path, original); err != nil {
+				return err
+			}
+		case KThreadAffinity:
+			original, err := cpuset.Parse(setting.Original)
+			if err != nil {
+				return fmt.Errorf("invalid affinity %q of %s: %v", setting.Original, setting.Path, err)
+			}
+			if err := m.setKThreadAffinity(setting.Path, original); err != nil {
+				return err
+			}
+		}
+	}
+
+	delete(m.claims, claimUID)
+	m.original = nil
+	return nil
+}
+
+// Adopt records that CPUs are isolated for a claim prepared before the
+// driver restarted, with the settings recorded for it.
+func (m *Manager) Adopt(claimUID string, settings []Setting) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if len(m.claims) == 0 {
+		m.original = settings
+	}
+	m.claims[claimUID] = struct{}{}
+}
+
+func (m *Manager) writeWorkqueueCPUMask(path string, cpus cpuset.CPUSet) error {
+	if m.dryRun {
+		klog.Infof("Dry run: would set the workqueue cpumask to %s", cpus)
+		return nil
+	}
+	if err := os.WriteFile(path, []byte(topology.FormatCPUMask(cpus)), 0644); err != nil {
+		return fmt.Errorf("unable to set workqueue cpumask: %w", err)
+	}
+	return nil
+}
+
+// setKThreadAffinity sets the affinity of a kernel thread. Threads that
+// exited, or whose PID was reused by another process, are skipped.
+func (m *Manager) setKThreadAffinity(path string, cpus cpuset.CPUSet) error {
+	pid, err := strconv.Atoi(filepath.Base(path))
+	if err != nil {
+		return fmt.Errorf("invalid kernel thread %s", path)
+	}
+	flags, err := m.flags(pid)
+	if errors.Is(err, os.ErrNotExist) {
+		klog.V(4).Infof("Kernel thread %d is gone, skipping it", pid)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if flags&pfKThread == 0 {
+		klog.V(4).Infof("PID %d is no longer a kernel thread, skipping it", pid)
+		return nil
+	}
+
+	if m.dryRun {
+		klog.Infof("Dry run: would set the affinity of kernel thread %d to %s", pid, cpus)
+		return nil
+	}
+	err = m.setAffinity(pid, cpus)
+	if errors.Is(err, unix.ESRCH) {
+		klog.V(4).Infof("Kernel thread %d is gone, skipping it", pid)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to set affinity of kernel thread %d: %w", pid, err)
+	}
+	return nil
+}
+
+// movableKThreads returns the kernel threads whose affinity may be changed,
+// i.e. all of them but the per-CPU ones.
+func (m *Manager) movableKThreads() ([]int, error) {
+	entries, err := os.ReadDir(m.procfsRoot)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list processes: %w", err)
+	}
+
+	var pids []int
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		flags, err := m.flags(pid)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if flags&pfKThread != 0 && flags&pfNoSetAffinity == 0 {
+			pids = append(pids, pid)
+		}
+	}
+	slices.Sort(pids)
+	return pids, nil
+}
+
+func (m *Manager) kthreadPath(pid int) string {
+	return filepath.Join(m.procfsRoot, strconv.Itoa(pid))
+}
+
+// flags returns the process flags of a thread.
+func (m *Manager) flags(pid int) (uint64, error) {
+	data, err := os.ReadFile(filepath.Join(m.kthreadPath(pid), "stat"))
+	if err != nil {
+		return 0, err
+	}
+	// The command name may contain spaces and parentheses, the fields
+	// following it start after the last parenthesis: state, ppid, pgrp,
+	// session, tty_nr, tpgid, flags.
+	stat := string(data)
+	fields := strings.Fields(stat[strings.LastIndexByte(stat, ')')+1:])
+	if len(fields) < 7 {
+		return 0, fmt.Errorf("invalid stat of thread %d: %q", pid, stat)
+	}
+	flags, err := strconv.ParseUint(fields[6], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid flags of thread %d: %v", pid, err)
+	}
+	return flags, nil
+}
+
+// affinity returns the CPUs a thread may run on.
+func (m *Manager) affinity(pid int) (cpuset.CPUSet, error) {
+	file, err := os.Open(filepath.Join(m.kthreadPath(pid), "status"))
+	if err != nil {
+		return cpuset.New(), err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if list, found := strings.CutPrefix(scanner.Text(), "Cpus_allowed_list:"); found {
+			cpus, err := cpuset.Parse(strings.TrimSpace(list))
+			if err != nil {
+				return cpuset.New(), fmt.Errorf("invalid affinity of thread %d: %v", pid, err)
+			}
+			return cpus, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return cpuset.New(), err
+	}
+	return cpuset.New(), fmt.Errorf("no affinity found for thread %d", pid)
+}
+
+func schedSetAffinity(pid int, cpus cpuset.CPUSet) error {
+	var set unix.CPUSet
+	for _, cpu := range cpus.List() {
+		set.Set(cpu)
+	}
+	return unix.SchedSetaffinity(pid, &set)
+}
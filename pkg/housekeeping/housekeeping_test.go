@@ -0,0 +1,181 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package housekeeping
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/utils/cpuset"
+)
+
+// fakeThread is the fixture description of a thread in the fake procfs.
+type fakeThread struct {
+	comm     string
+	flags    uint64
+	affinity string
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestManager returns a manager working on a fake sysfs and procfs,
+// whose thread affinities are kept in memory.
+func newTestManager(t *testing.T, threads map[int]fakeThread, dryRun bool) (*Manager, map[int]cpuset.CPUSet) {
+	t.Helper()
+	sysfsRoot, procfsRoot := t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(sysfsRoot, workqueueCPUMaskFile), "000000ff")
+
+	affinities := make(map[int]cpuset.CPUSet)
+	for pid, thread := range threads {
+		dir := filepath.Join(procfsRoot, fmt.Sprint(pid))
+		writeFile(t, filepath.Join(dir, "stat"), fmt.Sprintf("%d (%s) S 2 0 0 0 -1 %d 0 0", pid, thread.comm, thread.flags))
+		writeFile(t, filepath.Join(dir, "status"), fmt.Sprintf("Name:\t%s\nCpus_allowed:\tff\nCpus_allowed_list:\t%s", thread.comm, thread.affinity))
+		affinity, err := cpuset.Parse(thread.affinity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		affinities[pid] = affinity
+	}
+	writeFile(t, filepath.Join(procfsRoot, "meminfo"), "")
+
+	m := NewManager(sysfsRoot, procfsRoot, dryRun)
+	m.setAffinity = func(pid int, cpus cpuset.CPUSet) error {
+		affinities[pid] = cpus
+		return nil
+	}
+	return m, affinities
+}
+
+func (m *Manager) workqueueCPUMask(t *testing.T) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(m.sysfsRoot, workqueueCPUMaskFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(data))
+}
+
+var testThreads = map[int]fakeThread{
+	1:  {comm: "systemd", flags: 0x400100, affinity: "0-7"},
+	2:  {comm: "kthreadd", flags: pfKThread, affinity: "0-7"},
+	3:  {comm: "rcuo (s)/0", flags: pfKThread, affinity: "0-7"},
+	4:  {comm: "kswapd1", flags: pfKThread, affinity: "4-7"},
+	5:  {comm: "ksoftirqd/3", flags: pfKThread | pfNoSetAffinity, affinity: "3"},
+	6:  {comm: "kworker/u16:0", flags: pfKThread, affinity: "0-1"},
+	10: {comm: "kcompactd0", flags: pfKThread, affinity: "0-3"},
+}
+
+func TestIsolation(t *testing.T) {
+	housekeeping := cpuset.New(0, 1, 4)
+	m, affinities := newTestManager(t, testThreads, false)
+
+	settings, err := m.Settings(housekeeping)
+	assert.NoError(t, err)
+	assert.Equal(t, []Setting{
+		{Type: WorkqueueCPUMask, Path: filepath.Join(m.sysfsRoot, workqueueCPUMaskFile), Original: "000000ff"},
+		{Type: KThreadAffinity, Path: filepath.Join(m.procfsRoot, "2"), Original: "0-7"},
+		{Type: KThreadAffinity, Path: filepath.Join(m.procfsRoot, "3"), Original: "0-7"},
+		{Type: KThreadAffinity, Path: filepath.Join(m.procfsRoot, "4"), Original: "4-7"},
+		{Type: KThreadAffinity, Path: filepath.Join(m.procfsRoot, "10"), Original: "0-3"},
+	}, settings)
+
+	assert.NoError(t, m.Acquire("uid-0", settings, housekeeping))
+	assert.Equal(t, "00000013", m.workqueueCPUMask(t))
+	assert.Equal(t, map[int]cpuset.CPUSet{
+		1:  cpuset.New(0, 1, 2, 3, 4, 5, 6, 7),
+		2:  cpuset.New(0, 1, 4),
+		3:  cpuset.New(0, 1, 4),
+		4:  cpuset.New(4),
+		5:  cpuset.New(3),
+		6:  cpuset.New(0, 1),
+		10: cpuset.New(0, 1),
+	}, affinities)
+
+	// A second claim gets the settings found before the first one.
+	second, err := m.Settings(housekeeping)
+	assert.NoError(t, err)
+	assert.Equal(t, settings, second)
+	assert.NoError(t, m.Acquire("uid-1", second, housekeeping))
+
+	// Nothing is restored until the last claim is released.
+	assert.NoError(t, m.Release("uid-0"))
+	assert.Equal(t, "00000013", m.workqueueCPUMask(t))
+	assert.Equal(t, cpuset.New(0, 1, 4), affinities[2])
+
+	assert.NoError(t, m.Release("uid-1"))
+	assert.Equal(t, "000000ff", m.workqueueCPUMask(t))
+	assert.Equal(t, map[int]cpuset.CPUSet{
+		1:  cpuset.New(0, 1, 2, 3, 4, 5, 6, 7),
+		2:  cpuset.New(0, 1, 2, 3, 4, 5, 6, 7),
+		3:  cpuset.New(0, 1, 2, 3, 4, 5, 6, 7),
+		4:  cpuset.New(4, 5, 6, 7),
+		5:  cpuset.New(3),
+		6:  cpuset.New(0, 1),
+		10: cpuset.New(0, 1, 2, 3),
+	}, affinities)
+
+	// Releasing an unknown claim changes nothing.
+	assert.NoError(t, m.Release("uid-2"))
+}
+
+func TestAdopt(t *testing.T) {
+	housekeeping := cpuset.New(0, 1, 4)
+	m, _ := newTestManager(t, testThreads, false)
+	settings, err := m.Settings(housekeeping)
+	assert.NoError(t, err)
+	assert.NoError(t, m.Acquire("uid-0", settings, housekeeping))
+	assert.NoError(t, m.Acquire("uid-1", settings, housekeeping))
+
+	// After a restart, the claims found in the checkpoint are adopted.
+	restarted, affinities := newTestManager(t, testThreads, false)
+	restarted.sysfsRoot, restarted.procfsRoot = m.sysfsRoot, m.procfsRoot
+	restarted.Adopt("uid-0", settings)
+	restarted.Adopt("uid-1", settings)
+
+	assert.NoError(t, restarted.Release("uid-1"))
+	assert.Equal(t, "00000013", restarted.workqueueCPUMask(t))
+	assert.NoError(t, restarted.Release("uid-0"))
+	assert.Equal(t, "000000ff", restarted.workqueueCPUMask(t))
+	assert.Equal(t, cpuset.New(0, 1, 2, 3, 4, 5, 6, 7), affinities[3])
+}
+
+func TestDryRun(t *testing.T) {
+	housekeeping := cpuset.New(0, 1, 4)
+	m, affinities := newTestManager(t, testThreads, true)
+
+	settings, err := m.Settings(housekeeping)
+	assert.NoError(t, err)
+	assert.NoError(t, m.Acquire("uid-0", settings, housekeeping))
+	assert.Equal(t, "000000ff", m.workqueueCPUMask(t))
+	assert.Equal(t, cpuset.New(0, 1, 2, 3, 4, 5, 6, 7), affinities[2])
+
+	assert.NoError(t, m.Release("uid-0"))
+	assert.Equal(t, "000000ff", m.workqueueCPUMask(t))
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package irq
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"k8s.io/utils/cpuset"
+
+	"github.com/Tal-or/dra-cpu-driver/pkg/topology"
+)
+
+const (
+	irqDir = "irq"
+	// defaultAffinityFile holds the affinity given to new IRQs. There is no
+	// list form of it, only a hexadecimal mask.
+	defaultAffinityFile = "default_smp_affinity"
+	affinityListFile    = "smp_affinity_list"
+)
+
+// AffinityFile is a procfs file holding the CPU affinity of an IRQ, or the
+// default affinity of new IRQs.
+type AffinityFile struct {
+	Path string
+	// Mask tells whether the file holds a hexadecimal mask, such as
+	// "ff,00000000", rather than a CPU list.
+	Mask bool
+}
+
+// DefaultAffinity returns the file holding the affinity of new IRQs under
+// procfsRoot (normally /proc).
+func DefaultAffinity(procfsRoot string) AffinityFile {
+	return AffinityFile{Path: filepath.Join(procfsRoot, irqDir, defaultAffinityFile), Mask: true}
+}
+
+// Affinities returns the affinity files of all the IRQs found under
+// procfsRoot (normally /proc), sorted by IRQ number.
+func Affinities(procfsRoot string) ([]AffinityFile, error) {
+	entries, err := os.ReadDir(filepath.Join(procfsRoot, irqDir))
+	if err != nil {
+		return nil, fmt.Errorf("unable to list IRQs: %w", err)
+	}
+
+	var irqs []int
+	for _, entry := range entries {
+		irq, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		irqs = append(irqs, irq)
+	}
+	slices.Sort(irqs)
+
+	files := make([]AffinityFile, 0, len(irqs))
+	for _, irq := range irqs {
+		files = append(files, AffinityFile{Path: filepath.Join(procfsRoot, irqDir, strconv.Itoa(irq), affinityListFile)})
+	}
+	return files, nil
+}
+
+// Read returns the content of the file, as it must be written back to
+// restore it, and the CPUs it holds.
+func (f AffinityFile) Read() (string, cpuset.CPUSet, error) {
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+		return "", cpuset.New(), err
+	}
+	content := strings.TrimSpace(string(data))
+	cpus, err := f.Parse(content)
+	if err != nil {
+		return "", cpuset.New(), err
+	}
+	return content, cpus, nil
+}
+
+// Parse returns the CPUs of content read from the file.
+func (f AffinityFile) Parse(content string) (cpuset.CPUSet, error) {
+	if f.Mask {
+		return topology.ParseCPUMask(content)
+	}
+	cpus, err := cpuset.Parse(content)
+	if err != nil {
+		return cpuset.New(), fmt.Errorf("invalid CPU list %q in %s: %w", content, f.Path, err)
+	}
+	return cpus, nil
+}
+
+// Write sets the affinity to cpus.
+func (f AffinityFile) Write(cpus cpuset.CPUSet) error {
+	content := cpus.String()
+	if f.Mask {
+		content = topology.FormatCPUMask(cpus)
+	}
+	return os.WriteFile(f.Path, []byte(content), 0644)
+}
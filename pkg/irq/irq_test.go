@@ -0,0 +1,70 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package irq
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/utils/cpuset"
+)
+
+func TestAffinities(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"irq/10", "irq/2", "irq/not-an-irq"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "irq/2/smp_affinity_list"), []byte("0-3,8\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "irq/default_smp_affinity"), []byte("1ff\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := Affinities(root)
+	assert.NoError(t, err)
+	assert.Equal(t, []AffinityFile{
+		{Path: filepath.Join(root, "irq/2/smp_affinity_list")},
+		{Path: filepath.Join(root, "irq/10/smp_affinity_list")},
+	}, files)
+
+	content, cpus, err := files[0].Read()
+	assert.NoError(t, err)
+	assert.Equal(t, "0-3,8", content)
+	assert.Equal(t, cpuset.New(0, 1, 2, 3, 8), cpus)
+
+	assert.NoError(t, files[0].Write(cpuset.New(1, 8)))
+	_, cpus, err = files[0].Read()
+	assert.NoError(t, err)
+	assert.Equal(t, cpuset.New(1, 8), cpus)
+
+	defaultAffinity := DefaultAffinity(root)
+	content, cpus, err = defaultAffinity.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, "1ff", content)
+	assert.Equal(t, cpuset.New(0, 1, 2, 3, 4, 5, 6, 7, 8), cpus)
+
+	assert.NoError(t, defaultAffinity.Write(cpuset.New(8)))
+	content, _, err = defaultAffinity.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, "00000100", content)
+}
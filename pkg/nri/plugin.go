@@ -0,0 +1,180 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nri
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+
+	"k8s.io/utils/cpuset"
+)
+
+const (
+	// PluginName is the name under which the plugin registers with the
+	// container runtime.
+	PluginName = "dra-cpu-driver"
+	// PluginIndex orders the plugin among the other NRI plugins. It runs
+	// late so that its cpusets take precedence.
+	PluginIndex = "90"
+)
+
+// CPUResolver finds the CPUs a container of a pod must be pinned to, and the
+// CPU partition it must be created in, from the environment injected by the
+// CDI devices of its claims. It is implemented by state.DeviceState.
+type CPUResolver interface {
+	ContainerCPUs(podUID string, env []string) (cpuset.CPUSet, cpuset.CPUSet, error)
+	ContainerPartition(podUID string, env []string) (string, error)
+}
+
+// Plugin pins containers using CPUs prepared by the driver by setting
+// their cpuset.cpus and cpuset.mems when they are created or updated. It
+// keeps track of the running containers so that their cpusets can be
+// updated when the dynamic shared pool changes.
+type Plugin struct {
+	resolver CPUResolver
+
+	sync.Mutex
+	containers map[string]*container
+	changed    chan struct{}
+}
+
+// Cpuset is the cpuset cgroup configuration of a container.
+type Cpuset struct {
+	CPUs string
+	Mems string
+}
+
+type container struct {
+	podUID string
+	env    []string
+	// cpuset is the last cpuset applied to the container, nil if the
+	// container is not pinned by the plugin.
+	cpuset *Cpuset
+}
+
+func NewPlugin(resolver CPUResolver) *Plugin {
+	return &Plugin{
+		resolver:   resolver,
+		containers: make(map[string]*container),
+		changed:    make(chan struct{}, 1),
+	}
+}
+
+// TrackContainer records a running container of the pod with the given UID
+// and returns the cpuset to apply to it, or nil if the container must be left
+// alone.
+func (p *Plugin) TrackContainer(id, podUID string, env []string) (*Cpuset, error) {
+	cpuset, err := p.containerCpuset(podUID, env)
+	if err != nil {
+		return nil, err
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	p.containers[id] = &container{
+		podUID: podUID,
+		env:    env,
+		cpuset: cpuset,
+	}
+	return cpuset, nil
+}
+
+// ContainerCgroupsPath returns the cgroups path a container of the pod with
+// the given UID must be created with instead of cgroupsPath, or an empty
+// string when it must be left where the runtime puts it. Containers using
+// the CPUs of a CPU partition are moved into it, as no other cgroup can use
+// them. Only the root is a partition, so the partition cannot be a child of
+// the pod cgroup: a moved container leaves its pod cgroup, whose limits,
+// stats and eviction accounting no longer apply to it. Partitions only exist
+// when they are enabled with --cpu-partitions.
+func (p *Plugin) ContainerCgroupsPath(podUID string, env []string, cgroupsPath string) (string, error) {
+	partition, err := p.resolver.ContainerPartition(podUID, env)
+	if err != nil || partition == "" {
+		return "", err
+	}
+	// The systemd cgroup driver names the cgroups of containers after a
+	// slice, e.g. "kubepods.slice:cri-containerd:<id>", which cannot be
+	// put under a partition.
+	if strings.Contains(cgroupsPath, ":") {
+		return "", fmt.Errorf("cgroups path %s cannot be moved into CPU partition %s, which requires the cgroupfs cgroup driver", cgroupsPath, partition)
+	}
+	return path.Join(partition, path.Base(cgroupsPath)), nil
+}
+
+// RemoveContainer forgets about a container that is gone.
+func (p *Plugin) RemoveContainer(id string) {
+	p.Lock()
+	defer p.Unlock()
+	delete(p.containers, id)
+}
+
+// SharedPoolChanged signals that the cpusets of the running containers must
+// be recomputed. It never blocks.
+func (p *Plugin) SharedPoolChanged() {
+	select {
+	case p.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Changed is signalled after SharedPoolChanged was called.
+func (p *Plugin) Changed() <-chan struct{} {
+	return p.changed
+}
+
+// Updates recomputes the cpusets of the containers pinned by the plugin and
+// returns the ones that changed, indexed by container ID.
+func (p *Plugin) Updates() (map[string]*Cpuset, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	updates := make(map[string]*Cpuset)
+	var errs []error
+	for id, c := range p.containers {
+		if c.cpuset == nil {
+			continue
+		}
+		cpuset, err := p.containerCpuset(c.podUID, c.env)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("container %s: %w", id, err))
+			continue
+		}
+		if cpuset == nil || *cpuset == *c.cpuset {
+			continue
+		}
+		c.cpuset = cpuset
+		updates[id] = cpuset
+	}
+	return updates, errors.Join(errs...)
+}
+
+func (p *Plugin) containerCpuset(podUID string, env []string) (*Cpuset, error) {
+	cpus, mems, err := p.resolver.ContainerCPUs(podUID, env)
+	if err != nil {
+		return nil, err
+	}
+	if cpus.IsEmpty() {
+		return nil, nil
+	}
+	return &Cpuset{
+		CPUs: cpus.String(),
+		Mems: mems.String(),
+	}, nil
+}
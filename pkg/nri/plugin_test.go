@@ -0,0 +1,158 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nri
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/utils/cpuset"
+)
+
+// fakeResolver pins containers of pod-uid-0 whose environment contains
+// CLAIM=<name> to the CPUs of that claim, and creates them in the partition
+// of the claim if it has one.
+type fakeResolver struct {
+	claims     map[string]cpuset.CPUSet
+	partitions map[string]string
+}
+
+func (r *fakeResolver) ContainerCPUs(podUID string, env []string) (cpuset.CPUSet, cpuset.CPUSet, error) {
+	cpus := cpuset.New()
+	for name, claimCPUs := range r.claims {
+		if slices.Contains(env, "CLAIM="+name) {
+			if podUID != "pod-uid-0" {
+				return cpuset.New(), cpuset.New(), fmt.Errorf("claim %s is not prepared for pod %s", name, podUID)
+			}
+			cpus = cpus.Union(claimCPUs)
+		}
+	}
+	if slices.Contains(env, "CLAIM=broken") {
+		return cpus, cpus, fmt.Errorf("broken claim")
+	}
+	return cpus, cpuset.New(0), nil
+}
+
+func (r *fakeResolver) ContainerPartition(podUID string, env []string) (string, error) {
+	for name, partition := range r.partitions {
+		if slices.Contains(env, "CLAIM="+name) {
+			return partition, nil
+		}
+	}
+	return "", nil
+}
+
+func TestPluginUpdates(t *testing.T) {
+	resolver := &fakeResolver{
+		claims: map[string]cpuset.CPUSet{
+			"exclusive": cpuset.New(2),
+			"shared":    cpuset.New(1, 3),
+		},
+	}
+	plugin := NewPlugin(resolver)
+
+	cpuset0, err := plugin.TrackContainer("ctr-0", "pod-uid-0", []string{"CLAIM=exclusive"})
+	assert.NoError(t, err)
+	assert.Equal(t, &Cpuset{CPUs: "2", Mems: "0"}, cpuset0)
+
+	cpuset1, err := plugin.TrackContainer("ctr-1", "pod-uid-0", []string{"CLAIM=shared"})
+	assert.NoError(t, err)
+	assert.Equal(t, &Cpuset{CPUs: "1,3", Mems: "0"}, cpuset1)
+
+	cpuset2, err := plugin.TrackContainer("ctr-2", "pod-uid-0", []string{"PATH=/bin"})
+	assert.NoError(t, err)
+	assert.Nil(t, cpuset2)
+
+	_, err = plugin.TrackContainer("ctr-3", "pod-uid-0", []string{"CLAIM=broken"})
+	assert.Error(t, err)
+
+	// Claims are only honoured for the pods they were prepared for.
+	_, err = plugin.TrackContainer("ctr-4", "pod-uid-1", []string{"CLAIM=exclusive"})
+	assert.Error(t, err)
+
+	// Nothing changed yet.
+	updates, err := plugin.Updates()
+	assert.NoError(t, err)
+	assert.Empty(t, updates)
+
+	// The shared pool grows, only its container is updated.
+	resolver.claims["shared"] = cpuset.New(1, 3, 4)
+	plugin.SharedPoolChanged()
+	plugin.SharedPoolChanged()
+	<-plugin.Changed()
+	select {
+	case <-plugin.Changed():
+		t.Fatal("changes should be coalesced")
+	default:
+	}
+	updates, err = plugin.Updates()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]*Cpuset{"ctr-1": {CPUs: "1,3-4", Mems: "0"}}, updates)
+
+	// Removed containers are not updated anymore.
+	plugin.RemoveContainer("ctr-1")
+	resolver.claims["shared"] = cpuset.New(1)
+	updates, err = plugin.Updates()
+	assert.NoError(t, err)
+	assert.Empty(t, updates)
+}
+
+func TestContainerCgroupsPath(t *testing.T) {
+	tests := map[string]struct {
+		env         []string
+		cgroupsPath string
+		expected    string
+		expectErr   bool
+	}{
+		"no partition": {
+			env:         []string{"CLAIM=shared"},
+			cgroupsPath: "/kubepods/pod-uid-0/ctr-0",
+		},
+		"moved into the partition": {
+			env:         []string{"CLAIM=partitioned"},
+			cgroupsPath: "/kubepods/pod-uid-0/ctr-0",
+			expected:    "/dra-cpu-uid-0/ctr-0",
+		},
+		"systemd cgroup driver": {
+			env:         []string{"CLAIM=partitioned"},
+			cgroupsPath: "kubepods-pod_uid_0.slice:cri-containerd:ctr-0",
+			expectErr:   true,
+		},
+	}
+
+	plugin := NewPlugin(&fakeResolver{
+		claims: map[string]cpuset.CPUSet{
+			"partitioned": cpuset.New(2),
+			"shared":      cpuset.New(1, 3),
+		},
+		partitions: map[string]string{"partitioned": "/dra-cpu-uid-0"},
+	})
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cgroupsPath, err := plugin.ContainerCgroupsPath("pod-uid-0", test.env, test.cgroupsPath)
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, cgroupsPath)
+		})
+	}
+}
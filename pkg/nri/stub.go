@@ -0,0 +1,181 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nri
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/containerd/nri/pkg/stub"
+	"k8s.io/klog/v2"
+)
+
+// reconnectInterval is the delay before connecting again to a runtime that
+// closed the connection, e.g. because it restarted.
+const reconnectInterval = 5 * time.Second
+
+// stubPlugin connects the plugin to the container runtime through the NRI
+// stub library.
+type stubPlugin struct {
+	plugin *Plugin
+}
+
+var (
+	_ stub.SynchronizeInterface     = &stubPlugin{}
+	_ stub.CreateContainerInterface = &stubPlugin{}
+	_ stub.UpdateContainerInterface = &stubPlugin{}
+	_ stub.RemoveContainerInterface = &stubPlugin{}
+)
+
+// Start registers the plugin with the container runtime listening on
+// socketPath and serves its requests until ctx is cancelled. The connection
+// is re-established whenever the runtime restarts.
+func Start(ctx context.Context, plugin *Plugin, socketPath string) error {
+	p := &stubPlugin{plugin: plugin}
+	logger := klog.FromContext(ctx)
+
+	go func() {
+		for {
+			s, err := stub.New(p,
+				stub.WithPluginName(PluginName),
+				stub.WithPluginIdx(PluginIndex),
+				stub.WithSocketPath(socketPath),
+			)
+			if err != nil {
+				logger.Error(err, "Unable to create NRI plugin")
+				return
+			}
+			runCtx, cancel := context.WithCancel(ctx)
+			go p.pushUpdates(runCtx, s)
+			if err := s.Run(runCtx); err != nil {
+				logger.Error(err, "NRI plugin stopped")
+			}
+			cancel()
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(reconnectInterval):
+			}
+		}
+	}()
+
+	return nil
+}
+
+// pushUpdates sends unsolicited updates to the runtime whenever the cpusets
+// of running containers change.
+func (p *stubPlugin) pushUpdates(ctx context.Context, s stub.Stub) {
+	logger := klog.FromContext(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.plugin.Changed():
+		}
+		cpusets, err := p.plugin.Updates()
+		if err != nil {
+			logger.Error(err, "Unable to compute container cpusets")
+		}
+		if len(cpusets) == 0 {
+			continue
+		}
+		var updates []*api.ContainerUpdate
+		for id, cpuset := range cpusets {
+			updates = append(updates, newContainerUpdate(id, cpuset))
+		}
+		failed, err := s.UpdateContainers(updates)
+		if err != nil {
+			logger.Error(err, "Unable to update container cpusets")
+		}
+		for _, update := range failed {
+			logger.Error(nil, "Unable to update container cpuset", "container", update.ContainerId)
+		}
+	}
+}
+
+// Synchronize pins the containers that were already running when the plugin
+// connected to the runtime.
+func (p *stubPlugin) Synchronize(ctx context.Context, pods []*api.PodSandbox, containers []*api.Container) ([]*api.ContainerUpdate, error) {
+	podUIDs := make(map[string]string)
+	for _, pod := range pods {
+		podUIDs[pod.Id] = pod.Uid
+	}
+
+	var updates []*api.ContainerUpdate
+	for _, ctr := range containers {
+		cpuset, err := p.plugin.TrackContainer(ctr.Id, podUIDs[ctr.PodSandboxId], ctr.Env)
+		if err != nil {
+			klog.FromContext(ctx).Error(err, "Unable to compute container cpuset", "container", ctr.Name)
+			continue
+		}
+		if cpuset != nil {
+			updates = append(updates, newContainerUpdate(ctr.Id, cpuset))
+		}
+	}
+	return updates, nil
+}
+
+func (p *stubPlugin) CreateContainer(ctx context.Context, pod *api.PodSandbox, ctr *api.Container) (*api.ContainerAdjustment, []*api.ContainerUpdate, error) {
+	cpuset, err := p.plugin.TrackContainer(ctr.Id, pod.Uid, ctr.Env)
+	if err != nil {
+		return nil, nil, fmt.Errorf("container %s/%s/%s: %w", pod.Namespace, pod.Name, ctr.Name, err)
+	}
+	if cpuset == nil {
+		return nil, nil, nil
+	}
+	cgroupsPath, err := p.plugin.ContainerCgroupsPath(pod.Uid, ctr.Env, ctr.GetLinux().GetCgroupsPath())
+	if err != nil {
+		return nil, nil, fmt.Errorf("container %s/%s/%s: %w", pod.Namespace, pod.Name, ctr.Name, err)
+	}
+	klog.FromContext(ctx).V(4).Info("Pinning container", "pod", pod.Namespace+"/"+pod.Name, "container", ctr.Name, "cpus", cpuset.CPUs, "mems", cpuset.Mems, "cgroupsPath", cgroupsPath)
+
+	adjustment := &api.ContainerAdjustment{}
+	adjustment.SetLinuxCPUSetCPUs(cpuset.CPUs)
+	adjustment.SetLinuxCPUSetMems(cpuset.Mems)
+	if cgroupsPath != "" {
+		adjustment.SetLinuxCgroupsPath(cgroupsPath)
+	}
+	return adjustment, nil, nil
+}
+
+// UpdateContainer re-applies the cpuset of the container, which would
+// otherwise be overwritten by the CPU manager of the kubelet.
+func (p *stubPlugin) UpdateContainer(ctx context.Context, pod *api.PodSandbox, ctr *api.Container, _ *api.LinuxResources) ([]*api.ContainerUpdate, error) {
+	cpuset, err := p.plugin.TrackContainer(ctr.Id, pod.Uid, ctr.Env)
+	if err != nil {
+		return nil, fmt.Errorf("container %s/%s/%s: %w", pod.Namespace, pod.Name, ctr.Name, err)
+	}
+	if cpuset == nil {
+		return nil, nil
+	}
+	return []*api.ContainerUpdate{newContainerUpdate(ctr.Id, cpuset)}, nil
+}
+
+func (p *stubPlugin) RemoveContainer(ctx context.Context, pod *api.PodSandbox, ctr *api.Container) error {
+	p.plugin.RemoveContainer(ctr.Id)
+	return nil
+}
+
+func newContainerUpdate(id string, cpuset *Cpuset) *api.ContainerUpdate {
+	update := &api.ContainerUpdate{}
+	update.SetContainerId(id)
+	update.SetLinuxCPUSetCPUs(cpuset.CPUs)
+	update.SetLinuxCPUSetMems(cpuset.Mems)
+	return update
+}
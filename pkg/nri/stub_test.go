@@ -0,0 +1,221 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nri
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/containerd/nri/pkg/adaptation"
+	"github.com/containerd/nri/pkg/api"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/cpuset"
+)
+
+// lockedResolver lets the test change the claims while the plugin pushes
+// updates concurrently.
+type lockedResolver struct {
+	sync.Mutex
+	fakeResolver
+}
+
+func (r *lockedResolver) ContainerCPUs(podUID string, env []string) (cpuset.CPUSet, cpuset.CPUSet, error) {
+	r.Lock()
+	defer r.Unlock()
+	return r.fakeResolver.ContainerCPUs(podUID, env)
+}
+
+func (r *lockedResolver) ContainerPartition(podUID string, env []string) (string, error) {
+	r.Lock()
+	defer r.Unlock()
+	return r.fakeResolver.ContainerPartition(podUID, env)
+}
+
+func (r *lockedResolver) set(name string, cpus cpuset.CPUSet) {
+	r.Lock()
+	defer r.Unlock()
+	r.claims[name] = cpus
+}
+
+// startRuntime runs a local NRI runtime on socketPath. The containers are
+// reported as running when a plugin connects, the updates returned by the
+// plugin to the synchronization and its unsolicited updates are sent on the
+// returned channels.
+func startRuntime(t *testing.T, socketPath string, containers []*api.Container) (*adaptation.Adaptation, <-chan []*api.ContainerUpdate, <-chan []*api.ContainerUpdate) {
+	t.Helper()
+	synced := make(chan []*api.ContainerUpdate, 1)
+	updated := make(chan []*api.ContainerUpdate, 1)
+
+	syncFn := func(ctx context.Context, cb adaptation.SyncCB) error {
+		updates, err := cb(ctx, []*api.PodSandbox{newTestPod("pod-0"), newTestPod("pod-1")}, containers)
+		if err != nil {
+			return err
+		}
+		synced <- updates
+		return nil
+	}
+	updateFn := func(_ context.Context, updates []*api.ContainerUpdate) ([]*api.ContainerUpdate, error) {
+		updated <- updates
+		return nil, nil
+	}
+
+	dir := t.TempDir()
+	runtime, err := adaptation.New("test-runtime", "v0.0.0", syncFn, updateFn,
+		adaptation.WithSocketPath(socketPath),
+		adaptation.WithPluginPath(filepath.Join(dir, "plugins")),
+		adaptation.WithPluginConfigPath(filepath.Join(dir, "conf.d")),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := runtime.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(runtime.Stop)
+	// Start synchronizes the pre-installed plugins, there are none.
+	<-synced
+	return runtime, synced, updated
+}
+
+func newTestPod(id string) *api.PodSandbox {
+	return &api.PodSandbox{Id: id, Name: id, Namespace: "default", Uid: "pod-uid-" + strings.TrimPrefix(id, "pod-")}
+}
+
+func newTestContainer(id, podID string, env ...string) *api.Container {
+	return &api.Container{Id: id, PodSandboxId: podID, Name: id, Env: env}
+}
+
+func receive[T any](t *testing.T, c <-chan T) T {
+	t.Helper()
+	select {
+	case v := <-c:
+		return v
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the runtime")
+	}
+	var zero T
+	return zero
+}
+
+// cpusetOf returns the cpuset set by resources, nil if they leave it alone.
+func cpusetOf(resources *api.LinuxResources) *Cpuset {
+	if resources.GetCpu().GetCpus() == "" {
+		return nil
+	}
+	return &Cpuset{CPUs: resources.Cpu.Cpus, Mems: resources.Cpu.Mems}
+}
+
+func TestStubPlugin(t *testing.T) {
+	resolver := &lockedResolver{
+		fakeResolver: fakeResolver{
+			claims: map[string]cpuset.CPUSet{
+				"exclusive":   cpuset.New(2),
+				"shared":      cpuset.New(1, 3),
+				"partitioned": cpuset.New(5),
+			},
+			partitions: map[string]string{"partitioned": "/dra-cpu-uid-0"},
+		},
+	}
+	plugin := NewPlugin(resolver)
+	socketPath := filepath.Join(t.TempDir(), "nri.sock")
+
+	runtime, synced, updated := startRuntime(t, socketPath, []*api.Container{
+		newTestContainer("running-0", "pod-0", "CLAIM=exclusive"),
+		newTestContainer("running-1", "pod-0", "PATH=/bin"),
+		newTestContainer("running-2", "pod-1", "CLAIM=exclusive"),
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := Start(ctx, plugin, socketPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// Synchronize pins the containers that were already running, using the
+	// claims of their own pod only.
+	updates := receive(t, synced)
+	if assert.Len(t, updates, 1) {
+		assert.Equal(t, "running-0", updates[0].ContainerId)
+		assert.Equal(t, &Cpuset{CPUs: "2", Mems: "0"}, cpusetOf(updates[0].Linux.Resources))
+	}
+
+	// CreateContainer pins new containers using claimed CPUs only.
+	pod := newTestPod("pod-0")
+	created, err := runtime.CreateContainer(ctx, &api.CreateContainerRequest{
+		Pod:       pod,
+		Container: newTestContainer("ctr-0", "pod-0", "CLAIM=shared"),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &Cpuset{CPUs: "1,3", Mems: "0"}, cpusetOf(created.GetAdjust().GetLinux().GetResources()))
+
+	created, err = runtime.CreateContainer(ctx, &api.CreateContainerRequest{
+		Pod:       pod,
+		Container: newTestContainer("ctr-1", "pod-0", "PATH=/bin"),
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, cpusetOf(created.GetAdjust().GetLinux().GetResources()))
+
+	_, err = runtime.CreateContainer(ctx, &api.CreateContainerRequest{
+		Pod:       pod,
+		Container: newTestContainer("ctr-2", "pod-0", "CLAIM=broken"),
+	})
+	assert.Error(t, err)
+
+	// Containers using the CPUs of a partition are created inside it.
+	partitioned := newTestContainer("ctr-4", "pod-0", "CLAIM=partitioned")
+	partitioned.Linux = &api.LinuxContainer{CgroupsPath: "/kubepods/pod-uid-0/ctr-4"}
+	created, err = runtime.CreateContainer(ctx, &api.CreateContainerRequest{
+		Pod:       pod,
+		Container: partitioned,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &Cpuset{CPUs: "5", Mems: "0"}, cpusetOf(created.GetAdjust().GetLinux().GetResources()))
+	assert.Equal(t, "/dra-cpu-uid-0/ctr-4", created.GetAdjust().GetLinux().GetCgroupsPath())
+
+	_, err = runtime.CreateContainer(ctx, &api.CreateContainerRequest{
+		Pod:       newTestPod("pod-1"),
+		Container: newTestContainer("ctr-3", "pod-1", "CLAIM=shared"),
+	})
+	assert.Error(t, err)
+
+	// UpdateContainer re-applies the cpuset over the one of the kubelet.
+	updatedContainer, err := runtime.UpdateContainer(ctx, &api.UpdateContainerRequest{
+		Pod:       pod,
+		Container: newTestContainer("ctr-0", "pod-0", "CLAIM=shared"),
+		LinuxResources: &api.LinuxResources{
+			Cpu: &api.LinuxCPU{Cpus: "0-7"},
+		},
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, updatedContainer.GetUpdate(), 1) {
+		assert.Equal(t, "ctr-0", updatedContainer.Update[0].ContainerId)
+		assert.Equal(t, &Cpuset{CPUs: "1,3", Mems: "0"}, cpusetOf(updatedContainer.Update[0].Linux.Resources))
+	}
+
+	// pushUpdates sends the new cpusets when the shared pool changes.
+	resolver.set("shared", cpuset.New(1, 3, 4))
+	plugin.SharedPoolChanged()
+	updates = receive(t, updated)
+	if assert.Len(t, updates, 1) {
+		assert.Equal(t, "ctr-0", updates[0].ContainerId)
+		assert.Equal(t, &Cpuset{CPUs: "1,3-4", Mems: "0"}, cpusetOf(updates[0].Linux.Resources))
+	}
+}
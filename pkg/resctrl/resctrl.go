@@ -0,0 +1,371 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package resctrl
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+	"k8s.io/utils/cpuset"
+)
+
+const (
+	// groupPrefix is the prefix of the names of the groups created by the
+	// driver, which are named after the claim they are created for.
+	groupPrefix = "dra-cpu-"
+
+	infoDir        = "info"
+	lastStatusFile = "last_cmd_status"
+	schemataFile   = "schemata"
+	cpusListFile   = "cpus_list"
+
+	cacheResource     = "L3"
+	bandwidthResource = "MB"
+)
+
+// Info describes the resource control capabilities of the node.
+type Info struct {
+	// CLOSCount is the number of classes of service, i.e. of groups, the
+	// default group included.
+	CLOSCount int
+	// CacheWays is the number of L3 cache ways, zero when L3 cache
+	// allocation is not supported.
+	CacheWays int
+	// MinCacheWays is the minimum number of ways of an allocation.
+	MinCacheWays int
+	// CacheDomains are the ids of the L3 cache domains.
+	CacheDomains []int
+	// MemoryBandwidth tells whether memory bandwidth allocation is
+	// supported.
+	MemoryBandwidth bool
+	// MinBandwidth is the minimum memory bandwidth percentage, which can
+	// only be requested in steps of BandwidthGranularity.
+	MinBandwidth         int
+	BandwidthGranularity int
+	// BandwidthDomains are the ids of the memory bandwidth domains.
+	BandwidthDomains []int
+}
+
+// Discover returns the resource control capabilities found in the resctrl
+// filesystem mounted at root (normally /sys/fs/resctrl), or nil when it is
+// not mounted.
+func Discover(root string) (*Info, error) {
+	if _, err := os.Stat(filepath.Join(root, infoDir)); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	schemata, err := readSchemata(filepath.Join(root, schemataFile))
+	if err != nil {
+		return nil, err
+	}
+
+	info := &Info{}
+	if dir := filepath.Join(root, infoDir, cacheResource); exists(dir) {
+		closCount, err := readInt(filepath.Join(dir, "num_closids"))
+		if err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(filepath.Join(dir, "cbm_mask"))
+		if err != nil {
+			return nil, err
+		}
+		mask, err := strconv.ParseUint(strings.TrimSpace(string(data)), 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid L3 cache bit mask %q: %w", strings.TrimSpace(string(data)), err)
+		}
+		minWays, err := readInt(filepath.Join(dir, "min_cbm_bits"))
+		if err != nil {
+			return nil, err
+		}
+		info.CLOSCount = closCount
+		info.CacheWays = bits.OnesCount64(mask)
+		info.MinCacheWays = minWays
+		info.CacheDomains = domains(schemata[cacheResource])
+	}
+	if dir := filepath.Join(root, infoDir, bandwidthResource); exists(dir) {
+		closCount, err := readInt(filepath.Join(dir, "num_closids"))
+		if err != nil {
+			return nil, err
+		}
+		minBandwidth, err := readInt(filepath.Join(dir, "min_bandwidth"))
+		if err != nil {
+			return nil, err
+		}
+		granularity, err := readInt(filepath.Join(dir, "bandwidth_gran"))
+		if err != nil {
+			return nil, err
+		}
+		// Groups are limited by the resource with the fewest classes.
+		if info.CLOSCount == 0 || closCount < info.CLOSCount {
+			info.CLOSCount = closCount
+		}
+		info.MemoryBandwidth = true
+		info.MinBandwidth = minBandwidth
+		info.BandwidthGranularity = granularity
+		info.BandwidthDomains = domains(schemata[bandwidthResource])
+	}
+	return info, nil
+}
+
+// AllocateCacheWays returns the mask of the highest ways contiguous cache
+// ways not in used. The lowest MinCacheWays ways are never allocated, they
+// are left to the default group.
+func (i *Info) AllocateCacheWays(used uint64, ways int) (uint64, error) {
+	if i.CacheWays == 0 {
+		return 0, fmt.Errorf("L3 cache allocation is not supported")
+	}
+	if ways < i.MinCacheWays || ways > i.CacheWays-i.MinCacheWays {
+		return 0, fmt.Errorf("%d cache ways requested, between %d and %d are supported", ways, i.MinCacheWays, i.CacheWays-i.MinCacheWays)
+	}
+	used |= uint64(1)<<i.MinCacheWays - 1
+	want := uint64(1)<<ways - 1
+	for shift := i.CacheWays - ways; shift >= 0; shift-- {
+		if mask := want << shift; mask&used == 0 {
+			return mask, nil
+		}
+	}
+	return 0, fmt.Errorf("no %d contiguous cache ways left", ways)
+}
+
+// DefaultCacheMask returns the L3 cache ways of the default group when the
+// groups of the driver use the ways in used: the lowest contiguous ways left,
+// as cache bit masks must be contiguous.
+func (i *Info) DefaultCacheMask(used uint64) uint64 {
+	free := (uint64(1)<<i.CacheWays - 1) &^ used
+	lowest := free & -free
+	return free &^ (free + lowest)
+}
+
+// Bandwidth rounds a memory bandwidth percentage up to a value supported by
+// the hardware.
+func (i *Info) Bandwidth(percent int) (int, error) {
+	if !i.MemoryBandwidth {
+		return 0, fmt.Errorf("memory bandwidth allocation is not supported")
+	}
+	granularity := max(i.BandwidthGranularity, 1)
+	bandwidth := (percent + granularity - 1) / granularity * granularity
+	return min(max(bandwidth, i.MinBandwidth), 100), nil
+}
+
+// Schemata returns the schemata of a group given the L3 cache ways of
+// cacheMask and the memory bandwidth percentage on every domain. Zero values
+// leave the resource to its default.
+func (i *Info) Schemata(cacheMask uint64, bandwidth int) []string {
+	var lines []string
+	if cacheMask != 0 {
+		lines = append(lines, schemataLine(cacheResource, i.CacheDomains, strconv.FormatUint(cacheMask, 16)))
+	}
+	if bandwidth != 0 {
+		lines = append(lines, schemataLine(bandwidthResource, i.BandwidthDomains, strconv.Itoa(bandwidth)))
+	}
+	return lines
+}
+
+func schemataLine(resource string, domains []int, value string) string {
+	allocations := make([]string, 0, len(domains))
+	for _, domain := range domains {
+		allocations = append(allocations, fmt.Sprintf("%d=%s", domain, value))
+	}
+	return resource + ":" + strings.Join(allocations, ";")
+}
+
+// GroupPath returns the directory of the group of a claim under root.
+func GroupPath(root, claimUID string) string {
+	return filepath.Join(root, groupPrefix+claimUID)
+}
+
+// UsedCacheWays returns the L3 cache ways given to the groups of the driver
+// under root, but the one at exclude.
+func UsedCacheWays(root, exclude string) (uint64, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return 0, fmt.Errorf("unable to list resctrl groups: %w", err)
+	}
+
+	var used uint64
+	for _, entry := range entries {
+		path := filepath.Join(root, entry.Name())
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), groupPrefix) || path == exclude {
+			continue
+		}
+		schemata, err := readSchemata(filepath.Join(path, schemataFile))
+		if err != nil {
+			return 0, err
+		}
+		for _, value := range schemata[cacheResource] {
+			mask, err := strconv.ParseUint(value, 16, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid L3 cache bit mask %q of resctrl group %s: %w", value, path, err)
+			}
+			used |= mask
+		}
+	}
+	return used, nil
+}
+
+// CreateGroup creates the group at path, or updates it if it exists, and
+// assigns it cpus and schemata.
+func CreateGroup(path string, cpus cpuset.CPUSet, schemata []string) error {
+	if err := os.Mkdir(path, 0755); err != nil && !errors.Is(err, os.ErrExist) {
+		if errors.Is(err, unix.ENOSPC) {
+			return fmt.Errorf("unable to create resctrl group %s: no class of service left", path)
+		}
+		return fmt.Errorf("unable to create resctrl group %s: %w", path, err)
+	}
+	if err := os.WriteFile(filepath.Join(path, cpusListFile), []byte(cpus.String()), 0644); err != nil {
+		return fmt.Errorf("unable to assign CPUs %s to resctrl group %s: %w%s", cpus, path, err, lastStatus(path))
+	}
+	return SetSchemata(path, schemata)
+}
+
+// SetSchemata writes schemata to the group at path, which is the root for
+// the default group. The lines of the resources schemata does not mention
+// are written back unchanged.
+func SetSchemata(path string, schemata []string) error {
+	if len(schemata) == 0 {
+		return nil
+	}
+	file := filepath.Join(path, schemataFile)
+	data, err := os.ReadFile(file)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("unable to read schemata of resctrl group %s: %w", path, err)
+	}
+	lines := slices.Clone(schemata)
+	for _, line := range strings.Split(string(data), "\n") {
+		resource, _, found := strings.Cut(strings.TrimSpace(line), ":")
+		if found && !slices.ContainsFunc(schemata, func(l string) bool { return strings.HasPrefix(l, resource+":") }) {
+			lines = append(lines, strings.TrimSpace(line))
+		}
+	}
+	if err := os.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return fmt.Errorf("unable to set schemata of resctrl group %s: %w%s", path, err, lastStatus(path))
+	}
+	return nil
+}
+
+// CacheSchemata returns the L3 cache line of the schemata of the group at
+// path, which is the root for the default group, or an empty string when L3
+// cache allocation is not supported.
+func CacheSchemata(path string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(path, schemataFile))
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); strings.HasPrefix(line, cacheResource+":") {
+			return line, nil
+		}
+	}
+	return "", nil
+}
+
+// RemoveDir removes the directory of a group, the kernel removes the files of
+// the group along with it. Fake filesystems of tests replace it to do the
+// same.
+var RemoveDir = os.Remove
+
+// RemoveGroup removes the group at path, its CPUs go back to the default
+// group. Removing a group that does not exist is not an error.
+func RemoveGroup(path string) error {
+	if err := RemoveDir(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("unable to remove resctrl group %s: %w", path, err)
+	}
+	return nil
+}
+
+// lastStatus returns the reason the kernel gave for the failure of the last
+// command, which the error returned by the write does not tell.
+func lastStatus(groupPath string) string {
+	root := filepath.Dir(groupPath)
+	if exists(filepath.Join(groupPath, infoDir)) {
+		// The default group is the root itself.
+		root = groupPath
+	}
+	data, err := os.ReadFile(filepath.Join(root, infoDir, lastStatusFile))
+	if err != nil {
+		return ""
+	}
+	return ": " + strings.TrimSpace(string(data))
+}
+
+// readSchemata parses a schemata file, e.g.
+//
+//	L3:0=7ff;1=7ff
+//	MB:0=100;1=100
+//
+// into the value of every domain of every resource.
+func readSchemata(path string) (map[string]map[int]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	schemata := make(map[string]map[int]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		resource, allocations, found := strings.Cut(strings.TrimSpace(line), ":")
+		if !found {
+			continue
+		}
+		values := make(map[int]string)
+		for _, allocation := range strings.Split(allocations, ";") {
+			id, value, found := strings.Cut(allocation, "=")
+			domain, err := strconv.Atoi(id)
+			if !found || err != nil {
+				return nil, fmt.Errorf("invalid allocation %q in %s", allocation, path)
+			}
+			values[domain] = value
+		}
+		schemata[resource] = values
+	}
+	return schemata, nil
+}
+
+func domains(values map[int]string) []int {
+	ids := make([]int, 0, len(values))
+	for id := range values {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func readInt(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	value, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid content of %s: %w", path, err)
+	}
+	return value, nil
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,180 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package resctrl_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/utils/cpuset"
+
+	"github.com/Tal-or/dra-cpu-driver/pkg/resctrl"
+	"github.com/Tal-or/dra-cpu-driver/pkg/resctrl/resctrltest"
+)
+
+// newFakeResctrl returns a resctrl filesystem with two L3 cache domains,
+// with a group of the driver and a group of someone else.
+func newFakeResctrl(t *testing.T) string {
+	t.Helper()
+	root := resctrltest.NewFakeResctrl(t, 0, 1)
+	resctrltest.WriteFiles(t, root, map[string]string{
+		"dra-cpu-other/schemata":  "    L3:0=f00;1=f00\n    MB:0=100;1=100\n",
+		"dra-cpu-other/cpus_list": "3\n",
+		"unrelated/schemata":      "    L3:0=0ff;1=0ff\n",
+	})
+	return root
+}
+
+func TestDiscover(t *testing.T) {
+	info, err := resctrl.Discover(newFakeResctrl(t))
+	assert.NoError(t, err)
+	assert.Equal(t, &resctrl.Info{
+		CLOSCount:            8,
+		CacheWays:            12,
+		MinCacheWays:         1,
+		CacheDomains:         []int{0, 1},
+		MemoryBandwidth:      true,
+		MinBandwidth:         10,
+		BandwidthGranularity: 10,
+		BandwidthDomains:     []int{0, 1},
+	}, info)
+
+	info, err = resctrl.Discover(t.TempDir())
+	assert.NoError(t, err)
+	assert.Nil(t, info, "resctrl is not mounted")
+}
+
+func TestAllocateCacheWays(t *testing.T) {
+	tests := map[string]struct {
+		used      uint64
+		ways      int
+		expected  uint64
+		expectErr bool
+	}{
+		"highest ways first": {
+			ways:     4,
+			expected: 0xf00,
+		},
+		"skips used ways": {
+			used:     0xf00,
+			ways:     4,
+			expected: 0x0f0,
+		},
+		"contiguous ways only": {
+			used:      0x0f0,
+			ways:      6,
+			expectErr: true,
+		},
+		"lowest ways left to the default group": {
+			used:     0xff0,
+			ways:     3,
+			expected: 0x00e,
+		},
+		"all the ways of the cache": {
+			ways:      12,
+			expectErr: true,
+		},
+		"more ways than the cache has": {
+			ways:      13,
+			expectErr: true,
+		},
+	}
+
+	info := &resctrl.Info{CacheWays: 12, MinCacheWays: 1}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			mask, err := info.AllocateCacheWays(test.used, test.ways)
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, mask)
+		})
+	}
+}
+
+func TestDefaultCacheMask(t *testing.T) {
+	tests := map[string]struct {
+		used     uint64
+		expected uint64
+	}{
+		"no groups": {
+			expected: 0xfff,
+		},
+		"highest ways used": {
+			used:     0xf00,
+			expected: 0x0ff,
+		},
+		"free ways split by a group": {
+			used:     0x0f0,
+			expected: 0x00f,
+		},
+	}
+
+	info := &resctrl.Info{CacheWays: 12, MinCacheWays: 1}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.expected, info.DefaultCacheMask(test.used))
+		})
+	}
+}
+
+func TestGroup(t *testing.T) {
+	root := newFakeResctrl(t)
+	info, err := resctrl.Discover(root)
+	assert.NoError(t, err)
+
+	path := resctrl.GroupPath(root, "uid-0")
+	used, err := resctrl.UsedCacheWays(root, path)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0xf00), used, "only the groups of the driver count")
+
+	bandwidth, err := info.Bandwidth(25)
+	assert.NoError(t, err)
+	assert.Equal(t, 30, bandwidth)
+
+	assert.NoError(t, resctrl.CreateGroup(path, cpuset.New(1, 2), info.Schemata(0x0f0, bandwidth)))
+	data, err := os.ReadFile(filepath.Join(path, "cpus_list"))
+	assert.NoError(t, err)
+	assert.Equal(t, "1-2", string(data))
+	data, err = os.ReadFile(filepath.Join(path, "schemata"))
+	assert.NoError(t, err)
+	assert.Equal(t, "L3:0=f0;1=f0\nMB:0=30;1=30\n", string(data))
+
+	used, err = resctrl.UsedCacheWays(root, "")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0xff0), used)
+
+	line, err := resctrl.CacheSchemata(root)
+	assert.NoError(t, err)
+	assert.Equal(t, "L3:0=fff;1=fff", line)
+	assert.NoError(t, resctrl.SetSchemata(root, info.Schemata(info.DefaultCacheMask(used), 0)))
+	line, err = resctrl.CacheSchemata(root)
+	assert.NoError(t, err)
+	assert.Equal(t, "L3:0=f;1=f", line)
+	data, err = os.ReadFile(filepath.Join(root, "schemata"))
+	assert.NoError(t, err)
+	assert.Equal(t, "L3:0=f;1=f\nMB:0=100;1=100\n", string(data), "other resources are left unchanged")
+
+	assert.NoError(t, resctrl.RemoveGroup(path))
+	assert.NoDirExists(t, path)
+	assert.NoError(t, resctrl.RemoveGroup(path), "group already removed")
+}
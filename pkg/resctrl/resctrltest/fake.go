@@ -0,0 +1,85 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package resctrltest provides a fake resctrl filesystem for tests.
+package resctrltest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Tal-or/dra-cpu-driver/pkg/resctrl"
+)
+
+// NewFakeResctrl returns the root of a resctrl filesystem with the given L3
+// cache domains of 12 ways, and memory bandwidth allocation in the same
+// domains. The default group uses all the cache ways and the whole memory
+// bandwidth. Groups are removed along with their files until the end of the
+// test, as the kernel does.
+func NewFakeResctrl(t *testing.T, domains ...int) string {
+	t.Helper()
+	resctrl.RemoveDir = removeGroup
+	t.Cleanup(func() { resctrl.RemoveDir = os.Remove })
+	var cache, bandwidth []string
+	for _, domain := range domains {
+		cache = append(cache, fmt.Sprintf("%d=fff", domain))
+		bandwidth = append(bandwidth, fmt.Sprintf("%d=100", domain))
+	}
+	root := t.TempDir()
+	WriteFiles(t, root, map[string]string{
+		"schemata":               fmt.Sprintf("    L3:%s\n    MB:%s\n", strings.Join(cache, ";"), strings.Join(bandwidth, ";")),
+		"info/L3/num_closids":    "16\n",
+		"info/L3/cbm_mask":       "fff\n",
+		"info/L3/min_cbm_bits":   "1\n",
+		"info/MB/num_closids":    "8\n",
+		"info/MB/min_bandwidth":  "10\n",
+		"info/MB/bandwidth_gran": "10\n",
+		"info/last_cmd_status":   "ok\n",
+	})
+	return root
+}
+
+// removeGroup removes a group directory along with its files.
+func removeGroup(path string) error {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := os.Remove(filepath.Join(path, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return os.Remove(path)
+}
+
+// WriteFiles writes files, given by their path relative to root, creating
+// the groups they are in.
+func WriteFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for path, content := range files {
+		full := filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"fmt"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	resourceapi "k8s.io/api/resource/v1beta1"
+
+	"github.com/Tal-or/dra-cpu-driver/pkg/config"
+)
+
+// nodeNameField is the only field a node selector can match on.
+const nodeNameField = "metadata.name"
+
+// driverResults returns the allocation results of a claim that belong to this
+// driver. Results of other drivers are skipped, as a claim may mix devices of
+// several drivers, but results of this driver must come from the pool of this
+// node and the allocation must be usable on this node.
+func (s *DeviceState) driverResults(allocation *resourceapi.AllocationResult) ([]resourceapi.DeviceRequestAllocationResult, error) {
+	if !nodeSelectorMatches(allocation.NodeSelector, s.progArgs.NodeName) {
+		return nil, fmt.Errorf("allocation node selector does not match node %q", s.progArgs.NodeName)
+	}
+
+	var results []resourceapi.DeviceRequestAllocationResult
+	for i, result := range allocation.Devices.Results {
+		if result.Driver != config.DriverName {
+			continue
+		}
+		if result.Pool != s.progArgs.NodeName {
+			return nil, fmt.Errorf("result %d (request %q, device %q): pool %q is not the pool of node %q", i, result.Request, result.Device, result.Pool, s.progArgs.NodeName)
+		}
+		if _, exists := s.Allocatable[result.Device]; !exists {
+			return nil, fmt.Errorf("result %d (request %q, device %q): device is not allocatable", i, result.Request, result.Device)
+		}
+		results = append(results, result)
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("allocation has no device of driver %s", config.DriverName)
+	}
+	return results, nil
+}
+
+// nodeSelectorMatches tells whether a node selector may select the given
+// node. Only the node name field can be evaluated without the Node object;
+// label requirements are assumed to match, since the scheduler already
+// checked them. A nil selector matches every node.
+func nodeSelectorMatches(selector *corev1.NodeSelector, nodeName string) bool {
+	if selector == nil {
+		return true
+	}
+	for _, term := range selector.NodeSelectorTerms {
+		if nodeSelectorTermMatches(term, nodeName) {
+			return true
+		}
+	}
+	return false
+}
+
+func nodeSelectorTermMatches(term corev1.NodeSelectorTerm, nodeName string) bool {
+	// An empty term matches no node.
+	if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+		return false
+	}
+	for _, req := range term.MatchFields {
+		if req.Key != nodeNameField {
+			continue
+		}
+		switch req.Operator {
+		case corev1.NodeSelectorOpIn:
+			if !slices.Contains(req.Values, nodeName) {
+				return false
+			}
+		case corev1.NodeSelectorOpNotIn:
+			if slices.Contains(req.Values, nodeName) {
+				return false
+			}
+		}
+	}
+	return true
+}
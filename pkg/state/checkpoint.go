@@ -2,33 +2,110 @@ package state
 
 import (
 	"encoding/json"
+	"fmt"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
 	"k8s.io/kubernetes/pkg/kubelet/checkpointmanager/checksum"
-	
+	"k8s.io/utils/cpuset"
+
+	configapi "github.com/Tal-or/dra-cpu-driver/api/manager.cpu.com/resource/cpu/v1alpha1"
 	"github.com/Tal-or/dra-cpu-driver/pkg/devices"
+	"github.com/Tal-or/dra-cpu-driver/pkg/discovery"
 )
 
+// DriverPluginCheckpointFile is the checkpoint holding all the prepared
+// claims written by older drivers. Its claims are moved to per-claim
+// checkpoints at startup, see claimStore.
 const DriverPluginCheckpointFile = "checkpoint.json"
 
 type Checkpoint struct {
 	Checksum checksum.Checksum `json:"checksum"`
-	V1       *CheckpointV1     `json:"v1,omitempty"`
+	// V1 is only found in checkpoints written by older drivers. It is
+	// migrated to V2 when the checkpoint is loaded and never written back.
+	V1 *CheckpointV1 `json:"v1,omitempty"`
+	V2 *CheckpointV2 `json:"v2,omitempty"`
 }
 
 type CheckpointV1 struct {
 	PreparedClaims devices.PreparedClaims `json:"preparedClaims,omitempty"`
+	// ClaimStates records where every prepared claim is in its lifecycle.
+	// Claims recorded before states were introduced have no entry and are
+	// completely prepared.
+	ClaimStates map[string]ClaimState `json:"claimStates,omitempty"`
 }
 
-func newCheckpoint() *Checkpoint {
-	pc := &Checkpoint{
-		Checksum: 0,
-		V1: &CheckpointV1{
-			PreparedClaims: make(devices.PreparedClaims),
-		},
-	}
-	return pc
+type CheckpointV2 struct {
+	// DriverVersion is the version of the driver that last wrote the
+	// checkpoint.
+	DriverVersion  string         `json:"driverVersion,omitempty"`
+	PreparedClaims PreparedClaims `json:"preparedClaims,omitempty"`
+}
+
+// PreparedClaims maps the UID of every prepared claim to its record.
+type PreparedClaims map[string]*PreparedClaim
+
+// PreparedClaim records a claim prepared on the node, with everything needed
+// to unprepare it or to pin its containers after a restart.
+type PreparedClaim struct {
+	State     ClaimState `json:"state"`
+	Namespace string     `json:"namespace,omitempty"`
+	Name      string     `json:"name,omitempty"`
+	// Pods are the pods the claim was reserved for when it was prepared.
+	Pods []PodReference `json:"pods,omitempty"`
+	// EnvPrefix is the prefix of the environment variables describing the
+	// claim in its containers.
+	EnvPrefix string `json:"envPrefix,omitempty"`
+	// CPUs and NUMANodes are the resolved sets of all the devices of the
+	// claim, e.g. "0-3,8".
+	CPUs      string                  `json:"cpus,omitempty"`
+	NUMANodes string                  `json:"numaNodes,omitempty"`
+	Devices   devices.PreparedDevices `json:"devices"`
+	// TuningActions are the changes made to the node for the claim, undone
+	// in reverse order when it is unprepared.
+	TuningActions []TuningAction `json:"tuningActions,omitempty"`
+	// Timestamps of the lifecycle transitions. Claims migrated from V1 have
+	// none.
+	PrepareStartedAt   *metav1.Time `json:"prepareStartedAt,omitempty"`
+	PrepareCompletedAt *metav1.Time `json:"prepareCompletedAt,omitempty"`
+	UnprepareStartedAt *metav1.Time `json:"unprepareStartedAt,omitempty"`
+}
+
+// PodReference identifies a pod consuming a claim.
+type PodReference struct {
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	UID       types.UID `json:"uid"`
 }
 
+// TuningAction is a file written on the node while preparing a claim, with
+// its previous content so that it can be restored.
+type TuningAction struct {
+	// Type identifies the kind of tuning, e.g. "irqAffinity".
+	Type     string `json:"type"`
+	Path     string `json:"path"`
+	Original string `json:"original"`
+}
+
+// ClaimState is the lifecycle state of a claim in the checkpoint. Preparing
+// and unpreparing a claim take several steps which are not atomic, so the
+// checkpoint records the operation in progress before starting it: after a
+// crash, the driver knows which claims to roll back or finish unpreparing.
+type ClaimState string
+
+const (
+	// ClaimPrepareStarted is recorded before the CDI spec file of the claim
+	// is written. Claims found in that state at startup are rolled back.
+	ClaimPrepareStarted ClaimState = "PrepareStarted"
+	// ClaimPrepareCompleted is recorded once the claim is fully prepared.
+	ClaimPrepareCompleted ClaimState = "PrepareCompleted"
+	// ClaimUnprepareStarted is recorded before the CDI spec file of the
+	// claim is deleted. Claims found in that state at startup are
+	// unprepared.
+	ClaimUnprepareStarted ClaimState = "UnprepareStarted"
+)
+
 func (cp *Checkpoint) MarshalCheckpoint() ([]byte, error) {
 	cp.Checksum = 0
 	out, err := json.Marshal(*cp)
@@ -55,3 +132,79 @@ func (cp *Checkpoint) VerifyChecksum() error {
 	}
 	return ck.Verify(out)
 }
+
+// migrate converts a checkpoint written by an older driver to V2 in place.
+// It must only be called once the checksum was verified, as it changes the
+// content of the checkpoint. The CPUs and pool of the devices prepared before
+// they were recorded are looked up in allocatable, numaNodes resolves the NUMA
+// nodes of the CPUs of the migrated claims, and defaultPinning the pinning of
+// the devices prepared before it was recorded.
+func (cp *Checkpoint) migrate(allocatable discovery.AllocatableDevices, numaNodes func(cpuset.CPUSet) cpuset.CPUSet, defaultPinning func(string) configapi.PinningMode) error {
+	if cp.V2 == nil {
+		cp.V2 = &CheckpointV2{}
+	}
+	if cp.V2.PreparedClaims == nil {
+		cp.V2.PreparedClaims = make(PreparedClaims)
+	}
+	if cp.V1 == nil {
+		return nil
+	}
+
+	for claimUID, preparedDevices := range cp.V1.PreparedClaims {
+		for _, device := range preparedDevices {
+			if allocatableDevice, exists := allocatable[device.DeviceName]; exists {
+				if device.CPUs == "" {
+					device.CPUs = allocatableDevice.CPUs.String()
+				}
+				if device.CPUPool == "" {
+					device.CPUPool = allocatableDevice.Pool
+				}
+			} else if device.CPUs == "" {
+				klog.Warningf("Device %s of claim %s is no longer allocatable, its CPUs are unknown", device.DeviceName, claimUID)
+			}
+			if device.Pinning == "" {
+				device.Pinning = string(defaultPinning(device.DeviceName))
+			}
+		}
+		cpus, err := preparedDevices.CPUSet()
+		if err != nil {
+			return fmt.Errorf("claim %s: %v", claimUID, err)
+		}
+		cp.V2.PreparedClaims[claimUID] = &PreparedClaim{
+			State:     cp.V1.claimState(claimUID),
+			CPUs:      cpus.String(),
+			NUMANodes: numaNodes(cpus).String(),
+			Devices:   preparedDevices,
+		}
+	}
+	cp.V1 = nil
+	return nil
+}
+
+// claimState returns the state of a claim, or an empty state if the claim is
+// not in the checkpoint.
+func (cp *CheckpointV1) claimState(claimUID string) ClaimState {
+	if _, exists := cp.PreparedClaims[claimUID]; !exists {
+		return ""
+	}
+	if state, exists := cp.ClaimStates[claimUID]; exists {
+		return state
+	}
+	return ClaimPrepareCompleted
+}
+
+// withState returns a copy of the claim moved to a new state, recording when
+// it happened.
+func (c PreparedClaim) withState(state ClaimState) *PreparedClaim {
+	c.State = state
+	now := metav1.Now().Rfc3339Copy()
+	switch state {
+	case ClaimPrepareStarted:
+		c.PrepareStartedAt = &now
+	case ClaimPrepareCompleted:
+		c.PrepareCompletedAt = &now
+	case ClaimUnprepareStarted:
+		c.UnprepareStartedAt = &now
+	}
+	return &c
+}
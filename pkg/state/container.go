@@ -0,0 +1,131 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"k8s.io/utils/cpuset"
+
+	configapi "github.com/Tal-or/dra-cpu-driver/api/manager.cpu.com/resource/cpu/v1alpha1"
+	"github.com/Tal-or/dra-cpu-driver/pkg/config"
+	"github.com/Tal-or/dra-cpu-driver/pkg/devices"
+	"github.com/Tal-or/dra-cpu-driver/pkg/discovery"
+)
+
+// ContainerCPUs returns the CPUs a container of the pod with the given UID
+// must be pinned to and the NUMA nodes its memory must be allocated from. The
+// claims and devices used by the container are found from the environment
+// injected by their CDI devices, so only the devices the container actually
+// references are taken into account. As the environment is under the control
+// of the pod, a claim is only honoured when it was prepared for that pod, and
+// whether a device is pinned comes from its prepared record. Empty sets are
+// returned when the container uses no pinned CPU.
+func (s *DeviceState) ContainerCPUs(podUID string, env []string) (cpuset.CPUSet, cpuset.CPUSet, error) {
+	vars := make(map[string]string)
+	claimPrefixes := make(map[string]string)
+	for _, e := range env {
+		name, value, _ := strings.Cut(e, "=")
+		vars[name] = value
+		if prefix, found := strings.CutSuffix(name, "_CLAIM_UID"); found && strings.HasPrefix(prefix, envPrefix+"_") {
+			claimPrefixes[value] = prefix
+		}
+	}
+	if len(claimPrefixes) == 0 {
+		return cpuset.New(), cpuset.New(), nil
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	var shared *cpuset.CPUSet
+	if s.progArgs.DynamicSharedPool {
+		cpus, err := sharedCPUs(s.Pools, s.claims.preparedDevices())
+		if err != nil {
+			return cpuset.New(), cpuset.New(), err
+		}
+		shared = &cpus
+	}
+
+	cpus := cpuset.New()
+	for claimUID, prefix := range claimPrefixes {
+		preparedClaim := s.claims.get(claimUID)
+		if preparedClaim == nil {
+			return cpuset.New(), cpuset.New(), fmt.Errorf("claim %s is not prepared", claimUID)
+		}
+		if !slices.ContainsFunc(preparedClaim.Pods, func(pod PodReference) bool { return string(pod.UID) == podUID }) {
+			return cpuset.New(), cpuset.New(), fmt.Errorf("claim %s is not prepared for pod %s", claimUID, podUID)
+		}
+		if preparedClaim.EnvPrefix != "" && preparedClaim.EnvPrefix != prefix {
+			return cpuset.New(), cpuset.New(), fmt.Errorf("claim %s is exposed as %s, not %s", claimUID, preparedClaim.EnvPrefix, prefix)
+		}
+		claimCPUs, err := containerClaimCPUs(prefix, preparedClaim.Devices, vars, shared)
+		if err != nil {
+			return cpuset.New(), cpuset.New(), fmt.Errorf("claim %s: %w", claimUID, err)
+		}
+		cpus = cpus.Union(claimCPUs)
+	}
+
+	return cpus, s.numaNodes(cpus), nil
+}
+
+// containerClaimCPUs returns the pinned CPUs of the devices of a claim that
+// are referenced by the container. When shared is set, devices of the shared
+// pool stand for the whole dynamic shared pool.
+func containerClaimCPUs(claimPrefix string, preparedDevices devices.PreparedDevices, vars map[string]string, shared *cpuset.CPUSet) (cpuset.CPUSet, error) {
+	cpus := cpuset.New()
+	for _, device := range preparedDevices {
+		if !hasVarWithPrefix(vars, deviceEnvPrefix(claimPrefix, discovery.PhysicalDeviceName(device.DeviceName))+"_") {
+			continue
+		}
+		if device.Pinning == string(configapi.NoPinning) {
+			continue
+		}
+		if shared != nil && device.CPUPool == config.SharedPool {
+			cpus = cpus.Union(*shared)
+			continue
+		}
+		deviceCPUs, err := device.CPUSet()
+		if err != nil {
+			return cpuset.New(), fmt.Errorf("invalid CPUs of device %s: %w", device.DeviceName, err)
+		}
+		cpus = cpus.Union(deviceCPUs)
+	}
+	return cpus, nil
+}
+
+func hasVarWithPrefix(vars map[string]string, prefix string) bool {
+	for name := range vars {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// numaNodes returns the NUMA nodes of a set of CPUs.
+func (s *DeviceState) numaNodes(cpus cpuset.CPUSet) cpuset.CPUSet {
+	var nodes []int
+	for _, cpu := range cpus.List() {
+		if info, ok := s.topology.CPUs[cpu]; ok {
+			nodes = append(nodes, info.NUMANode)
+		}
+	}
+	return cpuset.New(nodes...)
+}
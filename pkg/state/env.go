@@ -0,0 +1,227 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+
+	resourceapi "k8s.io/api/resource/v1beta1"
+	"k8s.io/utils/cpuset"
+
+	configapi "github.com/Tal-or/dra-cpu-driver/api/manager.cpu.com/resource/cpu/v1alpha1"
+)
+
+// The environment injected into containers is built around a per-claim
+// prefix, so that a pod consuming several claims never sees colliding names:
+//
+//	DRA_CPU_<CLAIM>_CLAIM_UID=<uid>
+//	DRA_CPU_<CLAIM>_CPUS=0-3,8
+//	DRA_CPU_<CLAIM>_CPU_MASK=0x10f
+//	DRA_CPU_<CLAIM>_CPU_COUNT=5
+//	DRA_CPU_<CLAIM>_NUMA_NODES=0-1
+//	DRA_CPU_<CLAIM>_NUMA_<N>_CPUS=0-3
+//	DRA_CPU_<CLAIM>_NUMA_<N>_CPU_MASK=0xf
+//	DRA_CPU_<CLAIM>_REQUEST_<REQUEST>_CPUS=0-3
+//	DRA_CPU_<CLAIM>_REQUEST_<REQUEST>_CPU_MASK=0xf
+//	DRA_CPU_<CLAIM>_REQUEST_<REQUEST>_CPU_COUNT=4
+//	DRA_CPU_<CLAIM>_REQUEST_<REQUEST>_PINNING=Exclusive
+//	DRA_CPU_<CLAIM>_REQUEST_<REQUEST>_SMT_POLICY=Allow
+//	DRA_CPU_<CLAIM>_DEVICE_<DEVICE>_CPUS=0,4
+//
+// <CLAIM> is the name under which the pod references the claim, or the claim
+// name itself when it was not generated from a template. Names such as
+// "my-claim" and "my.claim" map to the same <CLAIM>, and the variables of a
+// claim named "a-device-cpu-3" would be taken for those of device cpu-3 of a
+// claim named "a". When the prefixes of claims of the same pod collide so, the
+// claim prepared last gets the first characters of its UID appended, e.g.
+// MY_CLAIM_5F3A0C1B, or its whole UID as <CLAIM> when that is not enough.
+// Whether the _CPUS or _CPU_MASK forms are injected depends on the EnvFormat
+// of the config.
+const envPrefix = "DRA_CPU"
+
+// envUIDSuffixLength is the number of characters of the claim UID that
+// disambiguate colliding claim prefixes.
+const envUIDSuffixLength = 8
+
+// podClaimNameAnnotation is set by the resource claim controller on claims
+// generated from a template, with the name the pod uses for the claim.
+const podClaimNameAnnotation = "resource.kubernetes.io/pod-claim-name"
+
+// claimEnvPrefix returns the prefix of all the variables describing a claim.
+func claimEnvPrefix(claim *resourceapi.ResourceClaim) string {
+	name := claim.Name
+	if podClaimName := claim.Annotations[podClaimNameAnnotation]; podClaimName != "" {
+		name = podClaimName
+	}
+	return envPrefix + "_" + envName(name)
+}
+
+// envPrefixIndex holds the prefix given to every prepared claim, by claim
+// UID, so that claims consumed by the same pod never share a prefix.
+type envPrefixIndex map[string]claimEnv
+
+type claimEnv struct {
+	prefix string
+	pods   []PodReference
+}
+
+// newEnvPrefixIndex builds the index from the prepared claims. Claims
+// prepared before prefixes were recorded are left out.
+func newEnvPrefixIndex(preparedClaims PreparedClaims) envPrefixIndex {
+	index := make(envPrefixIndex)
+	for claimUID, claim := range preparedClaims {
+		if claim.EnvPrefix != "" {
+			index[claimUID] = claimEnv{prefix: claim.EnvPrefix, pods: claim.Pods}
+		}
+	}
+	return index
+}
+
+// add returns the prefix of a claim consumed by pods, made distinct from the
+// prefixes of the other claims of these pods, and records it.
+func (index envPrefixIndex) add(claim *resourceapi.ResourceClaim, pods []PodReference) string {
+	prefix := claimEnvPrefix(claim)
+	if index.collides(string(claim.UID), prefix, pods) {
+		prefix += "_" + envName(string(claim.UID)[:min(len(claim.UID), envUIDSuffixLength)])
+		// A suffix does not help when the prefix is nested in the
+		// variables of another claim.
+		if index.collides(string(claim.UID), prefix, pods) {
+			prefix = envPrefix + "_" + envName(string(claim.UID))
+		}
+	}
+	index[string(claim.UID)] = claimEnv{prefix: prefix, pods: pods}
+	return prefix
+}
+
+// collides tells whether the variables under prefix could be taken for those
+// of another claim of pods than claimUID, or the other way round: when the
+// prefixes are equal, or when one is nested in the variables of the requests,
+// devices or NUMA nodes of the other.
+func (index envPrefixIndex) collides(claimUID, prefix string, pods []PodReference) bool {
+	for otherUID, other := range index {
+		if otherUID == claimUID || !sharePod(other.pods, pods) {
+			continue
+		}
+		if prefix == other.prefix || nestedEnvPrefix(prefix, other.prefix) || nestedEnvPrefix(other.prefix, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// nestedEnvPrefix tells whether prefix is nested in the variables of the
+// requests, devices or NUMA nodes of the claim with claimPrefix.
+func nestedEnvPrefix(prefix, claimPrefix string) bool {
+	for _, part := range []string{"_REQUEST_", "_DEVICE_", "_NUMA_"} {
+		if strings.HasPrefix(prefix, claimPrefix+part) {
+			return true
+		}
+	}
+	return false
+}
+
+func sharePod(a, b []PodReference) bool {
+	return slices.ContainsFunc(a, func(pod PodReference) bool {
+		return slices.ContainsFunc(b, func(other PodReference) bool {
+			return other.UID == pod.UID
+		})
+	})
+}
+
+// requestEnvPrefix returns the prefix of the variables describing the CPUs
+// allocated for one request of a claim.
+func requestEnvPrefix(claimPrefix, request string) string {
+	return claimPrefix + "_REQUEST_" + envName(request)
+}
+
+// deviceEnvPrefix returns the prefix of the variables describing a single
+// device of a claim. Slot devices must be given by the name of their physical
+// device, so that several slots of a CPU are described once.
+func deviceEnvPrefix(claimPrefix, device string) string {
+	return claimPrefix + "_DEVICE_" + envName(device)
+}
+
+// envName turns a Kubernetes name such as "my-claim" into a string that can
+// be used inside an environment variable name ("MY_CLAIM").
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+// cpuSetEnvs describes a set of CPUs with its count and the forms selected by
+// format.
+func cpuSetEnvs(prefix string, cpus cpuset.CPUSet, format configapi.EnvFormat) []string {
+	envs := []string{fmt.Sprintf("%s_CPU_COUNT=%d", prefix, cpus.Size())}
+	return append(envs, cpuFormatEnvs(prefix, cpus, format)...)
+}
+
+func cpuFormatEnvs(prefix string, cpus cpuset.CPUSet, format configapi.EnvFormat) []string {
+	var envs []string
+	if format == configapi.EnvFormatList || format == configapi.EnvFormatAll {
+		envs = append(envs, fmt.Sprintf("%s_CPUS=%s", prefix, cpus))
+	}
+	if format == configapi.EnvFormatMask || format == configapi.EnvFormatAll {
+		envs = append(envs, fmt.Sprintf("%s_CPU_MASK=%s", prefix, cpuMask(cpus)))
+	}
+	return envs
+}
+
+// numaEnvs groups the CPUs by NUMA node.
+func (s *DeviceState) numaEnvs(prefix string, cpus cpuset.CPUSet, format configapi.EnvFormat) []string {
+	perNode := make(map[int][]int)
+	for _, cpu := range cpus.List() {
+		node := 0
+		if info, ok := s.topology.CPUs[cpu]; ok {
+			node = info.NUMANode
+		}
+		perNode[node] = append(perNode[node], cpu)
+	}
+
+	var nodes []int
+	for node := range perNode {
+		nodes = append(nodes, node)
+	}
+	slices.Sort(nodes)
+
+	envs := []string{fmt.Sprintf("%s_NUMA_NODES=%s", prefix, cpuset.New(nodes...))}
+	for _, node := range nodes {
+		nodePrefix := fmt.Sprintf("%s_NUMA_%d", prefix, node)
+		envs = append(envs, cpuFormatEnvs(nodePrefix, cpuset.New(perNode[node]...), format)...)
+	}
+	return envs
+}
+
+// cpuMask formats a set of CPUs as a hexadecimal affinity mask as accepted by
+// taskset, e.g. "0x10f" for CPUs 0-3,8.
+func cpuMask(cpus cpuset.CPUSet) string {
+	mask := new(big.Int)
+	for _, cpu := range cpus.List() {
+		mask.SetBit(mask, cpu, 1)
+	}
+	return fmt.Sprintf("0x%x", mask)
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"fmt"
+
+	"k8s.io/klog/v2"
+)
+
+// PreparedClaimUIDs returns the UIDs of the claims currently prepared.
+func (s *DeviceState) PreparedClaimUIDs() []string {
+	return s.claims.claimUIDs()
+}
+
+// PreparedClaimName returns the namespace and name of a prepared claim. They
+// are empty for claims prepared by drivers which did not record them.
+func (s *DeviceState) PreparedClaimName(claimUID string) (string, string) {
+	claim := s.claims.get(claimUID)
+	if claim == nil {
+		return "", ""
+	}
+	return claim.Namespace, claim.Name
+}
+
+// RemoveOrphanedCDISpecs deletes the CDI spec files of claims that are not
+// prepared, e.g. because the driver crashed between writing the spec file and
+// the checkpoint. It returns the UIDs of the claims whose spec was deleted.
+func (s *DeviceState) RemoveOrphanedCDISpecs() ([]string, error) {
+	specClaimUIDs, err := s.cdi.ListClaimSpecFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	for _, claimUID := range specClaimUIDs {
+		// The claim is locked so that it cannot be prepared between the
+		// lookup and the deletion.
+		unlock := s.claimLocks.lock(claimUID)
+		if s.claims.get(claimUID) != nil {
+			unlock()
+			continue
+		}
+		err := s.cdi.DeleteClaimSpecFile(claimUID)
+		unlock()
+		if err != nil {
+			return removed, fmt.Errorf("unable to delete CDI spec file for claim %s: %v", claimUID, err)
+		}
+		klog.Infof("Deleted orphaned CDI spec file for claim %s", claimUID)
+		removed = append(removed, claimUID)
+	}
+	return removed, nil
+}
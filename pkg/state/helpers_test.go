@@ -0,0 +1,248 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	resourceapi "k8s.io/api/resource/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/kubernetes/pkg/kubelet/checkpointmanager"
+	"k8s.io/utils/cpuset"
+
+	configapi "github.com/Tal-or/dra-cpu-driver/api/manager.cpu.com/resource/cpu/v1alpha1"
+	"github.com/Tal-or/dra-cpu-driver/pkg/cdi"
+	"github.com/Tal-or/dra-cpu-driver/pkg/config"
+	"github.com/Tal-or/dra-cpu-driver/pkg/devices"
+	"github.com/Tal-or/dra-cpu-driver/pkg/discovery"
+	"github.com/Tal-or/dra-cpu-driver/pkg/housekeeping"
+	"github.com/Tal-or/dra-cpu-driver/pkg/topology"
+)
+
+var errInjected = errors.New("injected failure")
+
+// faultInjector fails the failAt-th step of an operation. Steps are the
+// checkpoint writes and removals, the CDI spec file creations and deletions,
+// and each kind of change made to the node to tune a claim. When crash is
+// set, every step after the failing one fails too, as if the driver had died
+// at that point.
+type faultInjector struct {
+	failAt  int
+	crash   bool
+	steps   int
+	crashed bool
+}
+
+func (f *faultInjector) step() error {
+	f.steps++
+	if f.crashed {
+		return errInjected
+	}
+	if f.steps == f.failAt {
+		f.crashed = f.crash
+		return errInjected
+	}
+	return nil
+}
+
+type faultyCheckpointManager struct {
+	checkpointmanager.CheckpointManager
+	faults *faultInjector
+}
+
+func (m *faultyCheckpointManager) CreateCheckpoint(key string, checkpoint checkpointmanager.Checkpoint) error {
+	if err := m.faults.step(); err != nil {
+		return err
+	}
+	return m.CheckpointManager.CreateCheckpoint(key, checkpoint)
+}
+
+func (m *faultyCheckpointManager) RemoveCheckpoint(key string) error {
+	if err := m.faults.step(); err != nil {
+		return err
+	}
+	return m.CheckpointManager.RemoveCheckpoint(key)
+}
+
+type faultyCDIHandler struct {
+	*cdi.Handler
+	faults *faultInjector
+}
+
+func (h *faultyCDIHandler) CreateClaimSpecFile(claimUID string, preparedDevices devices.PreparedDevices) error {
+	if err := h.faults.step(); err != nil {
+		return err
+	}
+	return h.Handler.CreateClaimSpecFile(claimUID, preparedDevices)
+}
+
+func (h *faultyCDIHandler) DeleteClaimSpecFile(claimUID string) error {
+	if err := h.faults.step(); err != nil {
+		return err
+	}
+	return h.Handler.DeleteClaimSpecFile(claimUID)
+}
+
+// newTestState returns a state persisted in the given directories, as the
+// driver would find them when starting. Faults are only injected once the
+// state is loaded, after the options are applied.
+func newTestState(t testing.TB, cdiRoot, checkpointDir string, faults *faultInjector, opts ...func(*DeviceState)) *DeviceState {
+	t.Helper()
+	progArgs := &config.ProgArgs{CdiRoot: cdiRoot, NodeName: "node-0"}
+	cdiHandler, err := cdi.NewHandler(&config.Config{ProgArgs: progArgs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkpointManager, err := checkpointmanager.NewCheckpointManager(checkpointDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &DeviceState{
+		Allocatable: discovery.AllocatableDevices{
+			"cpu-0": {Pool: config.AllocatablePool, CPUs: cpuset.New(0)},
+		},
+		progArgs: progArgs,
+		topology: &topology.Topology{
+			CPUs: map[int]*topology.CPUInfo{0: {ID: 0}},
+		},
+		cdi:          cdiHandler,
+		claims:       newClaimStore(checkpointManager),
+		housekeeping: housekeeping.NewManager(progArgs.SysfsRoot, progArgs.ProcfsRoot, false),
+		partitions:   newCPUPartitions(progArgs.CgroupRoot),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if err := s.syncFromCheckpoint(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	s.cdi = &faultyCDIHandler{Handler: cdiHandler, faults: faults}
+	s.claims.checkpointManager = &faultyCheckpointManager{CheckpointManager: checkpointManager, faults: faults}
+	s.tuningStep = faults.step
+	return s
+}
+
+func newTestClaim() *resourceapi.ResourceClaim {
+	return &resourceapi.ResourceClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "cpus", UID: "uid-0"},
+		Status: resourceapi.ResourceClaimStatus{
+			Allocation: &resourceapi.AllocationResult{
+				Devices: resourceapi.DeviceAllocationResult{
+					Results: []resourceapi.DeviceRequestAllocationResult{
+						{Request: "cpus", Driver: config.DriverName, Pool: "node-0", Device: "cpu-0"},
+					},
+				},
+			},
+		},
+	}
+}
+
+// newConfiguredTestClaim returns a claim for the device with the opaque
+// config cfg, or without config when cfg is nil.
+func newConfiguredTestClaim(uid, device string, cfg *configapi.CpuConfig) *resourceapi.ResourceClaim {
+	claim := newTestClaim()
+	claim.UID = types.UID(uid)
+	claim.Status.Allocation.Devices.Results[0].Device = device
+	if cfg == nil {
+		return claim
+	}
+	cfg = cfg.DeepCopy()
+	cfg.TypeMeta = configapi.DefaultCpuConfig().TypeMeta
+	raw, err := json.Marshal(cfg)
+	if err != nil {
+		panic(err)
+	}
+	claim.Status.Allocation.Devices.Config = []resourceapi.DeviceAllocationConfiguration{{
+		Source: resourceapi.AllocationConfigSourceClaim,
+		DeviceConfiguration: resourceapi.DeviceConfiguration{
+			Opaque: &resourceapi.OpaqueDeviceConfiguration{
+				Driver:     config.DriverName,
+				Parameters: runtime.RawExtension{Raw: raw},
+			},
+		},
+	}}
+	return claim
+}
+
+// assertConsistent checks that the claim is either completely prepared,
+// with its CDI spec file and its CPUs owned, or completely gone. It returns
+// whether the claim is prepared.
+func assertConsistent(t *testing.T, s *DeviceState, claimUID string) bool {
+	t.Helper()
+	specs, err := s.cdi.ListClaimSpecFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hasSpec := slices.Contains(specs, claimUID)
+	owned := slices.ContainsFunc(s.CPUOwners(0), func(owner CPUOwner) bool {
+		return owner.ClaimUID == claimUID
+	})
+
+	switch state := s.claims.state(claimUID); state {
+	case "":
+		assert.False(t, hasSpec, "CDI spec file left behind")
+		assert.False(t, owned, "CPUs still owned")
+		return false
+	case ClaimPrepareCompleted:
+		assert.True(t, hasSpec, "CDI spec file missing")
+		assert.True(t, owned, "CPUs not owned")
+		return true
+	default:
+		t.Errorf("claim left in state %s", state)
+		return false
+	}
+}
+
+// readTree returns the content of every file under root with its lines
+// trimmed, and the directories as empty entries.
+func readTree(t *testing.T, root string) map[string]string {
+	t.Helper()
+	tree := make(map[string]string)
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			tree[path] = ""
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		for i := range lines {
+			lines[i] = strings.TrimSpace(lines[i])
+		}
+		tree[path] = strings.Join(lines, "\n")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
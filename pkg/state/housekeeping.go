@@ -0,0 +1,75 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"fmt"
+
+	"k8s.io/utils/cpuset"
+
+	"github.com/Tal-or/dra-cpu-driver/pkg/config"
+	"github.com/Tal-or/dra-cpu-driver/pkg/devices"
+	"github.com/Tal-or/dra-cpu-driver/pkg/housekeeping"
+)
+
+// isolatesHousekeeping tells whether any device was prepared with
+// housekeeping isolation.
+func isolatesHousekeeping(preparedDevices devices.PreparedDevices) bool {
+	for _, device := range preparedDevices {
+		if device.HousekeepingIsolation {
+			return true
+		}
+	}
+	return false
+}
+
+// housekeepingCPUs returns the CPUs the housekeeping work is moved onto,
+// i.e. the reserved CPUs.
+func (s *DeviceState) housekeepingCPUs() (cpuset.CPUSet, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	pool, exists := s.Pools[config.ReservedPool]
+	if !exists || pool.CPUs.IsEmpty() {
+		return cpuset.New(), fmt.Errorf("housekeeping isolation requires CPUs in the %q pool", config.ReservedPool)
+	}
+	return pool.CPUs, nil
+}
+
+// housekeepingSettings returns the housekeeping settings recorded in the
+// tuning actions of a claim.
+func housekeepingSettings(actions []TuningAction) []housekeeping.Setting {
+	var settings []housekeeping.Setting
+	for _, action := range actions {
+		switch action.Type {
+		case housekeeping.WorkqueueCPUMask, housekeeping.KThreadAffinity:
+			settings = append(settings, housekeeping.Setting{Type: action.Type, Path: action.Path, Original: action.Original})
+		}
+	}
+	return settings
+}
+
+// adoptHousekeepingIsolation tells the housekeeping manager which of the
+// claims found in the checkpoint isolate CPUs, so that the settings are
+// restored when the last of them is unprepared.
+func (s *DeviceState) adoptHousekeepingIsolation() {
+	for _, claimUID := range s.claims.claimUIDs() {
+		if settings := housekeepingSettings(s.claims.get(claimUID).TuningActions); len(settings) > 0 {
+			s.housekeeping.Adopt(claimUID, settings)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/utils/cpuset"
+
+	configapi "github.com/Tal-or/dra-cpu-driver/api/manager.cpu.com/resource/cpu/v1alpha1"
+	"github.com/Tal-or/dra-cpu-driver/pkg/config"
+	"github.com/Tal-or/dra-cpu-driver/pkg/discovery"
+	"github.com/Tal-or/dra-cpu-driver/pkg/housekeeping"
+)
+
+func TestHousekeepingIsolation(t *testing.T) {
+	cdiRoot, checkpointDir, sysfsRoot, procfsRoot := t.TempDir(), t.TempDir(), t.TempDir(), t.TempDir()
+	cpumask := filepath.Join(sysfsRoot, "devices/virtual/workqueue/cpumask")
+	if err := os.MkdirAll(filepath.Dir(cpumask), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cpumask, []byte("00000003\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	newState := func() *DeviceState {
+		return newTestState(t, cdiRoot, checkpointDir, &faultInjector{}, func(s *DeviceState) {
+			s.housekeeping = housekeeping.NewManager(sysfsRoot, procfsRoot, false)
+		})
+	}
+
+	claim := newConfiguredTestClaim("uid-0", "cpu-0", &configapi.CpuConfig{HousekeepingIsolation: true})
+
+	// The housekeeping work has nowhere to go without reserved CPUs.
+	s := newState()
+	_, err := s.Prepare(claim)
+	assert.Error(t, err)
+	assert.False(t, assertConsistent(t, s, string(claim.UID)))
+
+	s.Pools = map[string]*discovery.Pool{config.ReservedPool: {Name: config.ReservedPool, CPUs: cpuset.New(1)}}
+	_, err = s.Prepare(claim)
+	assert.NoError(t, err)
+	assert.Equal(t, []TuningAction{
+		{Type: housekeeping.WorkqueueCPUMask, Path: cpumask, Original: "00000003"},
+	}, s.claims.get(string(claim.UID)).TuningActions)
+	data, err := os.ReadFile(cpumask)
+	assert.NoError(t, err)
+	assert.Equal(t, "00000002", string(data))
+
+	// The settings are restored by the driver restarted in between.
+	s = newState()
+	assert.NoError(t, s.Unprepare(string(claim.UID)))
+	data, err = os.ReadFile(cpumask)
+	assert.NoError(t, err)
+	assert.Equal(t, "00000003", string(data))
+}
@@ -0,0 +1,154 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+
+	"k8s.io/klog/v2"
+	"k8s.io/utils/cpuset"
+
+	"github.com/Tal-or/dra-cpu-driver/pkg/devices"
+	"github.com/Tal-or/dra-cpu-driver/pkg/irq"
+)
+
+// Types of the tuning actions changing the affinity of IRQs.
+const (
+	tuningIRQAffinity        = "irqAffinity"
+	tuningDefaultIRQAffinity = "defaultIrqAffinity"
+)
+
+// irqChange is a change of the affinity of an IRQ about to be made for a
+// claim.
+type irqChange struct {
+	file   irq.AffinityFile
+	cpus   cpuset.CPUSet
+	action TuningAction
+}
+
+// irqIsolatedCPUs returns the CPUs of the devices prepared with IRQ
+// isolation.
+func irqIsolatedCPUs(preparedDevices devices.PreparedDevices) (cpuset.CPUSet, error) {
+	cpus := cpuset.New()
+	for _, device := range preparedDevices {
+		if !device.IRQIsolation {
+			continue
+		}
+		deviceCPUs, err := device.CPUSet()
+		if err != nil {
+			return cpuset.New(), fmt.Errorf("invalid CPUs of device %s: %w", device.DeviceName, err)
+		}
+		cpus = cpus.Union(deviceCPUs)
+	}
+	return cpus, nil
+}
+
+// planIRQIsolation returns the changes moving every IRQ, and the IRQs yet to
+// be allocated, off the isolated CPUs. IRQs that may only run on isolated
+// CPUs are left alone, as there is nowhere to move them.
+func (s *DeviceState) planIRQIsolation(isolated cpuset.CPUSet) ([]irqChange, error) {
+	files, err := irq.Affinities(s.progArgs.ProcfsRoot)
+	if err != nil {
+		return nil, err
+	}
+	files = append([]irq.AffinityFile{irq.DefaultAffinity(s.progArgs.ProcfsRoot)}, files...)
+
+	var changes []irqChange
+	for _, file := range files {
+		original, affinity, err := file.Read()
+		if errors.Is(err, os.ErrNotExist) {
+			// The IRQ was freed since the IRQs were listed.
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read affinity of %s: %v", file.Path, err)
+		}
+		cpus := affinity.Difference(isolated)
+		if cpus.Equals(affinity) {
+			continue
+		}
+		if cpus.IsEmpty() {
+			klog.Warningf("Not isolating CPUs %s from %s, which may only run on them", isolated, file.Path)
+			continue
+		}
+		actionType := tuningIRQAffinity
+		if file.Mask {
+			actionType = tuningDefaultIRQAffinity
+		}
+		changes = append(changes, irqChange{
+			file:   file,
+			cpus:   cpus,
+			action: TuningAction{Type: actionType, Path: file.Path, Original: original},
+		})
+	}
+	return changes, nil
+}
+
+// applyIRQChanges changes the affinity of the IRQs. IRQs whose affinity the
+// kernel refuses to change, such as managed IRQs, are skipped.
+func applyIRQChanges(changes []irqChange) error {
+	for _, change := range changes {
+		err := change.file.Write(change.cpus)
+		switch {
+		case errors.Is(err, syscall.EIO):
+			klog.V(4).Infof("Affinity of %s cannot be changed, skipping it", change.file.Path)
+		case errors.Is(err, os.ErrNotExist):
+			klog.V(4).Infof("IRQ of %s was freed, skipping it", change.file.Path)
+		case err != nil:
+			return fmt.Errorf("unable to set affinity of %s: %v", change.file.Path, err)
+		}
+	}
+	return nil
+}
+
+// undoIRQAffinity gives back to an IRQ the isolated CPUs it could run on
+// before the claim was prepared. Only those CPUs are added back, so that the
+// isolation of the claims prepared since is preserved, and the original
+// affinity is restored as it was read once no other claim isolates CPUs.
+func undoIRQAffinity(action TuningAction, isolated cpuset.CPUSet) error {
+	file := irq.AffinityFile{Path: action.Path, Mask: action.Type == tuningDefaultIRQAffinity}
+	original, err := file.Parse(action.Original)
+	if err != nil {
+		return err
+	}
+	_, current, err := file.Read()
+	if errors.Is(err, os.ErrNotExist) {
+		// The IRQ was freed, there is nothing to restore.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	restored := current.Union(original.Intersection(isolated))
+	switch {
+	case restored.Equals(current):
+		return nil
+	case restored.Equals(original):
+		err = os.WriteFile(action.Path, []byte(action.Original), 0644)
+	default:
+		err = file.Write(restored)
+	}
+	if errors.Is(err, syscall.EIO) {
+		klog.V(4).Infof("Affinity of %s cannot be changed, skipping it", action.Path)
+		return nil
+	}
+	return err
+}
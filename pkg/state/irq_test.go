@@ -0,0 +1,152 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/utils/cpuset"
+
+	configapi "github.com/Tal-or/dra-cpu-driver/api/manager.cpu.com/resource/cpu/v1alpha1"
+	"github.com/Tal-or/dra-cpu-driver/pkg/config"
+	"github.com/Tal-or/dra-cpu-driver/pkg/discovery"
+	"github.com/Tal-or/dra-cpu-driver/pkg/topology"
+)
+
+// testIRQs is the initial content of the affinity files of the fake procfs.
+var testIRQs = map[string]string{
+	"irq/default_smp_affinity": "0000000f",
+	"irq/0/smp_affinity_list":  "0-3",
+	"irq/1/smp_affinity_list":  "2",
+	"irq/2/smp_affinity_list":  "0,3",
+	"irq/3/smp_affinity_list":  "0",
+	"irq/10/smp_affinity_list": "1",
+	"irq/11/smp_affinity_list": "0-1",
+	"irq/not-an-irq/spurious":  "0",
+}
+
+func newFakeProcfs(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	for path, content := range testIRQs {
+		full := filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// readIRQs returns the content of the affinity files of the fake procfs.
+func readIRQs(t *testing.T, root string) map[string]string {
+	t.Helper()
+	irqs := make(map[string]string)
+	for path := range testIRQs {
+		data, err := os.ReadFile(filepath.Join(root, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		irqs[path] = strings.TrimSpace(string(data))
+	}
+	return irqs
+}
+
+// newIRQIsolationTestState returns a state with two allocatable CPUs whose
+// IRQs live in the fake procfs at procfsRoot.
+func newIRQIsolationTestState(t *testing.T, cdiRoot, checkpointDir, procfsRoot string, faults *faultInjector) *DeviceState {
+	t.Helper()
+	s := newTestState(t, cdiRoot, checkpointDir, faults)
+	s.progArgs.ProcfsRoot = procfsRoot
+	s.Allocatable["cpu-1"] = &discovery.AllocatableDevice{Pool: config.AllocatablePool, CPUs: cpuset.New(1)}
+	s.topology.CPUs[1] = &topology.CPUInfo{ID: 1}
+	return s
+}
+
+func TestIRQIsolation(t *testing.T) {
+	procfsRoot := newFakeProcfs(t)
+	original := readIRQs(t, procfsRoot)
+	s := newIRQIsolationTestState(t, t.TempDir(), t.TempDir(), procfsRoot, &faultInjector{})
+
+	_, err := s.Prepare(newConfiguredTestClaim("uid-0", "cpu-0", &configapi.CpuConfig{IRQIsolation: true}))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"irq/default_smp_affinity": "0000000e",
+		"irq/0/smp_affinity_list":  "1-3",
+		"irq/1/smp_affinity_list":  "2",
+		"irq/2/smp_affinity_list":  "3",
+		// There is nowhere to move an IRQ running only on CPU 0.
+		"irq/3/smp_affinity_list":  "0",
+		"irq/10/smp_affinity_list": "1",
+		"irq/11/smp_affinity_list": "1",
+		"irq/not-an-irq/spurious":  "0",
+	}, readIRQs(t, procfsRoot))
+	assert.Equal(t, []TuningAction{
+		{Type: tuningDefaultIRQAffinity, Path: filepath.Join(procfsRoot, "irq/default_smp_affinity"), Original: "0000000f"},
+		{Type: tuningIRQAffinity, Path: filepath.Join(procfsRoot, "irq/0/smp_affinity_list"), Original: "0-3"},
+		{Type: tuningIRQAffinity, Path: filepath.Join(procfsRoot, "irq/2/smp_affinity_list"), Original: "0,3"},
+		{Type: tuningIRQAffinity, Path: filepath.Join(procfsRoot, "irq/11/smp_affinity_list"), Original: "0-1"},
+	}, s.claims.get("uid-0").TuningActions)
+
+	_, err = s.Prepare(newConfiguredTestClaim("uid-1", "cpu-1", &configapi.CpuConfig{IRQIsolation: true}))
+	assert.NoError(t, err)
+	irqs := readIRQs(t, procfsRoot)
+	assert.Equal(t, "0000000c", irqs["irq/default_smp_affinity"])
+	assert.Equal(t, "2-3", irqs["irq/0/smp_affinity_list"])
+	assert.Equal(t, "1", irqs["irq/11/smp_affinity_list"], "IRQ running only on isolated CPUs must not be moved")
+
+	// Unpreparing the first claim gives its CPU back without undoing the
+	// isolation of the second one.
+	assert.NoError(t, s.Unprepare("uid-0"))
+	irqs = readIRQs(t, procfsRoot)
+	assert.Equal(t, "0000000d", irqs["irq/default_smp_affinity"])
+	assert.Equal(t, "0,2-3", irqs["irq/0/smp_affinity_list"])
+
+	assert.NoError(t, s.Unprepare("uid-1"))
+	assert.Equal(t, original, readIRQs(t, procfsRoot))
+}
+
+func TestIRQIsolationRecovery(t *testing.T) {
+	// Record the claim, write the CDI spec file, record the tuning actions,
+	// change the IRQ affinities, complete the claim.
+	const prepareSteps = 5
+
+	for failAt := 3; failAt <= prepareSteps; failAt++ {
+		t.Run(fmt.Sprintf("step=%d", failAt), func(t *testing.T) {
+			cdiRoot, checkpointDir, procfsRoot := t.TempDir(), t.TempDir(), newFakeProcfs(t)
+			original := readIRQs(t, procfsRoot)
+			claim := newConfiguredTestClaim("uid-0", "cpu-0", &configapi.CpuConfig{IRQIsolation: true})
+
+			s := newIRQIsolationTestState(t, cdiRoot, checkpointDir, procfsRoot, &faultInjector{failAt: failAt, crash: true})
+			_, err := s.Prepare(claim)
+			assert.Error(t, err)
+
+			// Restart: the interrupted preparation is rolled back.
+			s = newIRQIsolationTestState(t, cdiRoot, checkpointDir, procfsRoot, &faultInjector{})
+			assert.False(t, assertConsistent(t, s, string(claim.UID)))
+			assert.Equal(t, original, readIRQs(t, procfsRoot))
+		})
+	}
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import "sync"
+
+// claimLocks serializes the operations on each claim, while operations on
+// different claims run concurrently.
+type claimLocks struct {
+	mutex sync.Mutex
+	locks map[string]*claimLock
+}
+
+type claimLock struct {
+	sync.Mutex
+	// users counts the goroutines holding or waiting for the lock, so that
+	// it can be dropped once unused.
+	users int
+}
+
+// lock locks a claim and returns the function unlocking it.
+func (l *claimLocks) lock(claimUID string) func() {
+	l.mutex.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*claimLock)
+	}
+	lock, exists := l.locks[claimUID]
+	if !exists {
+		lock = &claimLock{}
+		l.locks[claimUID] = lock
+	}
+	lock.users++
+	l.mutex.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		l.mutex.Lock()
+		lock.users--
+		if lock.users == 0 {
+			delete(l.locks, claimUID)
+		}
+		l.mutex.Unlock()
+	}
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"k8s.io/klog/v2"
+
+	"github.com/Tal-or/dra-cpu-driver/pkg/devices"
+)
+
+// CPUOwner is a claim using a CPU through one of its prepared devices.
+type CPUOwner struct {
+	ClaimUID string
+	Device   string
+	// Exclusive is set when the claim owns the CPU, in which case it is the
+	// only claim using it.
+	Exclusive bool
+}
+
+func (o CPUOwner) String() string {
+	mode := "shared"
+	if o.Exclusive {
+		mode = "exclusive"
+	}
+	return fmt.Sprintf("claim %s (device %s, %s)", o.ClaimUID, o.Device, mode)
+}
+
+// ownershipIndex maps every CPU to the claims it is prepared for. A CPU is
+// either used by a single exclusive owner, or shared by any number of
+// non-exclusive ones. The index is rebuilt from the checkpoint at startup and
+// kept in sync with it by Prepare and Unprepare, so that a claim whose CPUs
+// are already prepared for another claim is refused instead of silently
+// double-booking them.
+type ownershipIndex map[int][]CPUOwner
+
+// newOwnershipIndex builds the index from the prepared claims. Conflicts
+// already present in the checkpoint are reported but do not prevent the
+// driver from starting: unpreparing the claims resolves them.
+func newOwnershipIndex(preparedClaims devices.PreparedClaims) (ownershipIndex, error) {
+	index := make(ownershipIndex)
+	for claimUID, preparedDevices := range preparedClaims {
+		if err := index.check(claimUID, preparedDevices); err != nil {
+			klog.Warningf("Prepared claims conflict: %v", err)
+		}
+		if err := index.add(claimUID, preparedDevices); err != nil {
+			return nil, err
+		}
+	}
+	return index, nil
+}
+
+// check returns an error if preparing the devices for the claim would break
+// the exclusivity of a CPU.
+func (index ownershipIndex) check(claimUID string, preparedDevices devices.PreparedDevices) error {
+	for _, device := range preparedDevices {
+		cpus, err := device.CPUSet()
+		if err != nil {
+			return fmt.Errorf("invalid CPUs of device %s: %v", device.DeviceName, err)
+		}
+		exclusive := isExclusive(device)
+		for _, cpu := range cpus.List() {
+			var conflicts []string
+			for _, owner := range index[cpu] {
+				if owner.ClaimUID == claimUID || (!exclusive && !owner.Exclusive) {
+					continue
+				}
+				conflicts = append(conflicts, owner.String())
+			}
+			if len(conflicts) > 0 {
+				return fmt.Errorf("CPU %d of device %s is already prepared for %s", cpu, device.DeviceName, strings.Join(conflicts, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+func (index ownershipIndex) add(claimUID string, preparedDevices devices.PreparedDevices) error {
+	for _, device := range preparedDevices {
+		cpus, err := device.CPUSet()
+		if err != nil {
+			return fmt.Errorf("invalid CPUs of device %s prepared for claim %s: %v", device.DeviceName, claimUID, err)
+		}
+		for _, cpu := range cpus.List() {
+			index[cpu] = append(index[cpu], CPUOwner{
+				ClaimUID:  claimUID,
+				Device:    device.DeviceName,
+				Exclusive: isExclusive(device),
+			})
+		}
+	}
+	return nil
+}
+
+func (index ownershipIndex) remove(claimUID string) {
+	for cpu, owners := range index {
+		owners = slices.DeleteFunc(owners, func(owner CPUOwner) bool {
+			return owner.ClaimUID == claimUID
+		})
+		if len(owners) == 0 {
+			delete(index, cpu)
+		} else {
+			index[cpu] = owners
+		}
+	}
+}
+
+// CPUOwners returns the claims a CPU is currently prepared for.
+func (s *DeviceState) CPUOwners(cpu int) []CPUOwner {
+	s.Lock()
+	defer s.Unlock()
+	return slices.Clone(s.owners[cpu])
+}
+
+// Ownership returns the claims every prepared CPU is prepared for.
+func (s *DeviceState) Ownership() map[int][]CPUOwner {
+	s.Lock()
+	defer s.Unlock()
+
+	ownership := make(map[int][]CPUOwner, len(s.owners))
+	for cpu, owners := range s.owners {
+		ownership[cpu] = slices.Clone(owners)
+	}
+	return ownership
+}
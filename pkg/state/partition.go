@@ -0,0 +1,188 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"k8s.io/utils/cpuset"
+
+	configapi "github.com/Tal-or/dra-cpu-driver/api/manager.cpu.com/resource/cpu/v1alpha1"
+	"github.com/Tal-or/dra-cpu-driver/pkg/devices"
+)
+
+// tuningCPUPartition is the cgroup v2 cpuset partition created for the
+// exclusive CPUs of a claim.
+const tuningCPUPartition = "cpuPartition"
+
+const (
+	// partitionPrefix is the prefix of the names of the partitions created
+	// by the driver, which are named after the claim they are created for.
+	partitionPrefix = "dra-cpu-"
+
+	subtreeControlFile = "cgroup.subtree_control"
+	cpusFile           = "cpuset.cpus"
+	partitionFile      = "cpuset.cpus.partition"
+
+	partitionIsolated = "isolated"
+)
+
+// cpuPartitions creates the isolated cpuset partitions backing the exclusive
+// CPUs of claims under the cgroup v2 root, so that the scheduler stops load
+// balancing onto them. Only the root is a partition itself, and so can have
+// partition children: the CPUs of a partition are taken from all the other
+// cgroups of the root, the pods of the kubelet included. The containers of a
+// claim are created inside its partition by the NRI plugin to keep them, see
+// ContainerPartition, and so outside of their pod cgroup, whose limits, stats
+// and eviction accounting no longer cover them. This is why partitions are
+// only created when explicitly enabled.
+type cpuPartitions struct {
+	root string
+	// writeFile writes a cgroup interface file.
+	writeFile func(path string, data []byte) error
+	// removeDir removes a cgroup directory. The kernel removes its
+	// interface files along with it.
+	removeDir func(path string) error
+}
+
+func newCPUPartitions(root string) *cpuPartitions {
+	return &cpuPartitions{
+		root: root,
+		writeFile: func(path string, data []byte) error {
+			return os.WriteFile(path, data, 0644)
+		},
+		removeDir: os.Remove,
+	}
+}
+
+// path returns the cgroup directory of the partition of a claim.
+func (p *cpuPartitions) path(claimUID string) string {
+	return filepath.Join(p.root, partitionPrefix+claimUID)
+}
+
+// create makes the cgroup at path an isolated partition of cpus. The kernel
+// accepts any partition request, but reports in the partition file whether
+// it could honour it, e.g. "isolated invalid (Cpu list in cpuset.cpus not
+// exclusive)", which is turned into an error.
+func (p *cpuPartitions) create(path string, cpus cpuset.CPUSet) error {
+	data, err := os.ReadFile(filepath.Join(p.root, subtreeControlFile))
+	if err != nil {
+		return fmt.Errorf("unable to read enabled cgroup controllers: %w", err)
+	}
+	if !slices.Contains(strings.Fields(string(data)), "cpuset") {
+		if err := p.writeFile(filepath.Join(p.root, subtreeControlFile), []byte("+cpuset")); err != nil {
+			return fmt.Errorf("unable to enable the cpuset controller: %w", err)
+		}
+	}
+
+	if err := os.Mkdir(path, 0755); err != nil && !errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("unable to create cgroup %s: %w", path, err)
+	}
+	if err := p.writeFile(filepath.Join(path, cpusFile), []byte(cpus.String())); err != nil {
+		return fmt.Errorf("unable to set CPUs %s of cgroup %s: %w", cpus, path, err)
+	}
+	if err := p.writeFile(filepath.Join(path, partitionFile), []byte(partitionIsolated)); err != nil {
+		return fmt.Errorf("unable to make cgroup %s an isolated partition: %w", path, err)
+	}
+
+	data, err = os.ReadFile(filepath.Join(path, partitionFile))
+	if err != nil {
+		return fmt.Errorf("unable to read partition state of cgroup %s: %w", path, err)
+	}
+	if state := strings.TrimSpace(string(data)); state != partitionIsolated {
+		return fmt.Errorf("cgroup %s is not a valid isolated partition of CPUs %s: %s", path, cpus, state)
+	}
+	return nil
+}
+
+// remove removes the partition at path, its CPUs go back to the root
+// partition. Removing a partition that does not exist is not an error, while
+// a partition still holding containers cannot be removed.
+func (p *cpuPartitions) remove(path string) error {
+	if err := p.removeDir(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("unable to remove cgroup %s: %w", path, err)
+	}
+	return nil
+}
+
+// partitionCPUs returns the CPUs to back with an isolated partition, i.e.
+// the CPUs of the devices pinned exclusively, when partitions are enabled.
+func (s *DeviceState) partitionCPUs(preparedDevices devices.PreparedDevices) (cpuset.CPUSet, error) {
+	if !s.progArgs.CPUPartitions {
+		return cpuset.New(), nil
+	}
+	return exclusiveCPUs(preparedDevices)
+}
+
+// ContainerPartition returns the cgroup, relative to the cgroup v2 root, of
+// the partition a container of the pod with the given UID must be created in
+// to keep its CPUs, or an empty string when the container uses no CPU of a
+// partition. A container cannot be pinned both to CPUs of a partition and to
+// CPUs outside of it.
+func (s *DeviceState) ContainerPartition(podUID string, env []string) (string, error) {
+	cpus, _, err := s.ContainerCPUs(podUID, env)
+	if err != nil || cpus.IsEmpty() {
+		return "", err
+	}
+
+	for claimUID, claim := range s.claims.all() {
+		index := slices.IndexFunc(claim.TuningActions, func(action TuningAction) bool {
+			return action.Type == tuningCPUPartition
+		})
+		if index < 0 {
+			continue
+		}
+		partitioned, err := exclusiveCPUs(claim.Devices)
+		if err != nil {
+			return "", fmt.Errorf("claim %s: %w", claimUID, err)
+		}
+		if cpus.Intersection(partitioned).IsEmpty() {
+			continue
+		}
+		if !cpus.IsSubsetOf(partitioned) {
+			return "", fmt.Errorf("container pinned to CPUs %s cannot be created in the partition of CPUs %s of claim %s", cpus, partitioned, claimUID)
+		}
+		partition, err := filepath.Rel(s.partitions.root, claim.TuningActions[index].Path)
+		if err != nil {
+			return "", err
+		}
+		return "/" + partition, nil
+	}
+	return "", nil
+}
+
+// exclusiveCPUs returns the CPUs of the devices pinned exclusively.
+func exclusiveCPUs(preparedDevices devices.PreparedDevices) (cpuset.CPUSet, error) {
+	cpus := cpuset.New()
+	for _, device := range preparedDevices {
+		if device.Pinning != string(configapi.ExclusivePinning) {
+			continue
+		}
+		deviceCPUs, err := device.CPUSet()
+		if err != nil {
+			return cpuset.New(), fmt.Errorf("invalid CPUs of device %s: %w", device.DeviceName, err)
+		}
+		cpus = cpus.Union(deviceCPUs)
+	}
+	return cpus, nil
+}
@@ -0,0 +1,279 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+
+	resourceapi "k8s.io/api/resource/v1beta1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/cpuset"
+
+	"github.com/Tal-or/dra-cpu-driver/pkg/config"
+	"github.com/Tal-or/dra-cpu-driver/pkg/discovery"
+	"github.com/Tal-or/dra-cpu-driver/pkg/topology"
+)
+
+// newFakeCgroupfs returns a cgroup v2 root with a sibling cgroup holding CPU
+// 1, and partitions writing their partition file as the kernel does: a
+// partition of CPUs also used by a sibling is invalid.
+func newFakeCgroupfs(t *testing.T) *cpuPartitions {
+	t.Helper()
+	root := t.TempDir()
+	files := map[string]string{
+		"cgroup.subtree_control":   "cpu memory\n",
+		"system.slice/cpuset.cpus": "1\n",
+	}
+	for path, content := range files {
+		full := filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	partitions := newCPUPartitions(root)
+	partitions.writeFile = func(path string, data []byte) error {
+		if filepath.Base(path) == partitionFile {
+			state, err := fakePartitionState(filepath.Dir(path), string(data))
+			if err != nil {
+				return err
+			}
+			data = []byte(state + "\n")
+		}
+		return os.WriteFile(path, data, 0644)
+	}
+	// The kernel refuses to remove a cgroup with children, and removes the
+	// interface files of the others along with their directory.
+	partitions.removeDir = func(path string) error {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				return &fs.PathError{Op: "remove", Path: path, Err: unix.EBUSY}
+			}
+		}
+		return os.RemoveAll(path)
+	}
+	return partitions
+}
+
+func fakePartitionState(cgroup, partition string) (string, error) {
+	cpus, err := readCgroupCPUs(cgroup)
+	if err != nil {
+		return "", err
+	}
+	siblings, err := os.ReadDir(filepath.Dir(cgroup))
+	if err != nil {
+		return "", err
+	}
+	for _, sibling := range siblings {
+		path := filepath.Join(filepath.Dir(cgroup), sibling.Name())
+		if !sibling.IsDir() || path == cgroup {
+			continue
+		}
+		siblingCPUs, err := readCgroupCPUs(path)
+		if err != nil {
+			return "", err
+		}
+		if !cpus.Intersection(siblingCPUs).IsEmpty() {
+			return partition + " invalid (Cpu list in cpuset.cpus not exclusive)", nil
+		}
+	}
+	return partition, nil
+}
+
+func readCgroupCPUs(cgroup string) (cpuset.CPUSet, error) {
+	data, err := os.ReadFile(filepath.Join(cgroup, cpusFile))
+	if err != nil {
+		return cpuset.New(), err
+	}
+	return cpuset.Parse(strings.TrimSpace(string(data)))
+}
+
+func TestCPUPartitions(t *testing.T) {
+	partitions := newFakeCgroupfs(t)
+	s := newTestState(t, t.TempDir(), t.TempDir(), &faultInjector{}, func(s *DeviceState) {
+		s.progArgs.CPUPartitions = true
+		s.partitions = partitions
+		s.Allocatable["cpu-1"] = &discovery.AllocatableDevice{Pool: config.AllocatablePool, CPUs: cpuset.New(1)}
+		s.topology.CPUs[1] = &topology.CPUInfo{ID: 1}
+	})
+	readFile := func(path string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(partitions.root, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimSpace(string(data))
+	}
+
+	claim := newTestClaim()
+	_, err := s.Prepare(claim)
+	assert.NoError(t, err)
+	assert.Equal(t, []TuningAction{
+		{Type: tuningCPUPartition, Path: filepath.Join(partitions.root, "dra-cpu-uid-0")},
+	}, s.claims.get("uid-0").TuningActions)
+	assert.Equal(t, "+cpuset", readFile("cgroup.subtree_control"))
+	assert.Equal(t, "0", readFile("dra-cpu-uid-0/cpuset.cpus"))
+	assert.Equal(t, "isolated", readFile("dra-cpu-uid-0/cpuset.cpus.partition"))
+
+	// CPU 1 is also used by another cgroup.
+	invalid := newTestClaim()
+	invalid.UID = types.UID("uid-1")
+	invalid.Status.Allocation.Devices.Results[0].Device = "cpu-1"
+	_, err = s.Prepare(invalid)
+	assert.ErrorContains(t, err, "isolated invalid (Cpu list in cpuset.cpus not exclusive)")
+	assert.False(t, assertConsistent(t, s, "uid-1"))
+	assert.NoDirExists(t, filepath.Join(partitions.root, "dra-cpu-uid-1"))
+
+	assert.NoError(t, s.Unprepare("uid-0"))
+	assert.NoDirExists(t, filepath.Join(partitions.root, "dra-cpu-uid-0"))
+
+	// Partitions are only created when enabled.
+	s.progArgs.CPUPartitions = false
+	_, err = s.Prepare(claim)
+	assert.NoError(t, err)
+	assert.Empty(t, s.claims.get("uid-0").TuningActions)
+	assert.NoDirExists(t, filepath.Join(partitions.root, "dra-cpu-uid-0"))
+}
+
+// effectiveCPUs returns the CPUs the processes of the cgroup at path, relative
+// to the root of partitions, can run on when the root has cpus, as the kernel
+// computes them: the CPUs of a valid isolated partition are taken from all
+// the other cgroups of its parent.
+func effectiveCPUs(t *testing.T, partitions *cpuPartitions, path string, cpus cpuset.CPUSet) cpuset.CPUSet {
+	t.Helper()
+	parent := partitions.root
+	for _, name := range strings.Split(strings.Trim(path, "/"), "/") {
+		siblings, err := os.ReadDir(parent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, sibling := range siblings {
+			if !sibling.IsDir() || sibling.Name() == name {
+				continue
+			}
+			siblingPath := filepath.Join(parent, sibling.Name())
+			data, err := os.ReadFile(filepath.Join(siblingPath, partitionFile))
+			if err != nil || strings.TrimSpace(string(data)) != partitionIsolated {
+				continue
+			}
+			siblingCPUs, err := readCgroupCPUs(siblingPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cpus = cpus.Difference(siblingCPUs)
+		}
+		parent = filepath.Join(parent, name)
+		own, err := readCgroupCPUs(parent)
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		if !own.IsEmpty() {
+			cpus = cpus.Intersection(own)
+		}
+	}
+	return cpus
+}
+
+func TestCPUPartitionContainers(t *testing.T) {
+	partitions := newFakeCgroupfs(t)
+	s := newTestState(t, t.TempDir(), t.TempDir(), &faultInjector{}, func(s *DeviceState) {
+		s.progArgs.CPUPartitions = true
+		s.partitions = partitions
+		s.Allocatable["cpu-2"] = &discovery.AllocatableDevice{Pool: config.AllocatablePool, CPUs: cpuset.New(2)}
+		s.topology.CPUs[2] = &topology.CPUInfo{ID: 2}
+	})
+	newPodClaim := func(uid, device string) *resourceapi.ResourceClaim {
+		claim := newTestClaim()
+		claim.UID = types.UID(uid)
+		claim.Status.Allocation.Devices.Results[0].Device = device
+		claim.Status.ReservedFor = []resourceapi.ResourceClaimConsumerReference{
+			{Resource: "pods", Name: "pod-0", UID: "pod-uid-0"},
+		}
+		return claim
+	}
+	claimEnv := func(uid string) []string {
+		var env []string
+		for _, device := range s.claims.get(uid).Devices {
+			env = append(env, device.ContainerEdits.Env...)
+		}
+		return env
+	}
+	mkCgroup := func(path, cpus string) {
+		t.Helper()
+		full := filepath.Join(partitions.root, path)
+		if err := os.MkdirAll(full, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(full, cpusFile), []byte(cpus+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	nodeCPUs := cpuset.New(0, 1, 2, 3)
+
+	_, err := s.Prepare(newPodClaim("uid-0", "cpu-0"))
+	assert.NoError(t, err)
+	env := claimEnv("uid-0")
+	partition, err := s.ContainerPartition("pod-uid-0", env)
+	assert.NoError(t, err)
+	assert.Equal(t, "/dra-cpu-uid-0", partition)
+
+	// The container keeps its CPUs in the partition, where the runtime would
+	// have created it, it would have none left.
+	mkCgroup(filepath.Join(partition, "ctr-0"), "0")
+	assert.Equal(t, cpuset.New(0), effectiveCPUs(t, partitions, filepath.Join(partition, "ctr-0"), nodeCPUs))
+	mkCgroup("kubepods/podpod-uid-0/ctr-0", "0")
+	assert.True(t, effectiveCPUs(t, partitions, "kubepods/podpod-uid-0/ctr-0", nodeCPUs).IsEmpty())
+
+	// Containers using no CPU of a partition are left alone.
+	partition, err = s.ContainerPartition("pod-uid-0", []string{"PATH=/bin"})
+	assert.NoError(t, err)
+	assert.Empty(t, partition)
+
+	// A container cannot use CPUs of a partition and others.
+	s.progArgs.CPUPartitions = false
+	_, err = s.Prepare(newPodClaim("uid-2", "cpu-2"))
+	assert.NoError(t, err)
+	partition, err = s.ContainerPartition("pod-uid-0", claimEnv("uid-2"))
+	assert.NoError(t, err)
+	assert.Empty(t, partition)
+	_, err = s.ContainerPartition("pod-uid-0", append(env, claimEnv("uid-2")...))
+	assert.Error(t, err)
+
+	// The partition cannot be removed while it holds the container.
+	assert.ErrorIs(t, partitions.remove(partitions.path("uid-0")), unix.EBUSY)
+	assert.Error(t, s.Unprepare("uid-0"))
+	if err := partitions.removeDir(filepath.Join(partitions.path("uid-0"), "ctr-0")); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, s.Unprepare("uid-0"))
+	assert.NoDirExists(t, partitions.path("uid-0"))
+	assert.NoError(t, partitions.remove(partitions.path("uid-0")), "partition already removed")
+}
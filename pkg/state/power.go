@@ -0,0 +1,221 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"k8s.io/utils/cpuset"
+	"k8s.io/utils/ptr"
+
+	configapi "github.com/Tal-or/dra-cpu-driver/api/manager.cpu.com/resource/cpu/v1alpha1"
+	"github.com/Tal-or/dra-cpu-driver/pkg/devices"
+	"github.com/Tal-or/dra-cpu-driver/pkg/topology"
+)
+
+// Types of the tuning actions applying power profiles.
+const (
+	tuningGovernor      = "cpufreqGovernor"
+	tuningMinFrequency  = "cpufreqMinFrequency"
+	tuningMaxFrequency  = "cpufreqMaxFrequency"
+	tuningResumeLatency = "pmQosResumeLatency"
+)
+
+// noResumeLatency is written to pm_qos_resume_latency_us to allow no resume
+// latency at all, i.e. to disable every idle state but polling. Writing 0
+// would remove the constraint instead.
+const noResumeLatency = "n/a"
+
+// fileChange is a write to a sysfs file about to be made for a claim.
+type fileChange struct {
+	action TuningAction
+	value  string
+}
+
+// hasPowerProfile tells whether any device was prepared with a power
+// profile.
+func hasPowerProfile(preparedDevices devices.PreparedDevices) bool {
+	return slices.ContainsFunc(preparedDevices, func(device *devices.PreparedDevice) bool {
+		return device.PowerProfile != nil
+	})
+}
+
+// planPowerProfiles returns the changes applying the power profile of every
+// device to its CPUs. The frequency settings are shared by all the CPUs of a
+// cpufreq policy, which must then all be part of the claim with the same
+// profile.
+func (s *DeviceState) planPowerProfiles(preparedDevices devices.PreparedDevices) ([]fileChange, error) {
+	profiles := make(map[int]*configapi.PowerProfile)
+	for _, device := range preparedDevices {
+		if device.PowerProfile == nil {
+			continue
+		}
+		cpus, err := device.CPUSet()
+		if err != nil {
+			return nil, fmt.Errorf("invalid CPUs of device %s: %w", device.DeviceName, err)
+		}
+		for _, cpu := range cpus.List() {
+			profiles[cpu] = device.PowerProfile
+		}
+	}
+
+	var changes []fileChange
+	planned := cpuset.New()
+	for _, cpu := range slices.Sorted(maps.Keys(profiles)) {
+		profile := profiles[cpu]
+		info, err := s.topology.CPU(cpu)
+		if err != nil {
+			return nil, err
+		}
+
+		if setsFrequency(profile) && !planned.Contains(cpu) {
+			if info.Freq == nil {
+				return nil, fmt.Errorf("CPU %d has no cpufreq driver", cpu)
+			}
+			for _, other := range info.Freq.PolicyCPUs.List() {
+				if otherProfile, exists := profiles[other]; !exists || !setsSameFrequency(profile, otherProfile) {
+					return nil, fmt.Errorf("cpufreq policy of CPU %d is shared with CPU %d, which does not get the same power profile", cpu, other)
+				}
+			}
+			planned = planned.Union(info.Freq.PolicyCPUs).Union(cpuset.New(cpu))
+
+			frequencyChanges, err := s.planFrequency(cpu, info.Freq, profile)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, frequencyChanges...)
+		}
+
+		if profile.ResumeLatencyUs != nil {
+			value := strconv.FormatInt(*profile.ResumeLatencyUs, 10)
+			if *profile.ResumeLatencyUs == 0 {
+				value = noResumeLatency
+			}
+			change, err := newFileChange(tuningResumeLatency, filepath.Join(topology.CPUPowerDir(s.progArgs.SysfsRoot, cpu), "pm_qos_resume_latency_us"), value)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, change)
+		}
+	}
+	return changes, nil
+}
+
+// planFrequency returns the changes applying the governor and frequency
+// limits of a profile to the cpufreq policy of a CPU.
+func (s *DeviceState) planFrequency(cpu int, freq *topology.CPUFreq, profile *configapi.PowerProfile) ([]fileChange, error) {
+	dir := topology.CPUFreqDir(s.progArgs.SysfsRoot, cpu)
+
+	var changes []fileChange
+	if profile.Governor != "" {
+		if !slices.Contains(freq.Governors, profile.Governor) {
+			return nil, fmt.Errorf("cpufreq governor %q is not available on CPU %d", profile.Governor, cpu)
+		}
+		change, err := newFileChange(tuningGovernor, filepath.Join(dir, "scaling_governor"), profile.Governor)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+
+	var minChange, maxChange *fileChange
+	if profile.MinFrequencyKHz != nil {
+		change, err := newFrequencyChange(cpu, freq, tuningMinFrequency, filepath.Join(dir, "scaling_min_freq"), *profile.MinFrequencyKHz)
+		if err != nil {
+			return nil, err
+		}
+		minChange = &change
+	}
+	if profile.MaxFrequencyKHz != nil {
+		change, err := newFrequencyChange(cpu, freq, tuningMaxFrequency, filepath.Join(dir, "scaling_max_freq"), *profile.MaxFrequencyKHz)
+		if err != nil {
+			return nil, err
+		}
+		maxChange = &change
+	}
+
+	switch {
+	case minChange != nil && maxChange != nil:
+		// The kernel refuses a minimum above the current maximum, the
+		// maximum is raised first in that case. Undoing the changes in
+		// reverse order then lowers the minimum first.
+		currentMax, err := strconv.ParseInt(maxChange.action.Original, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid maximum frequency %q of CPU %d: %v", maxChange.action.Original, cpu, err)
+		}
+		if *profile.MinFrequencyKHz > currentMax {
+			changes = append(changes, *maxChange, *minChange)
+		} else {
+			changes = append(changes, *minChange, *maxChange)
+		}
+	case minChange != nil:
+		changes = append(changes, *minChange)
+	case maxChange != nil:
+		changes = append(changes, *maxChange)
+	}
+	return changes, nil
+}
+
+// newFrequencyChange returns the change of a frequency limit of a CPU,
+// which must be within the hardware limits.
+func newFrequencyChange(cpu int, freq *topology.CPUFreq, actionType, path string, kHz int64) (fileChange, error) {
+	if kHz < freq.MinKHz || kHz > freq.MaxKHz {
+		return fileChange{}, fmt.Errorf("frequency %d kHz is outside of the range %d-%d kHz of CPU %d", kHz, freq.MinKHz, freq.MaxKHz, cpu)
+	}
+	return newFileChange(actionType, path, strconv.FormatInt(kHz, 10))
+}
+
+// newFileChange returns the change of a sysfs file to value, recording its
+// current content to restore it.
+func newFileChange(actionType, path, value string) (fileChange, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fileChange{}, fmt.Errorf("unable to read %s: %v", path, err)
+	}
+	return fileChange{
+		action: TuningAction{Type: actionType, Path: path, Original: strings.TrimSpace(string(data))},
+		value:  value,
+	}, nil
+}
+
+// applyFileChanges writes the files in order.
+func applyFileChanges(changes []fileChange) error {
+	for _, change := range changes {
+		if err := os.WriteFile(change.action.Path, []byte(change.value), 0644); err != nil {
+			return fmt.Errorf("unable to write %q to %s: %v", change.value, change.action.Path, err)
+		}
+	}
+	return nil
+}
+
+func setsFrequency(profile *configapi.PowerProfile) bool {
+	return profile.Governor != "" || profile.MinFrequencyKHz != nil || profile.MaxFrequencyKHz != nil
+}
+
+// setsSameFrequency tells whether two profiles set the same governor and
+// frequency limits.
+func setsSameFrequency(a, b *configapi.PowerProfile) bool {
+	return a.Governor == b.Governor &&
+		ptr.Equal(a.MinFrequencyKHz, b.MinFrequencyKHz) &&
+		ptr.Equal(a.MaxFrequencyKHz, b.MaxFrequencyKHz)
+}
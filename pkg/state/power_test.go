@@ -0,0 +1,139 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/utils/cpuset"
+	"k8s.io/utils/ptr"
+
+	configapi "github.com/Tal-or/dra-cpu-driver/api/manager.cpu.com/resource/cpu/v1alpha1"
+	"github.com/Tal-or/dra-cpu-driver/pkg/topology"
+)
+
+// testPowerFiles is the initial content of the power management files of
+// CPU 0 in the fake sysfs.
+var testPowerFiles = map[string]string{
+	"devices/system/cpu/cpu0/cpufreq/scaling_governor":       "powersave",
+	"devices/system/cpu/cpu0/cpufreq/scaling_min_freq":       "800000",
+	"devices/system/cpu/cpu0/cpufreq/scaling_max_freq":       "2000000",
+	"devices/system/cpu/cpu0/power/pm_qos_resume_latency_us": "0",
+}
+
+func readPowerFiles(t *testing.T, root string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	for path := range testPowerFiles {
+		data, err := os.ReadFile(filepath.Join(root, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[path] = strings.TrimSpace(string(data))
+	}
+	return files
+}
+
+func TestPowerProfile(t *testing.T) {
+	tests := map[string]struct {
+		profile   *configapi.PowerProfile
+		policy    cpuset.CPUSet
+		expected  map[string]string
+		expectErr bool
+	}{
+		"all settings": {
+			profile: &configapi.PowerProfile{Governor: "performance", MinFrequencyKHz: ptr.To[int64](3000000), MaxFrequencyKHz: ptr.To[int64](3500000), ResumeLatencyUs: ptr.To[int64](0)},
+			policy:  cpuset.New(0),
+			expected: map[string]string{
+				"devices/system/cpu/cpu0/cpufreq/scaling_governor":       "performance",
+				"devices/system/cpu/cpu0/cpufreq/scaling_min_freq":       "3000000",
+				"devices/system/cpu/cpu0/cpufreq/scaling_max_freq":       "3500000",
+				"devices/system/cpu/cpu0/power/pm_qos_resume_latency_us": noResumeLatency,
+			},
+		},
+		"resume latency only": {
+			profile: &configapi.PowerProfile{ResumeLatencyUs: ptr.To[int64](10)},
+			policy:  cpuset.New(0, 1),
+			expected: map[string]string{
+				"devices/system/cpu/cpu0/cpufreq/scaling_governor":       "powersave",
+				"devices/system/cpu/cpu0/cpufreq/scaling_min_freq":       "800000",
+				"devices/system/cpu/cpu0/cpufreq/scaling_max_freq":       "2000000",
+				"devices/system/cpu/cpu0/power/pm_qos_resume_latency_us": "10",
+			},
+		},
+		"unavailable governor": {
+			profile:   &configapi.PowerProfile{Governor: "schedutil"},
+			policy:    cpuset.New(0),
+			expectErr: true,
+		},
+		"frequency above hardware limit": {
+			profile:   &configapi.PowerProfile{MaxFrequencyKHz: ptr.To[int64](4000000)},
+			policy:    cpuset.New(0),
+			expectErr: true,
+		},
+		"policy shared with a CPU outside of the claim": {
+			profile:   &configapi.PowerProfile{Governor: "performance"},
+			policy:    cpuset.New(0, 1),
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			sysfsRoot := t.TempDir()
+			for path, content := range testPowerFiles {
+				full := filepath.Join(sysfsRoot, path)
+				if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(full, []byte(content+"\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			original := readPowerFiles(t, sysfsRoot)
+
+			s := newTestState(t, t.TempDir(), t.TempDir(), &faultInjector{}, func(s *DeviceState) {
+				s.progArgs.SysfsRoot = sysfsRoot
+				s.topology.CPUs[0].Freq = &topology.CPUFreq{
+					MinKHz:     800000,
+					MaxKHz:     3500000,
+					Governors:  []string{"performance", "powersave"},
+					PolicyCPUs: test.policy,
+				}
+			})
+			claim := newConfiguredTestClaim("uid-0", "cpu-0", &configapi.CpuConfig{PowerProfile: test.profile})
+
+			_, err := s.Prepare(claim)
+			if test.expectErr {
+				assert.Error(t, err)
+				assert.False(t, assertConsistent(t, s, string(claim.UID)))
+				assert.Equal(t, original, readPowerFiles(t, sysfsRoot))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, readPowerFiles(t, sysfsRoot))
+
+			assert.NoError(t, s.Unprepare(string(claim.UID)))
+			assert.Equal(t, original, readPowerFiles(t, sysfsRoot))
+		})
+	}
+}
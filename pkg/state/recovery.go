@@ -0,0 +1,44 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"k8s.io/klog/v2"
+)
+
+// recoverClaims completes the operations interrupted by a crash, as recorded
+// in the checkpoint: claims whose preparation started are rolled back, since
+// the kubelet never got their devices and will prepare them again, and claims
+// whose unpreparation started are unprepared. A claim that cannot be
+// recovered is left in its state, so that the driver still starts and the
+// next Prepare or Unprepare of the claim tries again.
+func (s *DeviceState) recoverClaims() {
+	for _, claimUID := range s.claims.claimUIDs() {
+		switch s.claims.state(claimUID) {
+		case ClaimPrepareStarted:
+			klog.Infof("Rolling back interrupted preparation of claim %s", claimUID)
+			if err := s.unprepareClaim(claimUID); err != nil {
+				klog.Errorf("Unable to roll back claim %s: %v", claimUID, err)
+			}
+		case ClaimUnprepareStarted:
+			klog.Infof("Finishing interrupted unpreparation of claim %s", claimUID)
+			if err := s.unprepareClaim(claimUID); err != nil {
+				klog.Errorf("Unable to unprepare claim %s: %v", claimUID, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,333 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	resourceapi "k8s.io/api/resource/v1beta1"
+	drapbv1 "k8s.io/kubelet/pkg/apis/dra/v1beta1"
+	"k8s.io/kubernetes/pkg/kubelet/checkpointmanager"
+	"k8s.io/utils/cpuset"
+
+	configapi "github.com/Tal-or/dra-cpu-driver/api/manager.cpu.com/resource/cpu/v1alpha1"
+	"github.com/Tal-or/dra-cpu-driver/pkg/config"
+	"github.com/Tal-or/dra-cpu-driver/pkg/devices"
+	"github.com/Tal-or/dra-cpu-driver/pkg/discovery"
+	"github.com/Tal-or/dra-cpu-driver/pkg/housekeeping"
+	"github.com/Tal-or/dra-cpu-driver/pkg/resctrl/resctrltest"
+	"github.com/Tal-or/dra-cpu-driver/pkg/topology"
+)
+
+func TestPrepareFailures(t *testing.T) {
+	// Record the claim, write the CDI spec file, complete the claim.
+	const prepareSteps = 3
+
+	for _, crash := range []bool{false, true} {
+		for failAt := 1; failAt <= prepareSteps; failAt++ {
+			t.Run(fmt.Sprintf("crash=%v step=%d", crash, failAt), func(t *testing.T) {
+				cdiRoot, checkpointDir := t.TempDir(), t.TempDir()
+				claim := newTestClaim()
+
+				faults := &faultInjector{failAt: failAt, crash: crash}
+				s := newTestState(t, cdiRoot, checkpointDir, faults)
+				_, err := s.Prepare(claim)
+				assert.Error(t, err)
+				if !crash {
+					assert.False(t, assertConsistent(t, s, string(claim.UID)))
+				}
+
+				// Restart and let the kubelet retry.
+				s = newTestState(t, cdiRoot, checkpointDir, &faultInjector{})
+				assert.False(t, assertConsistent(t, s, string(claim.UID)))
+				_, err = s.Prepare(claim)
+				assert.NoError(t, err)
+				assert.True(t, assertConsistent(t, s, string(claim.UID)))
+			})
+		}
+	}
+}
+
+func TestUnprepareFailures(t *testing.T) {
+	// Mark the claim as being unprepared, delete the CDI spec file, remove
+	// the claim.
+	const unprepareSteps = 3
+
+	for _, crash := range []bool{false, true} {
+		for failAt := 1; failAt <= unprepareSteps; failAt++ {
+			t.Run(fmt.Sprintf("crash=%v step=%d", crash, failAt), func(t *testing.T) {
+				cdiRoot, checkpointDir := t.TempDir(), t.TempDir()
+				claim := newTestClaim()
+
+				faults := &faultInjector{}
+				s := newTestState(t, cdiRoot, checkpointDir, faults)
+				_, err := s.Prepare(claim)
+				assert.NoError(t, err)
+
+				*faults = faultInjector{failAt: failAt, crash: crash}
+				err = s.Unprepare(string(claim.UID))
+				assert.Error(t, err)
+
+				// Restart: the claim is either still prepared, if
+				// unpreparing never started, or unprepared.
+				s = newTestState(t, cdiRoot, checkpointDir, &faultInjector{})
+				prepared := assertConsistent(t, s, string(claim.UID))
+				assert.Equal(t, failAt == 1, prepared)
+
+				// The kubelet retries.
+				assert.NoError(t, s.Unprepare(string(claim.UID)))
+				assert.False(t, assertConsistent(t, s, string(claim.UID)))
+			})
+		}
+	}
+}
+
+func TestTuningFailures(t *testing.T) {
+	claim := newConfiguredTestClaim("uid-0", "cpu-0", &configapi.CpuConfig{
+		IRQIsolation:          true,
+		HousekeepingIsolation: true,
+		PowerProfile:          &configapi.PowerProfile{Governor: "performance"},
+		RDT:                   &configapi.RDTConfig{CacheWays: 4},
+	})
+
+	for _, crash := range []bool{false, true} {
+		// Fail every step in turn, until preparing the claim takes fewer
+		// steps than failAt.
+		prepared := false
+		for failAt := 1; !prepared; failAt++ {
+			t.Run(fmt.Sprintf("crash=%v step=%d", crash, failAt), func(t *testing.T) {
+				cdiRoot, checkpointDir, sysfsRoot := t.TempDir(), t.TempDir(), t.TempDir()
+				procfsRoot, resctrlRoot, partitions := newFakeProcfs(t), resctrltest.NewFakeResctrl(t, 0), newFakeCgroupfs(t)
+				for path, content := range testPowerFiles {
+					full := filepath.Join(sysfsRoot, path)
+					if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+						t.Fatal(err)
+					}
+					if err := os.WriteFile(full, []byte(content+"\n"), 0644); err != nil {
+						t.Fatal(err)
+					}
+				}
+				cpumask := filepath.Join(sysfsRoot, "devices/virtual/workqueue/cpumask")
+				if err := os.MkdirAll(filepath.Dir(cpumask), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(cpumask, []byte("00000003\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+				readNode := func() []map[string]string {
+					cgroups := readTree(t, partitions.root)
+					// Enabling the cpuset controller is left in place.
+					delete(cgroups, filepath.Join(partitions.root, subtreeControlFile))
+					return []map[string]string{
+						readTree(t, sysfsRoot), readTree(t, procfsRoot), readTree(t, resctrlRoot), cgroups,
+					}
+				}
+				original := readNode()
+
+				newState := func(faults *faultInjector) *DeviceState {
+					return newTestState(t, cdiRoot, checkpointDir, faults, func(s *DeviceState) {
+						s.progArgs.SysfsRoot = sysfsRoot
+						s.progArgs.ProcfsRoot = procfsRoot
+						s.progArgs.ResctrlRoot = resctrlRoot
+						s.progArgs.CPUPartitions = true
+						s.partitions = partitions
+						s.housekeeping = housekeeping.NewManager(sysfsRoot, procfsRoot, false)
+						s.Pools = map[string]*discovery.Pool{config.ReservedPool: {Name: config.ReservedPool, CPUs: cpuset.New(1)}}
+						s.topology.CPUs[0].Freq = &topology.CPUFreq{
+							MinKHz:     800000,
+							MaxKHz:     3500000,
+							Governors:  []string{"performance", "powersave"},
+							PolicyCPUs: cpuset.New(0),
+						}
+						s.topology.CPUs[1] = &topology.CPUInfo{ID: 1}
+					})
+				}
+
+				faults := &faultInjector{failAt: failAt, crash: crash}
+				s := newState(faults)
+				_, err := s.Prepare(claim)
+				if faults.steps < failAt {
+					assert.NoError(t, err)
+					prepared = true
+					return
+				}
+				assert.Error(t, err)
+				if !crash {
+					assert.False(t, assertConsistent(t, s, string(claim.UID)))
+					assert.Equal(t, original, readNode())
+				}
+
+				// Restart: the node is left as it was found, and the
+				// kubelet retries.
+				s = newState(&faultInjector{})
+				assert.False(t, assertConsistent(t, s, string(claim.UID)))
+				assert.Equal(t, original, readNode())
+				_, err = s.Prepare(claim)
+				assert.NoError(t, err)
+				assert.True(t, assertConsistent(t, s, string(claim.UID)))
+				assert.NoError(t, s.Unprepare(string(claim.UID)))
+				assert.Equal(t, original, readNode())
+			})
+		}
+	}
+}
+
+func TestRecoveryFailure(t *testing.T) {
+	cdiRoot, checkpointDir := t.TempDir(), t.TempDir()
+	s := newTestState(t, cdiRoot, checkpointDir, &faultInjector{})
+
+	// The governor of the first claim cannot be restored, the second claim
+	// can be rolled back.
+	stuck := &PreparedClaim{
+		State:   ClaimPrepareStarted,
+		Devices: devices.PreparedDevices{{Device: drapbv1.Device{DeviceName: "cpu-0"}, CPUs: "0", Pinning: "Exclusive"}},
+		TuningActions: []TuningAction{
+			{Type: tuningGovernor, Path: filepath.Join(t.TempDir(), "missing", "scaling_governor"), Original: "powersave"},
+		},
+	}
+	interrupted := &PreparedClaim{
+		State:   ClaimPrepareStarted,
+		Devices: devices.PreparedDevices{{Device: drapbv1.Device{DeviceName: "cpu-0"}, CPUs: "0", Pinning: "Shared"}},
+	}
+	for claimUID, claim := range map[string]*PreparedClaim{"stuck": stuck, "interrupted": interrupted} {
+		if err := s.claims.put(claimUID, claim); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The driver still starts, leaving the stuck claim to be recovered
+	// later.
+	s = newTestState(t, cdiRoot, checkpointDir, &faultInjector{})
+	assert.Equal(t, ClaimPrepareStarted, s.claims.state("stuck"))
+	assert.Equal(t, ClaimState(""), s.claims.state("interrupted"))
+}
+
+func TestPrepareRetry(t *testing.T) {
+	cdiRoot, checkpointDir := t.TempDir(), t.TempDir()
+	s := newTestState(t, cdiRoot, checkpointDir, &faultInjector{})
+	claim := newTestClaim()
+
+	// A previous attempt changed the governor of the CPU, which cannot be
+	// restored yet.
+	governor := filepath.Join(t.TempDir(), "cpufreq", "scaling_governor")
+	stuck := &PreparedClaim{
+		State:   ClaimPrepareStarted,
+		Devices: devices.PreparedDevices{{Device: drapbv1.Device{DeviceName: "cpu-0"}, CPUs: "0", Pinning: "Exclusive"}},
+		TuningActions: []TuningAction{
+			{Type: tuningGovernor, Path: governor, Original: "powersave"},
+		},
+	}
+	if err := s.claims.put(string(claim.UID), stuck); err != nil {
+		t.Fatal(err)
+	}
+	s = newTestState(t, cdiRoot, checkpointDir, &faultInjector{})
+
+	// The retry is refused rather than losing the governor to restore.
+	_, err := s.Prepare(claim)
+	assert.Error(t, err)
+	assert.Equal(t, ClaimPrepareStarted, s.claims.state(string(claim.UID)))
+	assert.Equal(t, stuck.TuningActions, s.claims.get(string(claim.UID)).TuningActions)
+
+	// Once the previous attempt can be rolled back, the retry succeeds.
+	if err := os.MkdirAll(filepath.Dir(governor), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(governor, []byte("performance\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Prepare(claim)
+	assert.NoError(t, err)
+	assert.True(t, assertConsistent(t, s, string(claim.UID)))
+	content, err := os.ReadFile(governor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "powersave", strings.TrimSpace(string(content)))
+}
+
+func TestCheckpointMigration(t *testing.T) {
+	cdiRoot, checkpointDir := t.TempDir(), t.TempDir()
+	checkpointManager, err := checkpointmanager.NewCheckpointManager(checkpointDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first drivers only recorded the devices of the claims.
+	v1 := &Checkpoint{
+		V1: &CheckpointV1{
+			PreparedClaims: devices.PreparedClaims{
+				"prepared": {{Device: drapbv1.Device{DeviceName: "cpu-0"}}},
+				"started":  {{Device: drapbv1.Device{DeviceName: "cpu-1"}}},
+			},
+			ClaimStates: map[string]ClaimState{"started": ClaimPrepareStarted},
+		},
+	}
+	if err := checkpointManager.CreateCheckpoint(DriverPluginCheckpointFile, v1); err != nil {
+		t.Fatal(err)
+	}
+
+	newTestState(t, cdiRoot, checkpointDir, &faultInjector{})
+
+	// The claims are moved to their own checkpoint, the interrupted one
+	// is rolled back.
+	checkpoints, err := checkpointManager.ListCheckpoints()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{claimCheckpointKey("prepared")}, checkpoints)
+
+	checkpoint := &ClaimCheckpoint{}
+	if err := checkpointManager.GetCheckpoint(claimCheckpointKey("prepared"), checkpoint); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, config.DriverVersion, checkpoint.DriverVersion)
+	assert.Equal(t, &PreparedClaim{
+		State:     ClaimPrepareCompleted,
+		CPUs:      "0",
+		NUMANodes: "0",
+		Devices: devices.PreparedDevices{
+			{Device: drapbv1.Device{DeviceName: "cpu-0"}, CPUPool: config.AllocatablePool, CPUs: "0", Pinning: "Exclusive"},
+		},
+	}, checkpoint.Claim)
+}
+
+func TestPreparedClaimRecord(t *testing.T) {
+	s := newTestState(t, t.TempDir(), t.TempDir(), &faultInjector{})
+	claim := newTestClaim()
+	claim.Namespace = "default"
+	claim.Status.ReservedFor = []resourceapi.ResourceClaimConsumerReference{
+		{Resource: "pods", Name: "pod-0", UID: "pod-uid-0"},
+	}
+	_, err := s.Prepare(claim)
+	assert.NoError(t, err)
+
+	record := s.claims.get(string(claim.UID))
+	assert.Equal(t, ClaimPrepareCompleted, record.State)
+	assert.Equal(t, "default", record.Namespace)
+	assert.Equal(t, "cpus", record.Name)
+	assert.Equal(t, []PodReference{{Namespace: "default", Name: "pod-0", UID: "pod-uid-0"}}, record.Pods)
+	assert.Equal(t, "0", record.CPUs)
+	assert.Equal(t, "0", record.NUMANodes)
+	assert.NotNil(t, record.PrepareStartedAt)
+	assert.NotNil(t, record.PrepareCompletedAt)
+	assert.Nil(t, record.UnprepareStartedAt)
+}
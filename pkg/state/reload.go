@@ -0,0 +1,100 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"fmt"
+
+	resourceapi "k8s.io/api/resource/v1beta1"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/cpuset"
+
+	"github.com/Tal-or/dra-cpu-driver/pkg/devices"
+	"github.com/Tal-or/dra-cpu-driver/pkg/discovery"
+)
+
+// Devices returns the devices to publish in the ResourceSlice.
+func (s *DeviceState) Devices() []resourceapi.Device {
+	s.Lock()
+	defer s.Unlock()
+
+	var devices []resourceapi.Device
+	for _, device := range s.Allocatable {
+		devices = append(devices, device.Device)
+	}
+	return devices
+}
+
+// Reload re-reads the pool configuration and the CPU topology and replaces
+// the allocatable devices. The new configuration is refused, and the current
+// one kept, if it would take a CPU held by a prepared claim away from the
+// pool it was prepared from.
+func (s *DeviceState) Reload() error {
+	s.reloadMutex.Lock()
+	defer s.reloadMutex.Unlock()
+	s.Lock()
+	defer s.Unlock()
+
+	topo, pools, allocatable, err := enumerateDevices(s.progArgs)
+	if err != nil {
+		return err
+	}
+
+	if err := checkPreparedClaimsKept(s.claims.preparedDevices(), pools); err != nil {
+		return fmt.Errorf("refusing to reload CPU pools: %w", err)
+	}
+
+	klog.Infof("Reloaded CPU pools: %d devices in %d pools", len(allocatable), len(pools))
+	s.Allocatable = allocatable
+	s.Pools = pools
+	s.topology = topo
+	s.notifySharedPool()
+	return nil
+}
+
+// checkPreparedClaimsKept makes sure every CPU of every prepared claim is
+// still part of the pool it was prepared from. Claims prepared before pools
+// were recorded only need their CPUs to remain in any pool.
+func checkPreparedClaimsKept(preparedClaims devices.PreparedClaims, pools map[string]*discovery.Pool) error {
+	allCPUs := cpuset.New()
+	for _, pool := range pools {
+		allCPUs = allCPUs.Union(pool.CPUs)
+	}
+
+	for claimUID, preparedDevices := range preparedClaims {
+		for _, device := range preparedDevices {
+			cpus, err := device.CPUSet()
+			if err != nil {
+				return fmt.Errorf("invalid CPUs of device %s prepared for claim %s: %v", device.DeviceName, claimUID, err)
+			}
+			if device.CPUPool == "" {
+				if removed := cpus.Difference(allCPUs); !removed.IsEmpty() {
+					return fmt.Errorf("CPUs %s of device %s prepared for claim %s would be removed", removed, device.DeviceName, claimUID)
+				}
+				continue
+			}
+			pool, exists := pools[device.CPUPool]
+			if !exists {
+				return fmt.Errorf("pool %q of device %s prepared for claim %s would be removed", device.CPUPool, device.DeviceName, claimUID)
+			}
+			if removed := cpus.Difference(pool.CPUs); !removed.IsEmpty() {
+				return fmt.Errorf("CPUs %s of device %s prepared for claim %s would be removed from pool %q", removed, device.DeviceName, claimUID, device.CPUPool)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newReloadTestSysfs returns a sysfs with four single threaded cores.
+func newReloadTestSysfs(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	files := map[string]string{"devices/system/cpu/online": "0-3"}
+	for id := 0; id < 4; id++ {
+		dir := fmt.Sprintf("devices/system/cpu/cpu%d/topology", id)
+		files[dir+"/physical_package_id"] = "0"
+		files[dir+"/core_id"] = fmt.Sprint(id)
+		files[dir+"/thread_siblings_list"] = fmt.Sprint(id)
+	}
+	for path, content := range files {
+		full := filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestReload(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(configFile, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deviceNames := func(s *DeviceState) []string {
+		var names []string
+		for _, device := range s.Devices() {
+			names = append(names, device.Name)
+		}
+		slices.Sort(names)
+		return names
+	}
+
+	writeConfig(`
+pools:
+- name: reserved
+  cpus: "0"
+- name: allocatable
+  cpus: "1-3"
+`)
+	s := newTestState(t, t.TempDir(), t.TempDir(), &faultInjector{}, func(s *DeviceState) {
+		s.progArgs.ConfigFile = configFile
+		s.progArgs.SysfsRoot = newReloadTestSysfs(t)
+		s.progArgs.ResctrlRoot = t.TempDir()
+		s.progArgs.Granularity = "cpu"
+	})
+	assert.NoError(t, s.Reload())
+	assert.Equal(t, []string{"cpu-0", "cpu-1", "cpu-2", "cpu-3"}, deviceNames(s))
+
+	claim := newTestClaim()
+	claim.Status.Allocation.Devices.Results[0].Device = "cpu-1"
+	_, err := s.Prepare(claim)
+	assert.NoError(t, err)
+
+	// An invalid config is rejected and the current devices are kept.
+	writeConfig(`
+pools:
+- name: reserved
+  cpus: "0-1"
+- name: allocatable
+  cpus: "1-3"
+`)
+	assert.Error(t, s.Reload())
+	assert.Equal(t, []string{"cpu-0", "cpu-1", "cpu-2", "cpu-3"}, deviceNames(s))
+
+	// So is a config taking the prepared CPU 1 away from its pool.
+	writeConfig(`
+pools:
+- name: reserved
+  cpus: "0-1"
+- name: allocatable
+  cpus: "2-3"
+`)
+	assert.Error(t, s.Reload())
+	assert.Equal(t, []string{"cpu-0", "cpu-1", "cpu-2", "cpu-3"}, deviceNames(s))
+
+	writeConfig(`
+pools:
+- name: reserved
+  cpus: "0"
+- name: allocatable
+  cpus: "1-2"
+`)
+	assert.NoError(t, s.Reload())
+	assert.Equal(t, []string{"cpu-0", "cpu-1", "cpu-2"}, deviceNames(s))
+}
@@ -0,0 +1,164 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"fmt"
+	"slices"
+
+	"k8s.io/utils/cpuset"
+
+	configapi "github.com/Tal-or/dra-cpu-driver/api/manager.cpu.com/resource/cpu/v1alpha1"
+	"github.com/Tal-or/dra-cpu-driver/pkg/devices"
+	"github.com/Tal-or/dra-cpu-driver/pkg/resctrl"
+)
+
+const (
+	// tuningResctrlGroup is the resctrl group created for the CPUs of a
+	// claim.
+	tuningResctrlGroup = "resctrlGroup"
+	// tuningResctrlDefaultCache is the L3 cache ways taken from the default
+	// resctrl group, so that the CPUs of no other claim use the ways of a
+	// claim. Its path is the resctrl root and its original the L3 line of
+	// the default group before the driver took any way from it.
+	tuningResctrlDefaultCache = "resctrlDefaultCache"
+)
+
+// resctrlGroup is a resctrl group about to be created for a claim.
+type resctrlGroup struct {
+	path     string
+	cpus     cpuset.CPUSet
+	schemata []string
+	// defaultSchemata is the schemata of the default group once the
+	// group has its cache ways, empty when the group has none.
+	defaultSchemata []string
+	// defaultCache is the L3 line of the schemata of the default group
+	// before the driver took any way from it.
+	defaultCache string
+}
+
+// hasRDT tells whether any device was prepared with an RDT allocation.
+func hasRDT(preparedDevices devices.PreparedDevices) bool {
+	return slices.ContainsFunc(preparedDevices, func(device *devices.PreparedDevice) bool {
+		return device.RDT != nil
+	})
+}
+
+// planResctrlGroup returns the resctrl group giving the CPUs of the devices
+// requesting it their share of the L3 cache and memory bandwidth, or nil
+// when no device does. A claim has a single group, all of its devices must
+// then request the same share.
+func (s *DeviceState) planResctrlGroup(claimUID string, preparedDevices devices.PreparedDevices) (*resctrlGroup, error) {
+	var rdt *configapi.RDTConfig
+	cpus := cpuset.New()
+	for _, device := range preparedDevices {
+		if device.RDT == nil {
+			continue
+		}
+		if rdt != nil && *rdt != *device.RDT {
+			return nil, fmt.Errorf("devices of claim %s request different RDT allocations", claimUID)
+		}
+		rdt = device.RDT
+		deviceCPUs, err := device.CPUSet()
+		if err != nil {
+			return nil, fmt.Errorf("invalid CPUs of device %s: %w", device.DeviceName, err)
+		}
+		cpus = cpus.Union(deviceCPUs)
+	}
+	if rdt == nil {
+		return nil, nil
+	}
+
+	root := s.progArgs.ResctrlRoot
+	info, err := resctrl.Discover(root)
+	if err != nil {
+		return nil, fmt.Errorf("unable to discover resctrl capabilities: %v", err)
+	}
+	if info == nil {
+		return nil, fmt.Errorf("resctrl is not mounted at %s", root)
+	}
+
+	path := resctrl.GroupPath(root, claimUID)
+	group := &resctrlGroup{path: path, cpus: cpus}
+	var cacheMask uint64
+	if rdt.CacheWays > 0 {
+		used, err := resctrl.UsedCacheWays(root, path)
+		if err != nil {
+			return nil, err
+		}
+		cacheMask, err = info.AllocateCacheWays(used, rdt.CacheWays)
+		if err != nil {
+			return nil, err
+		}
+		group.defaultSchemata = info.Schemata(info.DefaultCacheMask(used|cacheMask), 0)
+		group.defaultCache, err = s.originalDefaultCache(root, used)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read schemata of the default resctrl group: %v", err)
+		}
+	}
+	var bandwidth int
+	if rdt.MemoryBandwidthPercent > 0 {
+		bandwidth, err = info.Bandwidth(rdt.MemoryBandwidthPercent)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	group.schemata = info.Schemata(cacheMask, bandwidth)
+	return group, nil
+}
+
+// originalDefaultCache returns the L3 line of the default resctrl group at
+// root before the driver took any way from it: the current one when the
+// groups of the driver use no way, otherwise the one recorded by the claims
+// whose groups do.
+func (s *DeviceState) originalDefaultCache(root string, used uint64) (string, error) {
+	if used != 0 {
+		for _, claim := range s.claims.all() {
+			for _, action := range claim.TuningActions {
+				if action.Type == tuningResctrlDefaultCache {
+					return action.Original, nil
+				}
+			}
+		}
+	}
+	return resctrl.CacheSchemata(root)
+}
+
+// restoreDefaultCache gives back to the default resctrl group at root the L3
+// cache ways of the group of a claim about to be removed. While the groups of
+// other claims use ways, the ways of the default group are computed again
+// from them rather than restored, so that they keep their ways. The original
+// L3 line, which may have been set by the administrator, is restored once
+// they use none.
+func restoreDefaultCache(root, claimUID, original string) error {
+	info, err := resctrl.Discover(root)
+	if err != nil {
+		return err
+	}
+	if info == nil || info.CacheWays == 0 {
+		return nil
+	}
+	used, err := resctrl.UsedCacheWays(root, resctrl.GroupPath(root, claimUID))
+	if err != nil {
+		return err
+	}
+	if used == 0 && original != "" {
+		return resctrl.SetSchemata(root, []string{original})
+	}
+	return resctrl.SetSchemata(root, info.Schemata(info.DefaultCacheMask(used), 0))
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/utils/cpuset"
+
+	configapi "github.com/Tal-or/dra-cpu-driver/api/manager.cpu.com/resource/cpu/v1alpha1"
+	"github.com/Tal-or/dra-cpu-driver/pkg/config"
+	"github.com/Tal-or/dra-cpu-driver/pkg/discovery"
+	"github.com/Tal-or/dra-cpu-driver/pkg/resctrl"
+	"github.com/Tal-or/dra-cpu-driver/pkg/resctrl/resctrltest"
+	"github.com/Tal-or/dra-cpu-driver/pkg/topology"
+)
+
+func TestRDTAllocation(t *testing.T) {
+	root := resctrltest.NewFakeResctrl(t, 0)
+	s := newTestState(t, t.TempDir(), t.TempDir(), &faultInjector{}, func(s *DeviceState) {
+		s.progArgs.ResctrlRoot = root
+		s.Allocatable["cpu-1"] = &discovery.AllocatableDevice{Pool: config.AllocatablePool, CPUs: cpuset.New(1)}
+		s.topology.CPUs[1] = &topology.CPUInfo{ID: 1}
+	})
+	readGroup := func(uid string) (string, string) {
+		t.Helper()
+		cpus, err := os.ReadFile(filepath.Join(root, "dra-cpu-"+uid, "cpus_list"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		schemata, err := os.ReadFile(filepath.Join(root, "dra-cpu-"+uid, "schemata"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(cpus), string(schemata)
+	}
+	readDefaultCache := func() string {
+		t.Helper()
+		line, err := resctrl.CacheSchemata(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return line
+	}
+
+	_, err := s.Prepare(newConfiguredTestClaim("uid-0", "cpu-0", &configapi.CpuConfig{RDT: &configapi.RDTConfig{CacheWays: 4}}))
+	assert.NoError(t, err)
+	assert.Equal(t, []TuningAction{
+		{Type: tuningResctrlGroup, Path: filepath.Join(root, "dra-cpu-uid-0")},
+		{Type: tuningResctrlDefaultCache, Path: root, Original: "L3:0=fff"},
+	}, s.claims.get("uid-0").TuningActions)
+	cpus, schemata := readGroup("uid-0")
+	assert.Equal(t, "0", cpus)
+	assert.Equal(t, "L3:0=f00\n", schemata)
+	assert.Equal(t, "L3:0=ff", readDefaultCache(), "the ways of the claim are taken from the default group")
+
+	_, err = s.Prepare(newConfiguredTestClaim("uid-1", "cpu-1", &configapi.CpuConfig{RDT: &configapi.RDTConfig{CacheWays: 4, MemoryBandwidthPercent: 45}}))
+	assert.NoError(t, err)
+	cpus, schemata = readGroup("uid-1")
+	assert.Equal(t, "1", cpus)
+	assert.Equal(t, "L3:0=f0\nMB:0=50\n", schemata, "cache ways must not overlap")
+	assert.Equal(t, "L3:0=f", readDefaultCache())
+
+	assert.NoError(t, s.Unprepare("uid-0"))
+	assert.NoDirExists(t, filepath.Join(root, "dra-cpu-uid-0"))
+	// Cache bit masks must be contiguous, the ways above those of the
+	// other claim are left unused.
+	assert.Equal(t, "L3:0=f", readDefaultCache())
+
+	// The free ways are split around the ways of the other claim.
+	claim := newConfiguredTestClaim("uid-2", "cpu-0", &configapi.CpuConfig{RDT: &configapi.RDTConfig{CacheWays: 8}})
+	_, err = s.Prepare(claim)
+	assert.Error(t, err)
+	assert.False(t, assertConsistent(t, s, "uid-2"))
+	assert.NoDirExists(t, filepath.Join(root, "dra-cpu-uid-2"))
+
+	assert.NoError(t, s.Unprepare("uid-1"))
+	assert.NoDirExists(t, filepath.Join(root, "dra-cpu-uid-1"))
+	assert.Equal(t, "L3:0=fff", readDefaultCache())
+}
+
+func TestRDTDefaultSchemataRestored(t *testing.T) {
+	root := resctrltest.NewFakeResctrl(t, 0)
+	// The administrator keeps the highest ways away from the default group.
+	resctrltest.WriteFiles(t, root, map[string]string{"schemata": "    L3:0=3ff\n    MB:0=80\n"})
+	s := newTestState(t, t.TempDir(), t.TempDir(), &faultInjector{}, func(s *DeviceState) {
+		s.progArgs.ResctrlRoot = root
+		s.Allocatable["cpu-1"] = &discovery.AllocatableDevice{Pool: config.AllocatablePool, CPUs: cpuset.New(1)}
+		s.topology.CPUs[1] = &topology.CPUInfo{ID: 1}
+	})
+
+	_, err := s.Prepare(newConfiguredTestClaim("uid-0", "cpu-0", &configapi.CpuConfig{RDT: &configapi.RDTConfig{CacheWays: 2}}))
+	assert.NoError(t, err)
+	_, err = s.Prepare(newConfiguredTestClaim("uid-1", "cpu-1", &configapi.CpuConfig{RDT: &configapi.RDTConfig{CacheWays: 2}}))
+	assert.NoError(t, err)
+	assert.Equal(t, "L3:0=3ff", s.claims.get("uid-1").TuningActions[1].Original, "the original of the default group is kept")
+
+	// Unprepared out of order, the default group gets its original
+	// schemata back once no claim uses ways.
+	assert.NoError(t, s.Unprepare("uid-0"))
+	assert.NoError(t, s.Unprepare("uid-1"))
+	data, err := os.ReadFile(filepath.Join(root, "schemata"))
+	assert.NoError(t, err)
+	assert.Equal(t, "L3:0=3ff\nMB:0=80\n", string(data))
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"fmt"
+
+	"k8s.io/utils/cpuset"
+
+	configapi "github.com/Tal-or/dra-cpu-driver/api/manager.cpu.com/resource/cpu/v1alpha1"
+	"github.com/Tal-or/dra-cpu-driver/pkg/config"
+	"github.com/Tal-or/dra-cpu-driver/pkg/devices"
+	"github.com/Tal-or/dra-cpu-driver/pkg/discovery"
+)
+
+// With --dynamic-shared-pool, containers using devices of the shared pool are
+// not pinned to the CPUs of their devices but to a pool that, like the default
+// pool of the kubelet's static CPU manager, is made of every CPU of every pool
+// but the reserved one, minus the CPUs currently prepared for exclusive use.
+// The pool shrinks and grows as claims are prepared and unprepared.
+
+// SetSharedPoolNotifier registers a function called whenever the dynamic
+// shared pool may have changed, so that the containers running on it can be
+// updated. It is called with the state locked and must not block.
+func (s *DeviceState) SetSharedPoolNotifier(notify func()) {
+	s.Lock()
+	defer s.Unlock()
+	s.sharedPoolNotifier = notify
+}
+
+func (s *DeviceState) notifySharedPool() {
+	if s.progArgs.DynamicSharedPool && s.sharedPoolNotifier != nil {
+		s.sharedPoolNotifier()
+	}
+}
+
+// SharedCPUs returns the current CPUs of the dynamic shared pool.
+func (s *DeviceState) SharedCPUs() (cpuset.CPUSet, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	return sharedCPUs(s.Pools, s.claims.preparedDevices())
+}
+
+// sharedCPUs computes the dynamic shared pool from the pools and the claims
+// currently prepared.
+func sharedCPUs(pools map[string]*discovery.Pool, preparedClaims devices.PreparedClaims) (cpuset.CPUSet, error) {
+	cpus := cpuset.New()
+	for name, pool := range pools {
+		if name != config.ReservedPool {
+			cpus = cpus.Union(pool.CPUs)
+		}
+	}
+
+	for claimUID, preparedDevices := range preparedClaims {
+		for _, device := range preparedDevices {
+			if !isExclusive(device) {
+				continue
+			}
+			deviceCPUs, err := device.CPUSet()
+			if err != nil {
+				return cpuset.New(), fmt.Errorf("invalid CPUs of device %s prepared for claim %s: %v", device.DeviceName, claimUID, err)
+			}
+			cpus = cpus.Difference(deviceCPUs)
+		}
+	}
+	return cpus, nil
+}
+
+// isExclusive tells whether a prepared device holds its CPUs for exclusive
+// use. Slot devices are never exclusive.
+func isExclusive(device *devices.PreparedDevice) bool {
+	if discovery.IsSlotDevice(device.DeviceName) {
+		return false
+	}
+	return device.Pinning == string(configapi.ExclusivePinning)
+}
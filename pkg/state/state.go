@@ -29,35 +29,77 @@ import (
 	"k8s.io/kubernetes/pkg/kubelet/checkpointmanager"
 	"k8s.io/utils/cpuset"
 
-	configapi "sigs.k8s.io/dra-example-driver/api/example.com/resource/gpu/v1alpha1"
-
 	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
 	cdispec "tags.cncf.io/container-device-interface/specs-go"
 
+	configapi "github.com/Tal-or/dra-cpu-driver/api/manager.cpu.com/resource/cpu/v1alpha1"
 	"github.com/Tal-or/dra-cpu-driver/pkg/cdi"
 	"github.com/Tal-or/dra-cpu-driver/pkg/config"
 	"github.com/Tal-or/dra-cpu-driver/pkg/discovery"
+	"github.com/Tal-or/dra-cpu-driver/pkg/housekeeping"
+	"github.com/Tal-or/dra-cpu-driver/pkg/resctrl"
+	"github.com/Tal-or/dra-cpu-driver/pkg/topology"
 )
 
 type PerDeviceCDIContainerEdits map[string]*cdiapi.ContainerEdits
 
+// cdiHandler manages the CDI spec files of the claims. It is implemented by
+// cdi.Handler.
+type cdiHandler interface {
+	CreateClaimSpecFile(claimUID string, preparedDevices devices.PreparedDevices) error
+	DeleteClaimSpecFile(claimUID string) error
+	ListClaimSpecFiles() ([]string, error)
+	GetClaimDevices(claimUID string, devices []string) []string
+}
+
 type OpaqueDeviceConfig struct {
 	Requests []string
 	Config   runtime.Object
 }
 
+// DeviceState prepares and unprepares claims. Operations on different claims
+// run concurrently: each claim is locked for the whole operation, while the
+// embedded mutex only protects the in-memory state, such as the devices and
+// the CPU ownership index, and is never held while writing files.
 type DeviceState struct {
 	Allocatable discovery.AllocatableDevices
+	Pools       map[string]*discovery.Pool
 	sync.Mutex
-	cdi               *cdi.Handler
-	checkpointManager checkpointmanager.CheckpointManager
+	progArgs *config.ProgArgs
+	topology *topology.Topology
+	cdi      cdiHandler
+	claims   *claimStore
+	// claimLocks serializes the operations on each claim.
+	claimLocks claimLocks
+	// reloadMutex is held for reading while claims are prepared and for
+	// writing by Reload, so that the pools never change under a claim
+	// being prepared.
+	reloadMutex sync.RWMutex
+	// tuningMutex serializes the changes made to the node for the claims,
+	// such as the affinity of IRQs, which are shared by all claims.
+	tuningMutex sync.Mutex
+	// tuningStep, when set, is called before each kind of change made to
+	// the node for a claim. Tests use it to inject failures.
+	tuningStep func() error
+	// housekeeping moves the housekeeping work of the kernel away from the
+	// CPUs of the claims requesting it.
+	housekeeping *housekeeping.Manager
+	// partitions backs the exclusive CPUs of claims with isolated cpuset
+	// partitions.
+	partitions *cpuPartitions
+	// owners tracks which claims every prepared CPU is prepared for.
+	owners ownershipIndex
+	// envPrefixes tracks the environment prefix of every prepared claim.
+	envPrefixes envPrefixIndex
+	// sharedPoolNotifier is called when the dynamic shared pool may have
+	// changed.
+	sharedPoolNotifier func()
 }
 
 func NewDeviceState(cfg *config.Config) (*DeviceState, error) {
-	CPUs := prepareCPUDevices(cfg.ProgArgs)
-	allocatable, err := discovery.EnumerateAllPossibleDevices(CPUs)
+	topo, pools, allocatable, err := enumerateDevices(cfg.ProgArgs)
 	if err != nil {
-		return nil, fmt.Errorf("error enumerating all possible devices: %v", err)
+		return nil, err
 	}
 
 	cdiHandler, err := cdi.NewHandler(cfg)
@@ -76,99 +118,279 @@ func NewDeviceState(cfg *config.Config) (*DeviceState, error) {
 	}
 
 	state := &DeviceState{
-		Allocatable:       allocatable,
-		cdi:               cdiHandler,
-		checkpointManager: checkpointManager,
+		Allocatable:  allocatable,
+		Pools:        pools,
+		progArgs:     cfg.ProgArgs,
+		topology:     topo,
+		cdi:          cdiHandler,
+		claims:       newClaimStore(checkpointManager),
+		housekeeping: housekeeping.NewManager(cfg.ProgArgs.SysfsRoot, cfg.ProgArgs.ProcfsRoot, cfg.ProgArgs.HousekeepingDryRun),
+		partitions:   newCPUPartitions(cfg.ProgArgs.CgroupRoot),
 	}
 
-	checkpoints, err := state.checkpointManager.ListCheckpoints()
-	if err != nil {
-		return nil, fmt.Errorf("unable to list checkpoints: %v", err)
+	if err := state.syncFromCheckpoint(); err != nil {
+		return nil, err
 	}
 
-	for _, c := range checkpoints {
-		if c == DriverPluginCheckpointFile {
-			return state, nil
-		}
+	return state, nil
+}
+
+// syncFromCheckpoint loads the prepared claims and recovers from the
+// operations a crash may have interrupted.
+func (s *DeviceState) syncFromCheckpoint() error {
+	if err := s.migrateCheckpoint(); err != nil {
+		return fmt.Errorf("unable to migrate checkpoint: %v", err)
 	}
 
-	checkpoint := newCheckpoint()
-	if err := state.checkpointManager.CreateCheckpoint(DriverPluginCheckpointFile, checkpoint); err != nil {
-		return nil, fmt.Errorf("unable to sync to checkpoint: %v", err)
+	if err := s.claims.load(); err != nil {
+		return fmt.Errorf("unable to sync from checkpoint: %v", err)
 	}
 
-	return state, nil
+	var err error
+	s.owners, err = newOwnershipIndex(s.claims.preparedDevices())
+	if err != nil {
+		return fmt.Errorf("unable to build CPU ownership index: %v", err)
+	}
+	s.envPrefixes = newEnvPrefixIndex(s.claims.all())
+
+	s.adoptHousekeepingIsolation()
+
+	s.recoverClaims()
+
+	return nil
 }
 
-func (s *DeviceState) Prepare(claim *resourceapi.ResourceClaim) ([]*drapbv1.Device, error) {
-	s.Lock()
-	defer s.Unlock()
+// migrateCheckpoint moves the claims of the single checkpoint written by older
+// drivers to per-claim checkpoints. The old checkpoint is only removed once
+// every claim is written, so a crash in between repeats the migration.
+func (s *DeviceState) migrateCheckpoint() error {
+	checkpoints, err := s.claims.checkpointManager.ListCheckpoints()
+	if err != nil {
+		return fmt.Errorf("unable to list checkpoints: %v", err)
+	}
+	if !slices.Contains(checkpoints, DriverPluginCheckpointFile) {
+		return nil
+	}
 
-	claimUID := string(claim.UID)
+	checkpoint := &Checkpoint{}
+	if err := s.claims.checkpointManager.GetCheckpoint(DriverPluginCheckpointFile, checkpoint); err != nil {
+		return fmt.Errorf("unable to sync from checkpoint: %v", err)
+	}
+	if err := checkpoint.migrate(s.Allocatable, s.numaNodes, s.defaultPinning); err != nil {
+		return err
+	}
+	if version := checkpoint.V2.DriverVersion; version != "" && version != config.DriverVersion {
+		klog.Infof("Checkpoint was written by driver version %s", version)
+	}
 
-	checkpoint := newCheckpoint()
-	if err := s.checkpointManager.GetCheckpoint(DriverPluginCheckpointFile, checkpoint); err != nil {
-		return nil, fmt.Errorf("unable to sync from checkpoint: %v", err)
+	for claimUID, claim := range checkpoint.V2.PreparedClaims {
+		if err := s.claims.put(claimUID, claim); err != nil {
+			return fmt.Errorf("unable to sync to checkpoint of claim %s: %v", claimUID, err)
+		}
 	}
-	preparedClaims := checkpoint.V1.PreparedClaims
+	if err := s.claims.checkpointManager.RemoveCheckpoint(DriverPluginCheckpointFile); err != nil {
+		return fmt.Errorf("unable to remove checkpoint: %v", err)
+	}
+	klog.Infof("Moved %d prepared claims to per-claim checkpoints", len(checkpoint.V2.PreparedClaims))
+	return nil
+}
 
-	if preparedClaims[claimUID] != nil {
-		return preparedClaims[claimUID].GetDevices(), nil
+func (s *DeviceState) Prepare(claim *resourceapi.ResourceClaim) ([]*drapbv1.Device, error) {
+	claimUID := string(claim.UID)
+	defer s.claimLocks.lock(claimUID)()
+
+	switch s.claims.state(claimUID) {
+	case ClaimPrepareCompleted:
+		return s.claims.get(claimUID).Devices.GetDevices(), nil
+	case ClaimUnprepareStarted:
+		return nil, fmt.Errorf("prepare failed: claim is being unprepared")
+	case ClaimPrepareStarted:
+		// A previous attempt failed and could not be rolled back: its
+		// changes to the node are only recorded in its checkpoint, which
+		// the new attempt would overwrite.
+		if err := s.unprepareClaim(claimUID); err != nil {
+			return nil, fmt.Errorf("prepare failed: unable to roll back previous attempt: %v", err)
+		}
 	}
 
-	preparedDevices, err := s.prepareDevices(claim)
+	s.reloadMutex.RLock()
+	defer s.reloadMutex.RUnlock()
+
+	preparedClaim, err := s.reserveClaim(claim)
 	if err != nil {
 		return nil, fmt.Errorf("prepare failed: %v", err)
 	}
+	preparedDevices := preparedClaim.Devices
+
+	// Record the claim before writing its CDI spec file, so that the file
+	// can always be traced back to the claim after a crash.
+	preparedClaim = preparedClaim.withState(ClaimPrepareStarted)
+	if err := s.claims.put(claimUID, preparedClaim); err != nil {
+		s.releaseClaim(claimUID)
+		return nil, fmt.Errorf("unable to sync to checkpoint: %v", err)
+	}
 
 	if err = s.cdi.CreateClaimSpecFile(claimUID, preparedDevices); err != nil {
+		s.rollbackPrepare(claimUID)
 		return nil, fmt.Errorf("unable to create CDI spec file for claim: %v", err)
 	}
 
-	preparedClaims[claimUID] = preparedDevices
-	if err := s.checkpointManager.CreateCheckpoint(DriverPluginCheckpointFile, checkpoint); err != nil {
+	preparedClaim, err = s.tuneClaim(claimUID, preparedClaim)
+	if err != nil {
+		s.rollbackPrepare(claimUID)
+		return nil, fmt.Errorf("unable to tune node for claim: %v", err)
+	}
+
+	if err := s.claims.put(claimUID, preparedClaim.withState(ClaimPrepareCompleted)); err != nil {
+		s.rollbackPrepare(claimUID)
 		return nil, fmt.Errorf("unable to sync to checkpoint: %v", err)
 	}
 
-	return preparedClaims[claimUID].GetDevices(), nil
+	s.Lock()
+	s.notifySharedPool()
+	s.Unlock()
+
+	return preparedDevices.GetDevices(), nil
 }
 
-func (s *DeviceState) Unprepare(claimUID string) error {
+// reserveClaim computes the devices of a claim and reserves their CPUs in the
+// ownership index, so that no concurrent claim can be prepared on them.
+func (s *DeviceState) reserveClaim(claim *resourceapi.ResourceClaim) (*PreparedClaim, error) {
 	s.Lock()
 	defer s.Unlock()
 
-	checkpoint := newCheckpoint()
-	if err := s.checkpointManager.GetCheckpoint(DriverPluginCheckpointFile, checkpoint); err != nil {
-		return fmt.Errorf("unable to sync from checkpoint: %v", err)
+	claimUID := string(claim.UID)
+	pods := claimPods(claim)
+	claimPrefix := s.envPrefixes.add(claim, pods)
+	preparedDevices, err := s.prepareDevices(claim, claimPrefix)
+	if err != nil {
+		delete(s.envPrefixes, claimUID)
+		return nil, err
+	}
+
+	if err := s.checkAggregateConflicts(claimUID, preparedDevices); err != nil {
+		delete(s.envPrefixes, claimUID)
+		return nil, err
+	}
+
+	if err := s.owners.check(claimUID, preparedDevices); err != nil {
+		delete(s.envPrefixes, claimUID)
+		return nil, err
+	}
+
+	preparedClaim, err := s.newPreparedClaim(claim, pods, claimPrefix, preparedDevices)
+	if err != nil {
+		delete(s.envPrefixes, claimUID)
+		return nil, err
+	}
+
+	if err := s.owners.add(claimUID, preparedDevices); err != nil {
+		delete(s.envPrefixes, claimUID)
+		return nil, err
+	}
+	return preparedClaim, nil
+}
+
+// releaseClaim frees the CPUs of a claim in the ownership index.
+func (s *DeviceState) releaseClaim(claimUID string) {
+	s.Lock()
+	defer s.Unlock()
+	s.owners.remove(claimUID)
+	delete(s.envPrefixes, claimUID)
+}
+
+// claimPods returns the pods a claim is reserved for.
+func claimPods(claim *resourceapi.ResourceClaim) []PodReference {
+	var pods []PodReference
+	for _, consumer := range claim.Status.ReservedFor {
+		if consumer.APIGroup == "" && consumer.Resource == "pods" {
+			pods = append(pods, PodReference{Namespace: claim.Namespace, Name: consumer.Name, UID: consumer.UID})
+		}
 	}
-	preparedClaims := checkpoint.V1.PreparedClaims
+	return pods
+}
 
-	if preparedClaims[claimUID] == nil {
+// newPreparedClaim builds the checkpoint record of a claim about to be
+// prepared.
+func (s *DeviceState) newPreparedClaim(claim *resourceapi.ResourceClaim, pods []PodReference, envPrefix string, preparedDevices devices.PreparedDevices) (*PreparedClaim, error) {
+	cpus, err := preparedDevices.CPUSet()
+	if err != nil {
+		return nil, err
+	}
+
+	return &PreparedClaim{
+		Namespace: claim.Namespace,
+		Name:      claim.Name,
+		Pods:      pods,
+		EnvPrefix: envPrefix,
+		CPUs:      cpus.String(),
+		NUMANodes: s.numaNodes(cpus).String(),
+		Devices:   preparedDevices,
+	}, nil
+}
+
+// rollbackPrepare undoes a failed Prepare. Failures are only logged: the
+// claim stays in the PrepareStarted state and is rolled back by the next
+// Prepare or at startup.
+func (s *DeviceState) rollbackPrepare(claimUID string) {
+	if err := s.unprepareClaim(claimUID); err != nil {
+		klog.Errorf("Unable to roll back claim %s: %v", claimUID, err)
+	}
+}
+
+func (s *DeviceState) Unprepare(claimUID string) error {
+	defer s.claimLocks.lock(claimUID)()
+
+	preparedClaim := s.claims.get(claimUID)
+	if preparedClaim == nil {
 		return nil
 	}
 
-	if err := s.unprepareDevices(claimUID, preparedClaims[claimUID]); err != nil {
+	// Record that the claim is going away before deleting its CDI spec
+	// file, so that a crash never leaves a prepared claim without one.
+	if err := s.claims.put(claimUID, preparedClaim.withState(ClaimUnprepareStarted)); err != nil {
+		return fmt.Errorf("unable to sync to checkpoint: %v", err)
+	}
+
+	if err := s.unprepareClaim(claimUID); err != nil {
 		return fmt.Errorf("unprepare failed: %v", err)
 	}
 
-	err := s.cdi.DeleteClaimSpecFile(claimUID)
-	if err != nil {
+	s.Lock()
+	s.notifySharedPool()
+	s.Unlock()
+
+	return nil
+}
+
+// unprepareClaim finishes unpreparing a claim in the UnprepareStarted state.
+func (s *DeviceState) unprepareClaim(claimUID string) error {
+	if err := s.unprepareDevices(claimUID, s.claims.get(claimUID)); err != nil {
+		return err
+	}
+
+	if err := s.cdi.DeleteClaimSpecFile(claimUID); err != nil {
 		return fmt.Errorf("unable to delete CDI spec file for claim: %v", err)
 	}
 
-	delete(preparedClaims, claimUID)
-	if err := s.checkpointManager.CreateCheckpoint(DriverPluginCheckpointFile, checkpoint); err != nil {
+	if err := s.claims.remove(claimUID); err != nil {
 		return fmt.Errorf("unable to sync to checkpoint: %v", err)
 	}
+	s.releaseClaim(claimUID)
 
 	return nil
 }
 
-func (s *DeviceState) prepareDevices(claim *resourceapi.ResourceClaim) (devices.PreparedDevices, error) {
+func (s *DeviceState) prepareDevices(claim *resourceapi.ResourceClaim, claimPrefix string) (devices.PreparedDevices, error) {
 	if claim.Status.Allocation == nil {
 		return nil, fmt.Errorf("claim not yet allocated")
 	}
 
+	results, err := s.driverResults(claim.Status.Allocation)
+	if err != nil {
+		return nil, err
+	}
+
 	// Retrieve the full set of device configs for the driver.
 	configs, err := GetOpaqueDeviceConfigs(
 		configapi.Decoder,
@@ -179,21 +401,46 @@ func (s *DeviceState) prepareDevices(claim *resourceapi.ResourceClaim) (devices.
 		return nil, fmt.Errorf("error getting opaque device configs: %v", err)
 	}
 
-	// Add the default GPU Config to the front of the config list with the
+	// Add the default CPU Config to the front of the config list with the
 	// lowest precedence. This guarantees there will be at least one config in
-	// the list with len(Requests) == 0 for the lookup below.
+	// the list with len(Requests) == 0 for the lookup below. Its pinning is
+	// left unset so that it depends on the pool of each device.
+	defaultConfig := configapi.DefaultCpuConfig()
+	defaultConfig.Pinning = ""
 	configs = slices.Insert(configs, 0, &OpaqueDeviceConfig{
 		Requests: []string{},
-		Config:   configapi.DefaultGpuConfig(),
+		Config:   defaultConfig,
 	})
 
+	// Normalizing a config sets its pinning, remember which configs left
+	// it to the devices.
+	unsetPinning := make(map[runtime.Object]bool)
+	for _, c := range configs {
+		if cfg, ok := c.Config.(*configapi.CpuConfig); ok && cfg.Pinning == "" {
+			unsetPinning[c.Config] = true
+		}
+	}
+
+	// The claim level variables use the format of the claim-wide config with
+	// the highest precedence.
+	claimFormat := configapi.EnvFormatAll
+	for _, c := range slices.Backward(configs) {
+		if cfg, ok := c.Config.(*configapi.CpuConfig); ok && len(c.Requests) == 0 {
+			if err := cfg.Normalize(); err != nil {
+				return nil, fmt.Errorf("error normalizing CPU cfg: %w", err)
+			}
+			if err := cfg.Validate(); err != nil {
+				return nil, fmt.Errorf("error validating CPU cfg: %w", err)
+			}
+			claimFormat = cfg.EnvFormat
+			break
+		}
+	}
+
 	// Look through the configs and figure out which one will be applied to
 	// each device allocation result based on their order of precedence.
 	configResultsMap := make(map[runtime.Object][]*resourceapi.DeviceRequestAllocationResult)
-	for _, result := range claim.Status.Allocation.Devices.Results {
-		if _, exists := s.Allocatable[result.Device]; !exists {
-			return nil, fmt.Errorf("requested GPU is not Allocatable: %v", result.Device)
-		}
+	for _, result := range results {
 		for _, c := range slices.Backward(configs) {
 			if len(c.Requests) == 0 || slices.Contains(c.Requests, result.Request) {
 				configResultsMap[c.Config] = append(configResultsMap[c.Config], &result)
@@ -206,11 +453,12 @@ func (s *DeviceState) prepareDevices(claim *resourceapi.ResourceClaim) (devices.
 	// need to be prepared. Track container edits generated from applying the
 	// config to the set of device allocation results.
 	perDeviceCDIContainerEdits := make(PerDeviceCDIContainerEdits)
+	pinnings := make(map[string]configapi.PinningMode)
 	for c, results := range configResultsMap {
-		// Cast the opaque cfg to a GpuConfig
-		var cfg *configapi.GpuConfig
+		// Cast the opaque cfg to a CpuConfig
+		var cfg *configapi.CpuConfig
 		switch castConfig := c.(type) {
-		case *configapi.GpuConfig:
+		case *configapi.CpuConfig:
 			cfg = castConfig
 		default:
 			return nil, fmt.Errorf("runtime object is not a regognized configuration")
@@ -218,18 +466,23 @@ func (s *DeviceState) prepareDevices(claim *resourceapi.ResourceClaim) (devices.
 
 		// Normalize the cfg to set any implied defaults.
 		if err := cfg.Normalize(); err != nil {
-			return nil, fmt.Errorf("error normalizing GPU cfg: %w", err)
+			return nil, fmt.Errorf("error normalizing CPU cfg: %w", err)
 		}
 
 		// Validate the cfg to ensure its integrity.
 		if err := cfg.Validate(); err != nil {
-			return nil, fmt.Errorf("error validating GPU cfg: %w", err)
+			return nil, fmt.Errorf("error validating CPU cfg: %w", err)
+		}
+
+		// Resolve the pinning of every request the cfg applies to.
+		for request, pinning := range s.requestPinnings(cfg, unsetPinning[c], results) {
+			pinnings[request] = pinning
 		}
 
 		// Apply the cfg to the list of results associated with it.
-		containerEdits, err := s.applyConfig(cfg, results)
+		containerEdits, err := s.applyConfig(cfg, pinnings, claimPrefix, results)
 		if err != nil {
-			return nil, fmt.Errorf("error applying GPU cfg: %w", err)
+			return nil, fmt.Errorf("error applying CPU cfg: %w", err)
 		}
 
 		// Merge any new container edits with the overall per device map.
@@ -238,10 +491,24 @@ func (s *DeviceState) prepareDevices(claim *resourceapi.ResourceClaim) (devices.
 		}
 	}
 
+	// Every device carries the claim level variables, so that a container
+	// referencing any of them sees the whole claim.
+	claimCPUs := cpuset.New()
+	for _, result := range results {
+		claimCPUs = claimCPUs.Union(s.Allocatable[result.Device].CPUs)
+	}
+	claimEnvs := []string{fmt.Sprintf("%s_CLAIM_UID=%s", claimPrefix, claim.UID)}
+	claimEnvs = append(claimEnvs, cpuSetEnvs(claimPrefix, claimCPUs, claimFormat)...)
+	claimEnvs = append(claimEnvs, s.numaEnvs(claimPrefix, claimCPUs, claimFormat)...)
+	for _, edits := range perDeviceCDIContainerEdits {
+		edits.Env = append(edits.Env, claimEnvs...)
+	}
+
 	// Walk through each config and its associated device allocation results
 	// and construct the list of prepared devices to return.
 	var preparedDevices devices.PreparedDevices
-	for _, results := range configResultsMap {
+	for c, results := range configResultsMap {
+		cfg := c.(*configapi.CpuConfig)
 		for _, result := range results {
 			device := &devices.PreparedDevice{
 				Device: drapbv1.Device{
@@ -250,7 +517,14 @@ func (s *DeviceState) prepareDevices(claim *resourceapi.ResourceClaim) (devices.
 					DeviceName:   result.Device,
 					CDIDeviceIDs: s.cdi.GetClaimDevices(string(claim.UID), []string{result.Device}),
 				},
-				ContainerEdits: perDeviceCDIContainerEdits[result.Device],
+				CPUPool:               s.Allocatable[result.Device].Pool,
+				CPUs:                  s.Allocatable[result.Device].CPUs.String(),
+				Pinning:               string(pinnings[result.Request]),
+				IRQIsolation:          cfg.IRQIsolation,
+				HousekeepingIsolation: cfg.HousekeepingIsolation,
+				PowerProfile:          cfg.PowerProfile,
+				RDT:                   cfg.RDT,
+				ContainerEdits:        perDeviceCDIContainerEdits[result.Device],
 			}
 			preparedDevices = append(preparedDevices, device)
 		}
@@ -259,43 +533,113 @@ func (s *DeviceState) prepareDevices(claim *resourceapi.ResourceClaim) (devices.
 	return preparedDevices, nil
 }
 
-func (s *DeviceState) unprepareDevices(claimUID string, devices devices.PreparedDevices) error {
+// checkAggregateConflicts refuses to prepare a NUMA node or cache domain
+// device when any of its CPUs is already prepared for another claim, and
+// refuses to prepare CPUs held by another claim's aggregate device. The
+// scheduler sees them as independent devices and may allocate both.
+func (s *DeviceState) checkAggregateConflicts(claimUID string, preparedDevices devices.PreparedDevices) error {
+	for _, device := range preparedDevices {
+		cpus, err := device.CPUSet()
+		if err != nil {
+			return fmt.Errorf("invalid CPUs of device %s: %v", device.DeviceName, err)
+		}
+		for _, cpu := range cpus.List() {
+			for _, owner := range s.owners[cpu] {
+				if owner.ClaimUID == claimUID {
+					continue
+				}
+				if s.isAggregate(device.DeviceName) || s.isAggregate(owner.Device) {
+					return fmt.Errorf("device %s conflicts with device %s prepared for claim %s on CPU %d", device.DeviceName, owner.Device, owner.ClaimUID, cpu)
+				}
+			}
+		}
+	}
 	return nil
 }
 
-// applyConfig applies a configuration to a set of device allocation results.
+func (s *DeviceState) isAggregate(deviceName string) bool {
+	device, exists := s.Allocatable[deviceName]
+	return exists && device.Type.IsAggregate()
+}
+
+// requestPinnings returns the pinning of the requests of a set of device
+// allocation results. When the config does not set a pinning, and does not
+// ask for tuning that requires Exclusive pinning, a request gets the default
+// pinning of its devices: Shared if any of them is, Exclusive otherwise.
+func (s *DeviceState) requestPinnings(config *configapi.CpuConfig, unsetPinning bool, results []*resourceapi.DeviceRequestAllocationResult) map[string]configapi.PinningMode {
+	pinnings := make(map[string]configapi.PinningMode)
+	defaulted := unsetPinning && config.PowerProfile == nil && config.RDT == nil && !config.IRQIsolation && !config.HousekeepingIsolation
+	for _, result := range results {
+		if !defaulted {
+			pinnings[result.Request] = config.Pinning
+			continue
+		}
+		if pinnings[result.Request] != configapi.SharedPinning {
+			pinnings[result.Request] = s.defaultPinning(result.Device)
+		}
+	}
+	return pinnings
+}
+
+// defaultPinning returns the pinning of a device whose config does not set
+// one: Shared for slot devices and the devices of shared pools, Exclusive
+// otherwise.
+func (s *DeviceState) defaultPinning(deviceName string) configapi.PinningMode {
+	if discovery.IsSlotDevice(deviceName) {
+		return configapi.SharedPinning
+	}
+	if device, exists := s.Allocatable[deviceName]; exists {
+		if pool, exists := s.Pools[device.Pool]; exists && pool.Shared {
+			return configapi.SharedPinning
+		}
+	}
+	return configapi.ExclusivePinning
+}
+
+// applyConfig applies a configuration to a set of device allocation results,
+// whose requests are pinned as given by pinnings.
 //
-// In this example driver, there is no actual configuration applied.
-// We simply define a set of environment variables to be injected into the containers
+// No hardware configuration is applied yet. We enforce the SMT policy and
+// define a set of environment variables to be injected into the containers
 // that include a given device.
-// A real driver would likely need to do some sort
-// of hardware configuration as well, based on the config passed in.
-func (s *DeviceState) applyConfig(config *configapi.GpuConfig, results []*resourceapi.DeviceRequestAllocationResult) (PerDeviceCDIContainerEdits, error) {
+func (s *DeviceState) applyConfig(config *configapi.CpuConfig, pinnings map[string]configapi.PinningMode, claimPrefix string, results []*resourceapi.DeviceRequestAllocationResult) (PerDeviceCDIContainerEdits, error) {
 	perDeviceEdits := make(PerDeviceCDIContainerEdits)
 
-	for _, result := range results {
-		envs := []string{
-			fmt.Sprintf("GPU_DEVICE_%s=%s", result.Device[4:], result.Device),
+	if config.SMTPolicy == configapi.SMTFullCores {
+		if err := s.checkFullCores(results); err != nil {
+			return nil, err
 		}
+	}
 
-		if config.Sharing != nil {
-			envs = append(envs, fmt.Sprintf("GPU_DEVICE_%s_SHARING_STRATEGY=%s", result.Device[4:], config.Sharing.Strategy))
+	// Slots of a CPU are handed out to several claims, none of which can
+	// own it. They are only pinned exclusively when asked to.
+	for _, result := range results {
+		if pinnings[result.Request] == configapi.ExclusivePinning && discovery.IsSlotDevice(result.Device) {
+			return nil, fmt.Errorf("slot device %s cannot be pinned with %s pinning", result.Device, configapi.ExclusivePinning)
 		}
+	}
 
-		switch {
-		case config.Sharing.IsTimeSlicing():
-			tsconfig, err := config.Sharing.GetTimeSlicingConfig()
-			if err != nil {
-				return nil, fmt.Errorf("unable to get time slicing config for device %v: %w", result.Device, err)
-			}
-			envs = append(envs, fmt.Sprintf("GPU_DEVICE_%s_TIMESLICE_INTERVAL=%v", result.Device[4:], tsconfig.Interval))
-		case config.Sharing.IsSpacePartitioning():
-			spconfig, err := config.Sharing.GetSpacePartitioningConfig()
-			if err != nil {
-				return nil, fmt.Errorf("unable to get space partitioning config for device %v: %w", result.Device, err)
-			}
-			envs = append(envs, fmt.Sprintf("GPU_DEVICE_%s_PARTITION_COUNT=%v", result.Device[4:], spconfig.PartitionCount))
-		}
+	// All the results of a request share the same config, so the request
+	// level variables can be computed here and injected with every device
+	// of the request.
+	requestCPUs := make(map[string]cpuset.CPUSet)
+	for _, result := range results {
+		requestCPUs[result.Request] = requestCPUs[result.Request].Union(s.Allocatable[result.Device].CPUs)
+	}
+	requestEnvs := make(map[string][]string)
+	for request, cpus := range requestCPUs {
+		prefix := requestEnvPrefix(claimPrefix, request)
+		envs := cpuSetEnvs(prefix, cpus, config.EnvFormat)
+		envs = append(envs,
+			fmt.Sprintf("%s_PINNING=%s", prefix, pinnings[request]),
+			fmt.Sprintf("%s_SMT_POLICY=%s", prefix, config.SMTPolicy),
+		)
+		requestEnvs[request] = envs
+	}
+
+	for _, result := range results {
+		envs := cpuFormatEnvs(deviceEnvPrefix(claimPrefix, discovery.PhysicalDeviceName(result.Device)), s.Allocatable[result.Device].CPUs, config.EnvFormat)
+		envs = append(envs, requestEnvs[result.Request]...)
 
 		edits := &cdispec.ContainerEdits{
 			Env: envs,
@@ -307,6 +651,25 @@ func (s *DeviceState) applyConfig(config *configapi.GpuConfig, results []*resour
 	return perDeviceEdits, nil
 }
 
+// checkFullCores makes sure that the CPUs of the results are made of whole
+// physical cores, i.e. that every thread sibling of every CPU is included.
+func (s *DeviceState) checkFullCores(results []*resourceapi.DeviceRequestAllocationResult) error {
+	cpus := cpuset.New()
+	for _, result := range results {
+		cpus = cpus.Union(s.Allocatable[result.Device].CPUs)
+	}
+	for _, cpu := range cpus.List() {
+		info, err := s.topology.CPU(cpu)
+		if err != nil {
+			return err
+		}
+		if missing := info.Siblings.Difference(cpus); !missing.IsEmpty() {
+			return fmt.Errorf("SMT policy %s violated: thread siblings %s of CPU %d are not part of the allocation", configapi.SMTFullCores, missing, cpu)
+		}
+	}
+	return nil
+}
+
 // GetOpaqueDeviceConfigs returns an ordered list of the configs contained in possibleConfigs for this driver.
 //
 // Configs can either come from the resource claim itself or from the device
@@ -373,23 +736,66 @@ func GetOpaqueDeviceConfigs(
 	return resultConfigs, nil
 }
 
-func prepareCPUDevices(progArgs *config.ProgArgs) map[string]*cpuset.CPUSet {
-	reserved, err := cpuset.Parse(progArgs.Reserved)
+// enumerateDevices discovers the CPU topology and builds the pools and the
+// devices to publish for them.
+func enumerateDevices(progArgs *config.ProgArgs) (*topology.Topology, map[string]*discovery.Pool, discovery.AllocatableDevices, error) {
+	topo, err := topology.Discover(progArgs.SysfsRoot)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error discovering CPU topology: %v", err)
+	}
+
+	granularity, err := discovery.ParseGranularity(progArgs.Granularity)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	aggregates, err := discovery.ParseAggregateTypes(progArgs.Aggregates)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	pools, err := loadPools(progArgs, topo, granularity)
 	if err != nil {
-		klog.Fatal(err)
+		return nil, nil, nil, fmt.Errorf("error loading CPU pools: %v", err)
 	}
-	shared, err := cpuset.Parse(progArgs.Shared)
+
+	allocatable, err := discovery.EnumerateAllPossibleDevices(progArgs.NodeName, pools, topo, aggregates)
 	if err != nil {
-		klog.Fatal(err)
+		return nil, nil, nil, fmt.Errorf("error enumerating all possible devices: %v", err)
 	}
-	allocatable, err := cpuset.Parse(progArgs.Allocatable)
+
+	rdt, err := resctrl.Discover(progArgs.ResctrlRoot)
 	if err != nil {
-		klog.Fatal(err)
+		return nil, nil, nil, fmt.Errorf("error discovering resctrl capabilities: %v", err)
 	}
-	return map[string]*cpuset.CPUSet{
-		"reserved":    &reserved,
-		"shared":      &shared,
-		"Allocatable": &allocatable,
+	discovery.FillInRDTAttributes(allocatable, rdt)
+
+	poolsByName := make(map[string]*discovery.Pool)
+	for _, pool := range pools {
+		poolsByName[pool.Name] = pool
 	}
 
+	return topo, poolsByName, allocatable, nil
+}
+
+// loadPools resolves the CPU pools either from the --config file or from the
+// --reserved-cpus, --shared-cpus and --allocatable-cpus flags.
+func loadPools(progArgs *config.ProgArgs, topo *topology.Topology, granularity discovery.Granularity) ([]*discovery.Pool, error) {
+	var driverConfig *config.DriverConfig
+	if progArgs.ConfigFile != "" {
+		if progArgs.Reserved != "" || progArgs.Shared != "" || progArgs.Allocatable != "" {
+			return nil, fmt.Errorf("--config cannot be combined with --reserved-cpus, --shared-cpus or --allocatable-cpus")
+		}
+		var err error
+		driverConfig, err = config.LoadDriverConfig(progArgs.ConfigFile)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		driverConfig = config.NewDriverConfigFromFlags(progArgs)
+		if err := driverConfig.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return discovery.ResolvePools(driverConfig, topo, granularity)
 }
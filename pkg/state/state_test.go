@@ -17,13 +17,27 @@
 package state
 
 import (
+	"fmt"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 
+	corev1 "k8s.io/api/core/v1"
+	resourceapi "k8s.io/api/resource/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	drapbv1 "k8s.io/kubelet/pkg/apis/dra/v1beta1"
-	
+	"k8s.io/utils/cpuset"
+	cdiapi "tags.cncf.io/container-device-interface/pkg/cdi"
+	cdispec "tags.cncf.io/container-device-interface/specs-go"
+
+	configapi "github.com/Tal-or/dra-cpu-driver/api/manager.cpu.com/resource/cpu/v1alpha1"
+	"github.com/Tal-or/dra-cpu-driver/pkg/cdi"
+	"github.com/Tal-or/dra-cpu-driver/pkg/config"
 	"github.com/Tal-or/dra-cpu-driver/pkg/devices"
+	"github.com/Tal-or/dra-cpu-driver/pkg/discovery"
+	"github.com/Tal-or/dra-cpu-driver/pkg/topology"
 )
 
 func TestPreparedDevicesGetDevices(t *testing.T) {
@@ -56,3 +70,795 @@ func TestPreparedDevicesGetDevices(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckPreparedClaimsKept(t *testing.T) {
+	preparedClaims := devices.PreparedClaims{
+		"claim-1": {
+			{Device: drapbv1.Device{DeviceName: "core-0-0-1"}, CPUPool: "realtime", CPUs: "1,5"},
+		},
+	}
+
+	tests := map[string]struct {
+		pools     map[string]*discovery.Pool
+		expectErr bool
+	}{
+		"CPUs kept in their pool": {
+			pools: map[string]*discovery.Pool{
+				"realtime": {Name: "realtime", CPUs: cpuset.New(1, 2, 5, 6)},
+			},
+		},
+		"CPU removed from its pool": {
+			pools: map[string]*discovery.Pool{
+				"realtime": {Name: "realtime", CPUs: cpuset.New(1, 2)},
+				"batch":    {Name: "batch", CPUs: cpuset.New(5, 6)},
+			},
+			expectErr: true,
+		},
+		"pool removed": {
+			pools: map[string]*discovery.Pool{
+				"batch": {Name: "batch", CPUs: cpuset.New(1, 2, 5, 6)},
+			},
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := checkPreparedClaimsKept(preparedClaims, test.pools)
+			if test.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCPUMask(t *testing.T) {
+	tests := map[string]struct {
+		cpus     cpuset.CPUSet
+		expected string
+	}{
+		"empty":          {cpus: cpuset.New(), expected: "0x0"},
+		"list":           {cpus: cpuset.New(0, 1, 2, 3, 8), expected: "0x10f"},
+		"beyond 64 CPUs": {cpus: cpuset.New(0, 64), expected: "0x10000000000000001"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.expected, cpuMask(test.cpus))
+		})
+	}
+}
+
+func TestPrepareDevicesEnv(t *testing.T) {
+	s := &DeviceState{
+		Allocatable: discovery.AllocatableDevices{
+			"cpu-0": {CPUs: cpuset.New(0)},
+			"cpu-1": {CPUs: cpuset.New(1)},
+			"cpu-2": {CPUs: cpuset.New(2)},
+		},
+		progArgs: &config.ProgArgs{NodeName: "node-0"},
+		topology: &topology.Topology{
+			CPUs: map[int]*topology.CPUInfo{
+				0: {ID: 0, NUMANode: 0},
+				1: {ID: 1, NUMANode: 0},
+				2: {ID: 2, NUMANode: 1},
+			},
+		},
+		cdi: &cdi.Handler{},
+	}
+
+	claim := newConfiguredTestClaim("uid-0", "cpu-0", &configapi.CpuConfig{EnvFormat: configapi.EnvFormatMask, Pinning: configapi.SharedPinning})
+	claim.Name = "pod-0-cpus-x7k2p"
+	claim.Annotations = map[string]string{podClaimNameAnnotation: "cpus"}
+	claim.Status.Allocation.Devices.Results = []resourceapi.DeviceRequestAllocationResult{
+		{Request: "main", Driver: config.DriverName, Pool: "node-0", Device: "cpu-0"},
+		{Request: "main", Driver: config.DriverName, Pool: "node-0", Device: "cpu-1"},
+		{Request: "io-thread", Driver: config.DriverName, Pool: "node-0", Device: "cpu-2"},
+	}
+	claim.Status.Allocation.Devices.Config[0].Requests = []string{"io-thread"}
+
+	preparedDevices, err := s.prepareDevices(claim, claimEnvPrefix(claim))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	envs := make(map[string][]string)
+	for _, device := range preparedDevices {
+		envs[device.DeviceName] = device.ContainerEdits.Env
+	}
+
+	claimEnvs := []string{
+		"DRA_CPU_CPUS_CLAIM_UID=uid-0",
+		"DRA_CPU_CPUS_CPU_COUNT=3",
+		"DRA_CPU_CPUS_CPUS=0-2",
+		"DRA_CPU_CPUS_CPU_MASK=0x7",
+		"DRA_CPU_CPUS_NUMA_NODES=0-1",
+		"DRA_CPU_CPUS_NUMA_0_CPUS=0-1",
+		"DRA_CPU_CPUS_NUMA_0_CPU_MASK=0x3",
+		"DRA_CPU_CPUS_NUMA_1_CPUS=2",
+		"DRA_CPU_CPUS_NUMA_1_CPU_MASK=0x4",
+	}
+	mainEnvs := []string{
+		"DRA_CPU_CPUS_REQUEST_MAIN_CPU_COUNT=2",
+		"DRA_CPU_CPUS_REQUEST_MAIN_CPUS=0-1",
+		"DRA_CPU_CPUS_REQUEST_MAIN_CPU_MASK=0x3",
+		"DRA_CPU_CPUS_REQUEST_MAIN_PINNING=Exclusive",
+		"DRA_CPU_CPUS_REQUEST_MAIN_SMT_POLICY=Allow",
+	}
+
+	assert.Equal(t, append(append([]string{
+		"DRA_CPU_CPUS_DEVICE_CPU_0_CPUS=0",
+		"DRA_CPU_CPUS_DEVICE_CPU_0_CPU_MASK=0x1",
+	}, mainEnvs...), claimEnvs...), envs["cpu-0"])
+	assert.Equal(t, append(append([]string{
+		"DRA_CPU_CPUS_DEVICE_CPU_1_CPUS=1",
+		"DRA_CPU_CPUS_DEVICE_CPU_1_CPU_MASK=0x2",
+	}, mainEnvs...), claimEnvs...), envs["cpu-1"])
+	assert.Equal(t, append([]string{
+		"DRA_CPU_CPUS_DEVICE_CPU_2_CPU_MASK=0x4",
+		"DRA_CPU_CPUS_REQUEST_IO_THREAD_CPU_COUNT=1",
+		"DRA_CPU_CPUS_REQUEST_IO_THREAD_CPU_MASK=0x4",
+		"DRA_CPU_CPUS_REQUEST_IO_THREAD_PINNING=Shared",
+		"DRA_CPU_CPUS_REQUEST_IO_THREAD_SMT_POLICY=Allow",
+	}, claimEnvs...), envs["cpu-2"])
+}
+
+func TestPrepareDevicesPinning(t *testing.T) {
+	s := &DeviceState{
+		Allocatable: discovery.AllocatableDevices{
+			"cpu-0":        {Pool: config.AllocatablePool, CPUs: cpuset.New(0)},
+			"cpu-1":        {Pool: config.SharedPool, CPUs: cpuset.New(1)},
+			"cpu-0-slot-0": {Pool: config.AllocatablePool, CPUs: cpuset.New(0)},
+		},
+		Pools: map[string]*discovery.Pool{
+			config.AllocatablePool: {Name: config.AllocatablePool, CPUs: cpuset.New(0)},
+			config.SharedPool:      {Name: config.SharedPool, CPUs: cpuset.New(1), Shared: true},
+		},
+		progArgs: &config.ProgArgs{NodeName: "node-0"},
+		topology: &topology.Topology{
+			CPUs: map[int]*topology.CPUInfo{
+				0: {ID: 0, NUMANode: 0},
+				1: {ID: 1, NUMANode: 0},
+			},
+		},
+		cdi: &cdi.Handler{},
+	}
+
+	tests := map[string]struct {
+		devices   []string
+		config    *configapi.CpuConfig
+		expected  map[string]string
+		expectErr bool
+	}{
+		"allocatable pool with the default config": {
+			devices:  []string{"cpu-0"},
+			expected: map[string]string{"cpu-0": "Exclusive"},
+		},
+		"shared pool with the default config": {
+			devices:  []string{"cpu-1"},
+			expected: map[string]string{"cpu-1": "Shared"},
+		},
+		"shared pool with a config without pinning": {
+			devices:  []string{"cpu-1"},
+			config:   &configapi.CpuConfig{EnvFormat: configapi.EnvFormatMask},
+			expected: map[string]string{"cpu-1": "Shared"},
+		},
+		"shared pool with explicit exclusive pinning": {
+			devices:  []string{"cpu-1"},
+			config:   &configapi.CpuConfig{Pinning: configapi.ExclusivePinning},
+			expected: map[string]string{"cpu-1": "Exclusive"},
+		},
+		"shared pool with tuning requiring exclusive pinning": {
+			devices:  []string{"cpu-1"},
+			config:   &configapi.CpuConfig{IRQIsolation: true},
+			expected: map[string]string{"cpu-1": "Exclusive"},
+		},
+		"slot with the default config": {
+			devices:  []string{"cpu-0-slot-0"},
+			expected: map[string]string{"cpu-0-slot-0": "Shared"},
+		},
+		"slot with explicit shared pinning": {
+			devices:  []string{"cpu-0-slot-0"},
+			config:   &configapi.CpuConfig{Pinning: configapi.SharedPinning},
+			expected: map[string]string{"cpu-0-slot-0": "Shared"},
+		},
+		"slot with explicit exclusive pinning": {
+			devices:   []string{"cpu-0-slot-0"},
+			config:    &configapi.CpuConfig{Pinning: configapi.ExclusivePinning},
+			expectErr: true,
+		},
+		"request across pools": {
+			devices:  []string{"cpu-0", "cpu-1"},
+			expected: map[string]string{"cpu-0": "Shared", "cpu-1": "Shared"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			claim := newConfiguredTestClaim("uid-0", test.devices[0], test.config)
+			for _, device := range test.devices[1:] {
+				claim.Status.Allocation.Devices.Results = append(claim.Status.Allocation.Devices.Results,
+					resourceapi.DeviceRequestAllocationResult{Request: "cpus", Driver: config.DriverName, Pool: "node-0", Device: device})
+			}
+
+			preparedDevices, err := s.prepareDevices(claim, claimEnvPrefix(claim))
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			pinnings := make(map[string]string)
+			for _, device := range preparedDevices {
+				pinnings[device.DeviceName] = device.Pinning
+				assert.Contains(t, device.ContainerEdits.Env, "DRA_CPU_CPUS_REQUEST_CPUS_PINNING="+device.Pinning)
+			}
+			assert.Equal(t, test.expected, pinnings)
+		})
+	}
+}
+
+func TestEnvPrefixIndex(t *testing.T) {
+	pod := func(uid string) resourceapi.ResourceClaimConsumerReference {
+		return resourceapi.ResourceClaimConsumerReference{Resource: "pods", Name: uid, UID: types.UID(uid)}
+	}
+	newClaim := func(name, uid string, pods ...resourceapi.ResourceClaimConsumerReference) *resourceapi.ResourceClaim {
+		return &resourceapi.ResourceClaim{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, UID: types.UID(uid)},
+			Status:     resourceapi.ResourceClaimStatus{ReservedFor: pods},
+		}
+	}
+
+	tests := map[string]struct {
+		prepared *resourceapi.ResourceClaim
+		claim    *resourceapi.ResourceClaim
+		expected string
+	}{
+		"distinct names": {
+			prepared: newClaim("my-claim", "5f3a0c1b-0000", pod("pod-0")),
+			claim:    newClaim("other", "9e8d7c6b-0000", pod("pod-0")),
+			expected: "DRA_CPU_OTHER",
+		},
+		"colliding names in the same pod": {
+			prepared: newClaim("my-claim", "5f3a0c1b-0000", pod("pod-0")),
+			claim:    newClaim("my.claim", "9e8d7c6b-0000", pod("pod-0")),
+			expected: "DRA_CPU_MY_CLAIM_9E8D7C6B",
+		},
+		"colliding names in different pods": {
+			prepared: newClaim("my-claim", "5f3a0c1b-0000", pod("pod-0")),
+			claim:    newClaim("my.claim", "9e8d7c6b-0000", pod("pod-1")),
+			expected: "DRA_CPU_MY_CLAIM",
+		},
+		"name nested in the device variables of another claim": {
+			prepared: newClaim("a", "5f3a0c1b-0000", pod("pod-0")),
+			claim:    newClaim("a-device-cpu-3", "9e8d7c6b-0000", pod("pod-0")),
+			expected: "DRA_CPU_9E8D7C6B_0000",
+		},
+		"name nested in the request variables of another claim": {
+			prepared: newClaim("a", "5f3a0c1b-0000", pod("pod-0")),
+			claim:    newClaim("a-request-x", "9e8d7c6b-0000", pod("pod-0")),
+			expected: "DRA_CPU_9E8D7C6B_0000",
+		},
+		"name whose variables nest another claim": {
+			prepared: newClaim("a-device-cpu-3", "5f3a0c1b-0000", pod("pod-0")),
+			claim:    newClaim("a", "9e8d7c6b-0000", pod("pod-0")),
+			expected: "DRA_CPU_A_9E8D7C6B",
+		},
+		"nested names in different pods": {
+			prepared: newClaim("a", "5f3a0c1b-0000", pod("pod-0")),
+			claim:    newClaim("a-device-cpu-3", "9e8d7c6b-0000", pod("pod-1")),
+			expected: "DRA_CPU_A_DEVICE_CPU_3",
+		},
+		"shared beginning of a name": {
+			prepared: newClaim("a", "5f3a0c1b-0000", pod("pod-0")),
+			claim:    newClaim("ab", "9e8d7c6b-0000", pod("pod-0")),
+			expected: "DRA_CPU_AB",
+		},
+		"retry of the same claim": {
+			prepared: newClaim("my-claim", "5f3a0c1b-0000", pod("pod-0")),
+			claim:    newClaim("my-claim", "5f3a0c1b-0000", pod("pod-0")),
+			expected: "DRA_CPU_MY_CLAIM",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			index := make(envPrefixIndex)
+			index.add(test.prepared, claimPods(test.prepared))
+			assert.Equal(t, test.expected, index.add(test.claim, claimPods(test.claim)))
+			assert.Equal(t, test.expected, index[string(test.claim.UID)].prefix)
+		})
+	}
+}
+
+func TestDriverResults(t *testing.T) {
+	s := &DeviceState{
+		Allocatable: discovery.AllocatableDevices{
+			"cpu-0": {CPUs: cpuset.New(0)},
+			"cpu-1": {CPUs: cpuset.New(1)},
+		},
+		progArgs: &config.ProgArgs{NodeName: "node-0"},
+	}
+
+	nodeSelector := func(operator corev1.NodeSelectorOperator, nodes ...string) *corev1.NodeSelector {
+		return &corev1.NodeSelector{
+			NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+				MatchFields: []corev1.NodeSelectorRequirement{
+					{Key: "metadata.name", Operator: operator, Values: nodes},
+				},
+			}},
+		}
+	}
+
+	tests := map[string]struct {
+		nodeSelector *corev1.NodeSelector
+		results      []resourceapi.DeviceRequestAllocationResult
+		expected     []string
+		expectErr    bool
+	}{
+		"results of other drivers are skipped": {
+			results: []resourceapi.DeviceRequestAllocationResult{
+				{Request: "cpus", Driver: config.DriverName, Pool: "node-0", Device: "cpu-0"},
+				{Request: "gpu", Driver: "gpu.example.com", Pool: "node-0", Device: "cpu-1"},
+				{Request: "nic", Driver: "nic.example.com", Pool: "other", Device: "cpu-3"},
+			},
+			expected: []string{"cpu-0"},
+		},
+		"pool of another node": {
+			results: []resourceapi.DeviceRequestAllocationResult{
+				{Request: "cpus", Driver: config.DriverName, Pool: "node-0", Device: "cpu-0"},
+				{Request: "cpus", Driver: config.DriverName, Pool: "node-1", Device: "cpu-1"},
+			},
+			expectErr: true,
+		},
+		"device is not allocatable": {
+			results: []resourceapi.DeviceRequestAllocationResult{
+				{Request: "cpus", Driver: config.DriverName, Pool: "node-0", Device: "cpu-3"},
+			},
+			expectErr: true,
+		},
+		"no result of this driver": {
+			results: []resourceapi.DeviceRequestAllocationResult{
+				{Request: "gpu", Driver: "gpu.example.com", Pool: "node-0", Device: "gpu-0"},
+			},
+			expectErr: true,
+		},
+		"node selector matches": {
+			nodeSelector: nodeSelector(corev1.NodeSelectorOpIn, "node-0"),
+			results: []resourceapi.DeviceRequestAllocationResult{
+				{Request: "cpus", Driver: config.DriverName, Pool: "node-0", Device: "cpu-0"},
+			},
+			expected: []string{"cpu-0"},
+		},
+		"node selector selects another node": {
+			nodeSelector: nodeSelector(corev1.NodeSelectorOpIn, "node-1"),
+			results: []resourceapi.DeviceRequestAllocationResult{
+				{Request: "cpus", Driver: config.DriverName, Pool: "node-0", Device: "cpu-0"},
+			},
+			expectErr: true,
+		},
+		"node selector excludes this node": {
+			nodeSelector: nodeSelector(corev1.NodeSelectorOpNotIn, "node-0"),
+			results: []resourceapi.DeviceRequestAllocationResult{
+				{Request: "cpus", Driver: config.DriverName, Pool: "node-0", Device: "cpu-0"},
+			},
+			expectErr: true,
+		},
+		"node selector without terms": {
+			nodeSelector: &corev1.NodeSelector{},
+			results: []resourceapi.DeviceRequestAllocationResult{
+				{Request: "cpus", Driver: config.DriverName, Pool: "node-0", Device: "cpu-0"},
+			},
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			results, err := s.driverResults(&resourceapi.AllocationResult{
+				Devices:      resourceapi.DeviceAllocationResult{Results: test.results},
+				NodeSelector: test.nodeSelector,
+			})
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			var actual []string
+			for _, result := range results {
+				actual = append(actual, result.Device)
+			}
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestContainerCPUs(t *testing.T) {
+	claims := newClaimStore(nil)
+	claims.index["uid-0"] = &PreparedClaim{
+		State:     ClaimPrepareCompleted,
+		Pods:      []PodReference{{Namespace: "default", Name: "pod-0", UID: "pod-uid-0"}},
+		EnvPrefix: "DRA_CPU_CPUS",
+		Devices: devices.PreparedDevices{
+			{Device: drapbv1.Device{RequestNames: []string{"main"}, DeviceName: "cpu-0"}, CPUs: "0", Pinning: "None"},
+			{Device: drapbv1.Device{RequestNames: []string{"main"}, DeviceName: "cpu-2"}, CPUs: "2", Pinning: "None"},
+			{Device: drapbv1.Device{RequestNames: []string{"helper"}, DeviceName: "cpu-1"}, CPUs: "1", Pinning: "Shared"},
+		},
+	}
+	claims.index["uid-1"] = &PreparedClaim{
+		State:     ClaimPrepareCompleted,
+		Pods:      []PodReference{{Namespace: "default", Name: "pod-0", UID: "pod-uid-0"}},
+		EnvPrefix: "DRA_CPU_PINNED",
+		Devices: devices.PreparedDevices{
+			{Device: drapbv1.Device{RequestNames: []string{"main"}, DeviceName: "cpu-0"}, CPUs: "0", Pinning: "Exclusive"},
+			{Device: drapbv1.Device{RequestNames: []string{"main"}, DeviceName: "cpu-2"}, CPUs: "2", Pinning: "Exclusive"},
+		},
+	}
+
+	s := &DeviceState{
+		progArgs: &config.ProgArgs{},
+		topology: &topology.Topology{
+			CPUs: map[int]*topology.CPUInfo{
+				0: {ID: 0, NUMANode: 0},
+				1: {ID: 1, NUMANode: 0},
+				2: {ID: 2, NUMANode: 1},
+			},
+		},
+		claims: claims,
+	}
+
+	tests := map[string]struct {
+		podUID       string
+		env          []string
+		expectedCPUs cpuset.CPUSet
+		expectedMems cpuset.CPUSet
+		expectErr    bool
+	}{
+		"no claim": {
+			podUID:       "pod-uid-0",
+			env:          []string{"PATH=/bin"},
+			expectedCPUs: cpuset.New(),
+			expectedMems: cpuset.New(),
+		},
+		"devices of one request": {
+			podUID: "pod-uid-0",
+			env: []string{
+				"DRA_CPU_PINNED_CLAIM_UID=uid-1",
+				"DRA_CPU_PINNED_DEVICE_CPU_0_CPUS=0",
+				"DRA_CPU_PINNED_DEVICE_CPU_2_CPU_MASK=0x4",
+				"DRA_CPU_PINNED_REQUEST_MAIN_PINNING=Exclusive",
+			},
+			expectedCPUs: cpuset.New(0, 2),
+			expectedMems: cpuset.New(0, 1),
+		},
+		"request without pinning": {
+			podUID: "pod-uid-0",
+			env: []string{
+				"DRA_CPU_CPUS_CLAIM_UID=uid-0",
+				"DRA_CPU_CPUS_DEVICE_CPU_0_CPUS=0",
+				"DRA_CPU_CPUS_DEVICE_CPU_1_CPUS=1",
+				"DRA_CPU_CPUS_REQUEST_MAIN_PINNING=None",
+				"DRA_CPU_CPUS_REQUEST_HELPER_PINNING=Shared",
+			},
+			expectedCPUs: cpuset.New(1),
+			expectedMems: cpuset.New(0),
+		},
+		"pinning taken from the prepared devices": {
+			podUID: "pod-uid-0",
+			env: []string{
+				"DRA_CPU_CPUS_CLAIM_UID=uid-0",
+				"DRA_CPU_CPUS_DEVICE_CPU_0_CPUS=0",
+				"DRA_CPU_CPUS_REQUEST_MAIN_PINNING=Exclusive",
+			},
+			expectedCPUs: cpuset.New(),
+			expectedMems: cpuset.New(),
+		},
+		"claim of another pod": {
+			podUID: "pod-uid-1",
+			env: []string{
+				"DRA_CPU_PINNED_CLAIM_UID=uid-1",
+				"DRA_CPU_PINNED_DEVICE_CPU_0_CPUS=0",
+			},
+			expectErr: true,
+		},
+		"claim under another prefix": {
+			podUID: "pod-uid-0",
+			env: []string{
+				"DRA_CPU_CPUS_CLAIM_UID=uid-1",
+				"DRA_CPU_CPUS_DEVICE_CPU_0_CPUS=0",
+			},
+			expectErr: true,
+		},
+		"claim not prepared": {
+			podUID:    "pod-uid-0",
+			env:       []string{"DRA_CPU_OTHER_CLAIM_UID=uid-2"},
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cpus, mems, err := s.ContainerCPUs(test.podUID, test.env)
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedCPUs, cpus)
+			assert.Equal(t, test.expectedMems, mems)
+		})
+	}
+}
+
+func TestSharedCPUs(t *testing.T) {
+	pools := map[string]*discovery.Pool{
+		config.ReservedPool:    {Name: config.ReservedPool, CPUs: cpuset.New(0)},
+		config.SharedPool:      {Name: config.SharedPool, CPUs: cpuset.New(1)},
+		config.AllocatablePool: {Name: config.AllocatablePool, CPUs: cpuset.New(2, 3, 4, 5)},
+	}
+
+	tests := map[string]struct {
+		preparedClaims devices.PreparedClaims
+		expected       cpuset.CPUSet
+	}{
+		"nothing prepared": {
+			expected: cpuset.New(1, 2, 3, 4, 5),
+		},
+		"exclusive CPUs are removed": {
+			preparedClaims: devices.PreparedClaims{
+				"claim-0": {
+					{Device: drapbv1.Device{DeviceName: "cpu-2"}, CPUPool: config.AllocatablePool, CPUs: "2", Pinning: "Exclusive"},
+					{Device: drapbv1.Device{DeviceName: "cpu-3"}, CPUPool: config.AllocatablePool, CPUs: "3", Pinning: "Shared"},
+				},
+				"claim-1": {
+					{Device: drapbv1.Device{DeviceName: "cpu-1"}, CPUPool: config.SharedPool, CPUs: "1", Pinning: "Shared"},
+				},
+			},
+			expected: cpuset.New(1, 3, 4, 5),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cpus, err := sharedCPUs(pools, test.preparedClaims)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, cpus)
+		})
+	}
+}
+
+func TestOwnershipIndex(t *testing.T) {
+	index, err := newOwnershipIndex(devices.PreparedClaims{
+		"exclusive": {
+			{Device: drapbv1.Device{DeviceName: "cpu-2"}, CPUPool: "allocatable", CPUs: "2", Pinning: "Exclusive"},
+		},
+		"shared": {
+			{Device: drapbv1.Device{DeviceName: "cpu-1-slot-0"}, CPUPool: "shared", CPUs: "1", Pinning: "Shared"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := map[string]struct {
+		claimUID        string
+		preparedDevices devices.PreparedDevices
+		expectErr       bool
+	}{
+		"free CPU": {
+			claimUID: "new",
+			preparedDevices: devices.PreparedDevices{
+				{Device: drapbv1.Device{DeviceName: "cpu-3"}, CPUs: "3", Pinning: "Exclusive"},
+			},
+		},
+		"CPU owned by another claim": {
+			claimUID: "new",
+			preparedDevices: devices.PreparedDevices{
+				{Device: drapbv1.Device{DeviceName: "cpu-2"}, CPUs: "2", Pinning: "Shared"},
+			},
+			expectErr: true,
+		},
+		"exclusive use of a shared CPU": {
+			claimUID: "new",
+			preparedDevices: devices.PreparedDevices{
+				{Device: drapbv1.Device{DeviceName: "cpu-1"}, CPUs: "1", Pinning: "Exclusive"},
+			},
+			expectErr: true,
+		},
+		"another slot of a shared CPU": {
+			claimUID: "new",
+			preparedDevices: devices.PreparedDevices{
+				{Device: drapbv1.Device{DeviceName: "cpu-1-slot-1"}, CPUs: "1", Pinning: "Shared"},
+			},
+		},
+		"same claim": {
+			claimUID: "exclusive",
+			preparedDevices: devices.PreparedDevices{
+				{Device: drapbv1.Device{DeviceName: "cpu-2"}, CPUs: "2", Pinning: "Exclusive"},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := index.check(test.claimUID, test.preparedDevices)
+			if test.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	index.remove("exclusive")
+	assert.NotContains(t, index, 2)
+	assert.NoError(t, index.check("new", devices.PreparedDevices{
+		{Device: drapbv1.Device{DeviceName: "cpu-2"}, CPUs: "2", Pinning: "Exclusive"},
+	}))
+	assert.Equal(t, []CPUOwner{{ClaimUID: "shared", Device: "cpu-1-slot-0"}}, index[1])
+}
+
+func TestRemoveOrphanedCDISpecs(t *testing.T) {
+	cdiRoot := t.TempDir()
+	cdiHandler, err := cdi.NewHandler(&config.Config{ProgArgs: &config.ProgArgs{CdiRoot: cdiRoot}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cdiHandler.CreateCommonSpecFile(); err != nil {
+		t.Fatal(err)
+	}
+	for _, claimUID := range []string{"prepared", "orphaned"} {
+		preparedDevices := devices.PreparedDevices{
+			{
+				Device: drapbv1.Device{DeviceName: "cpu-0"},
+				ContainerEdits: &cdiapi.ContainerEdits{
+					ContainerEdits: &cdispec.ContainerEdits{Env: []string{"FOO=bar"}},
+				},
+			},
+		}
+		if err := cdiHandler.CreateClaimSpecFile(claimUID, preparedDevices); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	claims := newClaimStore(nil)
+	claims.index["prepared"] = &PreparedClaim{State: ClaimPrepareCompleted}
+
+	s := &DeviceState{
+		cdi:    cdiHandler,
+		claims: claims,
+	}
+	removed, err := s.RemoveOrphanedCDISpecs()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"orphaned"}, removed)
+
+	remaining, err := cdiHandler.ListClaimSpecFiles()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"prepared"}, remaining)
+}
+
+func TestCheckAggregateConflicts(t *testing.T) {
+	s := &DeviceState{
+		Allocatable: discovery.AllocatableDevices{
+			"numa-0": {Type: discovery.DeviceTypeNUMA, CPUs: cpuset.New(0, 1)},
+			"cpu-0":  {Type: discovery.DeviceTypeCPU, CPUs: cpuset.New(0)},
+			"cpu-1":  {Type: discovery.DeviceTypeCPU, CPUs: cpuset.New(1)},
+		},
+	}
+
+	tests := map[string]struct {
+		owners          ownershipIndex
+		preparedDevices devices.PreparedDevices
+		expectErr       bool
+	}{
+		"member CPU of an aggregate of another claim": {
+			owners: ownershipIndex{
+				0: {{ClaimUID: "other", Device: "numa-0"}},
+				1: {{ClaimUID: "other", Device: "numa-0"}},
+			},
+			preparedDevices: devices.PreparedDevices{
+				{Device: drapbv1.Device{DeviceName: "cpu-1"}, CPUs: "1", Pinning: "Shared"},
+			},
+			expectErr: true,
+		},
+		"aggregate over a member CPU of another claim": {
+			owners: ownershipIndex{
+				1: {{ClaimUID: "other", Device: "cpu-1"}},
+			},
+			preparedDevices: devices.PreparedDevices{
+				{Device: drapbv1.Device{DeviceName: "numa-0"}, CPUs: "0-1", Pinning: "Shared"},
+			},
+			expectErr: true,
+		},
+		"member CPU of an aggregate of the same claim": {
+			owners: ownershipIndex{
+				0: {{ClaimUID: "new", Device: "numa-0"}},
+				1: {{ClaimUID: "new", Device: "numa-0"}},
+			},
+			preparedDevices: devices.PreparedDevices{
+				{Device: drapbv1.Device{DeviceName: "cpu-1"}, CPUs: "1", Pinning: "Shared"},
+			},
+		},
+		"CPUs shared without aggregates": {
+			owners: ownershipIndex{
+				1: {{ClaimUID: "other", Device: "cpu-1"}},
+			},
+			preparedDevices: devices.PreparedDevices{
+				{Device: drapbv1.Device{DeviceName: "cpu-1"}, CPUs: "1", Pinning: "Shared"},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			s.owners = test.owners
+			err := s.checkAggregateConflicts("new", test.preparedDevices)
+			if test.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestConcurrentPrepare(t *testing.T) {
+	s := newTestState(t, t.TempDir(), t.TempDir(), &faultInjector{})
+	s.Allocatable = make(discovery.AllocatableDevices)
+	for cpu := 0; cpu < 8; cpu++ {
+		s.Allocatable[fmt.Sprintf("cpu-%d", cpu)] = &discovery.AllocatableDevice{Pool: config.AllocatablePool, CPUs: cpuset.New(cpu)}
+	}
+	newClaim := func(uid, device string) *resourceapi.ResourceClaim {
+		claim := newTestClaim()
+		claim.UID = types.UID(uid)
+		claim.Status.Allocation.Devices.Results[0].Device = device
+		return claim
+	}
+
+	// Claims on different CPUs are all prepared, only one of the claims
+	// competing for CPU 0 is.
+	var claims []*resourceapi.ResourceClaim
+	for cpu := 1; cpu < 8; cpu++ {
+		claims = append(claims, newClaim(fmt.Sprintf("uid-%d", cpu), fmt.Sprintf("cpu-%d", cpu)))
+	}
+	for i := 0; i < 4; i++ {
+		claims = append(claims, newClaim(fmt.Sprintf("competing-%d", i), "cpu-0"))
+	}
+
+	errs := make([]error, len(claims))
+	var wg sync.WaitGroup
+	for i, claim := range claims {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = s.Prepare(claim)
+		}()
+	}
+	wg.Wait()
+
+	competingPrepared := 0
+	for i, claim := range claims {
+		if claim.Status.Allocation.Devices.Results[0].Device != "cpu-0" {
+			assert.NoError(t, errs[i])
+		} else if errs[i] == nil {
+			competingPrepared++
+		}
+	}
+	assert.Equal(t, 1, competingPrepared)
+	assert.Len(t, s.PreparedClaimUIDs(), 8)
+	assert.Len(t, s.Ownership(), 8)
+
+	for _, claimUID := range s.PreparedClaimUIDs() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, s.Unprepare(claimUID))
+		}()
+	}
+	wg.Wait()
+	assert.Empty(t, s.PreparedClaimUIDs())
+	assert.Empty(t, s.Ownership())
+}
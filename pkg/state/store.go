@@ -0,0 +1,211 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"k8s.io/kubernetes/pkg/kubelet/checkpointmanager"
+	"k8s.io/kubernetes/pkg/kubelet/checkpointmanager/checksum"
+
+	"github.com/Tal-or/dra-cpu-driver/pkg/config"
+	"github.com/Tal-or/dra-cpu-driver/pkg/devices"
+)
+
+// Every prepared claim is checkpointed in a file of its own, named after its
+// UID, so that preparing or unpreparing a claim only writes that claim's file
+// whatever the number of claims prepared on the node. The files are read once
+// at startup into an in-memory index which serves every lookup afterwards.
+const (
+	claimCheckpointPrefix = "claim-"
+	claimCheckpointSuffix = ".json"
+)
+
+func claimCheckpointKey(claimUID string) string {
+	return claimCheckpointPrefix + claimUID + claimCheckpointSuffix
+}
+
+// ClaimCheckpoint is the checkpoint of a single prepared claim.
+type ClaimCheckpoint struct {
+	Checksum checksum.Checksum `json:"checksum"`
+	// DriverVersion is the version of the driver that wrote the checkpoint.
+	DriverVersion string         `json:"driverVersion,omitempty"`
+	Claim         *PreparedClaim `json:"claim"`
+}
+
+func (cp *ClaimCheckpoint) MarshalCheckpoint() ([]byte, error) {
+	cp.Checksum = 0
+	out, err := json.Marshal(*cp)
+	if err != nil {
+		return nil, err
+	}
+	cp.Checksum = checksum.New(out)
+	return json.Marshal(*cp)
+}
+
+func (cp *ClaimCheckpoint) UnmarshalCheckpoint(data []byte) error {
+	return json.Unmarshal(data, cp)
+}
+
+func (cp *ClaimCheckpoint) VerifyChecksum() error {
+	ck := cp.Checksum
+	cp.Checksum = 0
+	defer func() {
+		cp.Checksum = ck
+	}()
+	out, err := json.Marshal(*cp)
+	if err != nil {
+		return err
+	}
+	return ck.Verify(out)
+}
+
+// claimStore persists the prepared claims, one checkpoint file per claim.
+// Claims returned by the store must not be modified: a new record is put
+// instead, so that the index never holds changes that failed to be written.
+// The store is safe for concurrent use, but the operations on a single claim
+// must be serialized by the caller.
+type claimStore struct {
+	checkpointManager checkpointmanager.CheckpointManager
+	// mutex protects the index only, checkpoints are written without it.
+	mutex sync.Mutex
+	// index holds every claim checkpointed on disk, by UID.
+	index PreparedClaims
+}
+
+func newClaimStore(checkpointManager checkpointmanager.CheckpointManager) *claimStore {
+	return &claimStore{
+		checkpointManager: checkpointManager,
+		index:             make(PreparedClaims),
+	}
+}
+
+// load builds the index from the claim checkpoints found on disk.
+func (cs *claimStore) load() error {
+	keys, err := cs.checkpointManager.ListCheckpoints()
+	if err != nil {
+		return fmt.Errorf("unable to list checkpoints: %v", err)
+	}
+
+	index := make(PreparedClaims)
+	for _, key := range keys {
+		claimUID, found := strings.CutPrefix(key, claimCheckpointPrefix)
+		if !found {
+			continue
+		}
+		claimUID, found = strings.CutSuffix(claimUID, claimCheckpointSuffix)
+		if !found {
+			continue
+		}
+		checkpoint := &ClaimCheckpoint{}
+		if err := cs.checkpointManager.GetCheckpoint(key, checkpoint); err != nil {
+			return fmt.Errorf("unable to read checkpoint of claim %s: %v", claimUID, err)
+		}
+		if checkpoint.Claim == nil {
+			return fmt.Errorf("checkpoint of claim %s is empty", claimUID)
+		}
+		index[claimUID] = checkpoint.Claim
+	}
+
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	cs.index = index
+	return nil
+}
+
+// get returns the record of a claim, or nil if the claim is not prepared.
+func (cs *claimStore) get(claimUID string) *PreparedClaim {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	return cs.index[claimUID]
+}
+
+// state returns the state of a claim, or an empty state if the claim is not
+// prepared.
+func (cs *claimStore) state(claimUID string) ClaimState {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	if claim, exists := cs.index[claimUID]; exists {
+		return claim.State
+	}
+	return ""
+}
+
+// put writes the checkpoint of a claim, then records it in the index.
+func (cs *claimStore) put(claimUID string, claim *PreparedClaim) error {
+	checkpoint := &ClaimCheckpoint{
+		DriverVersion: config.DriverVersion,
+		Claim:         claim,
+	}
+	if err := cs.checkpointManager.CreateCheckpoint(claimCheckpointKey(claimUID), checkpoint); err != nil {
+		return err
+	}
+
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	cs.index[claimUID] = claim
+	return nil
+}
+
+// remove deletes the checkpoint of a claim, then drops it from the index.
+func (cs *claimStore) remove(claimUID string) error {
+	if err := cs.checkpointManager.RemoveCheckpoint(claimCheckpointKey(claimUID)); err != nil {
+		return err
+	}
+
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	delete(cs.index, claimUID)
+	return nil
+}
+
+// claimUIDs returns the UIDs of the prepared claims, sorted.
+func (cs *claimStore) claimUIDs() []string {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	claimUIDs := make([]string, 0, len(cs.index))
+	for claimUID := range cs.index {
+		claimUIDs = append(claimUIDs, claimUID)
+	}
+	slices.Sort(claimUIDs)
+	return claimUIDs
+}
+
+// all returns the records of every prepared claim.
+func (cs *claimStore) all() PreparedClaims {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	return maps.Clone(cs.index)
+}
+
+// preparedDevices returns the devices of every prepared claim.
+func (cs *claimStore) preparedDevices() devices.PreparedClaims {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	preparedClaims := make(devices.PreparedClaims, len(cs.index))
+	for claimUID, claim := range cs.index {
+		preparedClaims[claimUID] = claim.Devices
+	}
+	return preparedClaims
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	drapbv1 "k8s.io/kubelet/pkg/apis/dra/v1beta1"
+	"k8s.io/kubernetes/pkg/kubelet/checkpointmanager"
+
+	"github.com/Tal-or/dra-cpu-driver/pkg/devices"
+)
+
+// BenchmarkPrepareUnprepare measures a Prepare and Unprepare round trip on a
+// node where many other claims are already prepared.
+func BenchmarkPrepareUnprepare(b *testing.B) {
+	for _, prepared := range []int{0, 1000, 5000} {
+		b.Run(fmt.Sprintf("prepared=%d", prepared), func(b *testing.B) {
+			cdiRoot, checkpointDir := b.TempDir(), b.TempDir()
+			checkpointManager, err := checkpointmanager.NewCheckpointManager(checkpointDir)
+			if err != nil {
+				b.Fatal(err)
+			}
+			claims := newClaimStore(checkpointManager)
+			for i := 0; i < prepared; i++ {
+				cpu := strconv.Itoa(i + 1)
+				err := claims.put(fmt.Sprintf("prepared-%d", i), &PreparedClaim{
+					State:   ClaimPrepareCompleted,
+					CPUs:    cpu,
+					Devices: devices.PreparedDevices{{Device: drapbv1.Device{DeviceName: "cpu-" + cpu}, CPUs: cpu}},
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			s := newTestState(b, cdiRoot, checkpointDir, &faultInjector{})
+			claim := newTestClaim()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := s.Prepare(claim); err != nil {
+					b.Fatal(err)
+				}
+				if err := s.Unprepare(string(claim.UID)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	"k8s.io/utils/cpuset"
+
+	"github.com/Tal-or/dra-cpu-driver/pkg/housekeeping"
+	"github.com/Tal-or/dra-cpu-driver/pkg/resctrl"
+)
+
+// tuneClaim applies the node tuning requested by the configs of a claim and
+// returns the claim with the tuning actions to undo. The actions are
+// recorded in the checkpoint before the node is changed, so that they are
+// undone even if the driver dies half way.
+func (s *DeviceState) tuneClaim(claimUID string, claim *PreparedClaim) (*PreparedClaim, error) {
+	irqIsolated, err := irqIsolatedCPUs(claim.Devices)
+	if err != nil {
+		return nil, err
+	}
+	isolateHousekeeping := isolatesHousekeeping(claim.Devices)
+	partitioned, err := s.partitionCPUs(claim.Devices)
+	if err != nil {
+		return nil, err
+	}
+	if irqIsolated.IsEmpty() && !isolateHousekeeping && !hasPowerProfile(claim.Devices) && !hasRDT(claim.Devices) && partitioned.IsEmpty() {
+		return claim, nil
+	}
+
+	s.tuningMutex.Lock()
+	defer s.tuningMutex.Unlock()
+
+	tuned := *claim
+	tuned.TuningActions = slices.Clone(claim.TuningActions)
+
+	var changes []irqChange
+	if !irqIsolated.IsEmpty() {
+		changes, err = s.planIRQIsolation(irqIsolated)
+		if err != nil {
+			return nil, err
+		}
+		for _, change := range changes {
+			tuned.TuningActions = append(tuned.TuningActions, change.action)
+		}
+	}
+
+	powerChanges, err := s.planPowerProfiles(claim.Devices)
+	if err != nil {
+		return nil, err
+	}
+	for _, change := range powerChanges {
+		tuned.TuningActions = append(tuned.TuningActions, change.action)
+	}
+
+	group, err := s.planResctrlGroup(claimUID, claim.Devices)
+	if err != nil {
+		return nil, err
+	}
+	if group != nil {
+		tuned.TuningActions = append(tuned.TuningActions, TuningAction{Type: tuningResctrlGroup, Path: group.path})
+		if len(group.defaultSchemata) > 0 {
+			tuned.TuningActions = append(tuned.TuningActions, TuningAction{Type: tuningResctrlDefaultCache, Path: s.progArgs.ResctrlRoot, Original: group.defaultCache})
+		}
+	}
+
+	var partition string
+	if !partitioned.IsEmpty() {
+		partition = s.partitions.path(claimUID)
+		tuned.TuningActions = append(tuned.TuningActions, TuningAction{Type: tuningCPUPartition, Path: partition})
+	}
+
+	var housekeepingCPUs cpuset.CPUSet
+	var settings []housekeeping.Setting
+	if isolateHousekeeping {
+		housekeepingCPUs, err = s.housekeepingCPUs()
+		if err != nil {
+			return nil, err
+		}
+		settings, err = s.housekeeping.Settings(housekeepingCPUs)
+		if err != nil {
+			return nil, err
+		}
+		for _, setting := range settings {
+			tuned.TuningActions = append(tuned.TuningActions, TuningAction{Type: setting.Type, Path: setting.Path, Original: setting.Original})
+		}
+	}
+
+	if err := s.claims.put(claimUID, &tuned); err != nil {
+		return nil, fmt.Errorf("unable to sync to checkpoint: %v", err)
+	}
+
+	if len(changes) > 0 {
+		if err := s.applyTuning(func() error { return applyIRQChanges(changes) }); err != nil {
+			return nil, err
+		}
+	}
+	if len(powerChanges) > 0 {
+		if err := s.applyTuning(func() error { return applyFileChanges(powerChanges) }); err != nil {
+			return nil, err
+		}
+	}
+	if group != nil {
+		if err := s.applyTuning(func() error { return resctrl.CreateGroup(group.path, group.cpus, group.schemata) }); err != nil {
+			return nil, err
+		}
+		if err := s.applyTuning(func() error { return resctrl.SetSchemata(s.progArgs.ResctrlRoot, group.defaultSchemata) }); err != nil {
+			return nil, err
+		}
+	}
+	if partition != "" {
+		if err := s.applyTuning(func() error { return s.partitions.create(partition, partitioned) }); err != nil {
+			return nil, err
+		}
+	}
+	if isolateHousekeeping {
+		if err := s.applyTuning(func() error { return s.housekeeping.Acquire(claimUID, settings, housekeepingCPUs) }); err != nil {
+			return nil, err
+		}
+	}
+	return &tuned, nil
+}
+
+// applyTuning makes one kind of change to the node for a claim.
+func (s *DeviceState) applyTuning(apply func() error) error {
+	if s.tuningStep != nil {
+		if err := s.tuningStep(); err != nil {
+			return err
+		}
+	}
+	return apply()
+}
+
+// unprepareDevices undoes the tuning applied to the node for a claim, most
+// recent first.
+func (s *DeviceState) unprepareDevices(claimUID string, claim *PreparedClaim) error {
+	if claim == nil || len(claim.TuningActions) == 0 {
+		return nil
+	}
+
+	isolated, err := irqIsolatedCPUs(claim.Devices)
+	if err != nil {
+		return err
+	}
+
+	s.tuningMutex.Lock()
+	defer s.tuningMutex.Unlock()
+
+	// The housekeeping settings are shared by all the claims isolating
+	// CPUs, they are only restored with the last of them.
+	if len(housekeepingSettings(claim.TuningActions)) > 0 {
+		if err := s.housekeeping.Release(claimUID); err != nil {
+			return fmt.Errorf("unable to restore housekeeping settings of claim %s: %v", claimUID, err)
+		}
+	}
+
+	for _, action := range slices.Backward(claim.TuningActions) {
+		var err error
+		switch action.Type {
+		case tuningIRQAffinity, tuningDefaultIRQAffinity:
+			err = undoIRQAffinity(action, isolated)
+		case tuningResctrlGroup:
+			err = resctrl.RemoveGroup(action.Path)
+		case tuningResctrlDefaultCache:
+			err = restoreDefaultCache(action.Path, claimUID, action.Original)
+		case tuningCPUPartition:
+			err = s.partitions.remove(action.Path)
+		case housekeeping.WorkqueueCPUMask, housekeeping.KThreadAffinity:
+			// Restored above.
+			continue
+		default:
+			err = os.WriteFile(action.Path, []byte(action.Original), 0644)
+		}
+		if err != nil {
+			return fmt.Errorf("unable to undo %s tuning of %s of claim %s: %v", action.Type, action.Path, claimUID, err)
+		}
+	}
+	return nil
+}
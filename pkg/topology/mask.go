@@ -0,0 +1,60 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package topology
+
+import (
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+
+	"k8s.io/utils/cpuset"
+)
+
+// ParseCPUMask parses a CPU mask made of comma separated groups of 32 bits, as
+// found in procfs, e.g. "ff,00000000" for CPUs 32-39.
+func ParseCPUMask(mask string) (cpuset.CPUSet, error) {
+	bits, ok := new(big.Int).SetString(strings.ReplaceAll(mask, ",", ""), 16)
+	if !ok {
+		return cpuset.New(), fmt.Errorf("invalid CPU mask %q", mask)
+	}
+	var cpus []int
+	for cpu := 0; cpu < bits.BitLen(); cpu++ {
+		if bits.Bit(cpu) == 1 {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpuset.New(cpus...), nil
+}
+
+// FormatCPUMask formats a set of CPUs the way the kernel formats CPU masks in
+// procfs, e.g. "000000ff,00000000" for CPUs 32-39.
+func FormatCPUMask(cpus cpuset.CPUSet) string {
+	groups := 1
+	if list := cpus.List(); len(list) > 0 {
+		groups = list[len(list)-1]/32 + 1
+	}
+	words := make([]uint32, groups)
+	for _, cpu := range cpus.List() {
+		words[cpu/32] |= 1 << (cpu % 32)
+	}
+	formatted := make([]string, 0, groups)
+	for _, word := range slices.Backward(words) {
+		formatted = append(formatted, fmt.Sprintf("%08x", word))
+	}
+	return strings.Join(formatted, ",")
+}
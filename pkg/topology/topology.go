@@ -0,0 +1,350 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package topology
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"k8s.io/utils/cpuset"
+)
+
+const (
+	cpuDir  = "devices/system/cpu"
+	nodeDir = "devices/system/node"
+)
+
+// CPUInfo describes a single logical CPU as reported by sysfs.
+type CPUInfo struct {
+	ID       int
+	NUMANode int
+	Socket   int
+	Die      int
+	Core     int
+	Siblings cpuset.CPUSet
+	// LLC is the ID of the last level cache domain the CPU belongs to,
+	// or -1 when sysfs does not report one.
+	LLC int
+	// Freq describes the frequency scaling of the CPU, it is nil when the
+	// CPU has no cpufreq driver.
+	Freq *CPUFreq
+}
+
+// CPUFreq describes the frequency scaling capabilities of a CPU.
+type CPUFreq struct {
+	// MinKHz and MaxKHz are the hardware frequency limits in kHz.
+	MinKHz int64
+	MaxKHz int64
+	// Governors are the available scaling governors.
+	Governors []string
+	// PolicyCPUs are the CPUs sharing the cpufreq policy of the CPU, whose
+	// settings always change together.
+	PolicyCPUs cpuset.CPUSet
+}
+
+// Cache describes a last level cache domain, e.g. an L3 cache shared by a
+// CCX or a whole socket.
+type Cache struct {
+	ID    int
+	Level int
+	// Size is the size of the cache in bytes.
+	Size int64
+	CPUs cpuset.CPUSet
+}
+
+// Topology holds the CPU layout of the machine.
+type Topology struct {
+	CPUs      map[int]*CPUInfo
+	Online    cpuset.CPUSet
+	NUMANodes map[int]cpuset.CPUSet
+	Caches    map[int]*Cache
+}
+
+// Discover walks the CPU and NUMA node hierarchies found under sysfsRoot
+// (normally /sys) and builds the topology of all online CPUs.
+func Discover(sysfsRoot string) (*Topology, error) {
+	online, err := readCPUList(filepath.Join(sysfsRoot, cpuDir, "online"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read online CPUs: %w", err)
+	}
+
+	cpuToNode, err := discoverNUMANodes(sysfsRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	topo := &Topology{
+		CPUs:      make(map[int]*CPUInfo),
+		Online:    online,
+		NUMANodes: make(map[int]cpuset.CPUSet),
+		Caches:    make(map[int]*Cache),
+	}
+	for _, id := range online.List() {
+		info, err := discoverCPU(sysfsRoot, id)
+		if err != nil {
+			return nil, err
+		}
+		// Core devices must never list offline siblings.
+		info.Siblings = info.Siblings.Intersection(online)
+		info.NUMANode = cpuToNode[id]
+		info.Freq, err = discoverCPUFreq(sysfsRoot, id)
+		if err != nil {
+			return nil, err
+		}
+		topo.CPUs[id] = info
+		topo.NUMANodes[info.NUMANode] = topo.NUMANodes[info.NUMANode].Union(cpuset.New(id))
+
+		cache, err := discoverLLC(sysfsRoot, id)
+		if err != nil {
+			return nil, err
+		}
+		if cache == nil {
+			info.LLC = -1
+			continue
+		}
+		info.LLC = cache.ID
+		if _, exists := topo.Caches[cache.ID]; !exists {
+			// Only keep the online part of the domain.
+			cache.CPUs = cache.CPUs.Intersection(online)
+			topo.Caches[cache.ID] = cache
+		}
+	}
+
+	return topo, nil
+}
+
+// CPU returns the topology information of the given CPU, or an error
+// if the CPU is not online.
+func (t *Topology) CPU(id int) (*CPUInfo, error) {
+	info, ok := t.CPUs[id]
+	if !ok {
+		return nil, fmt.Errorf("CPU %d is not online", id)
+	}
+	return info, nil
+}
+
+func discoverCPU(sysfsRoot string, id int) (*CPUInfo, error) {
+	topoDir := filepath.Join(sysfsRoot, cpuDir, fmt.Sprintf("cpu%d", id), "topology")
+
+	socket, err := readInt(filepath.Join(topoDir, "physical_package_id"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read socket of CPU %d: %w", id, err)
+	}
+	core, err := readInt(filepath.Join(topoDir, "core_id"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read core of CPU %d: %w", id, err)
+	}
+	// die_id is only exposed by kernels 5.2 and newer; treat every package
+	// as a single die when it is missing.
+	die, err := readInt(filepath.Join(topoDir, "die_id"))
+	if errors.Is(err, os.ErrNotExist) {
+		die = 0
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to read die of CPU %d: %w", id, err)
+	}
+	siblings, err := readCPUList(filepath.Join(topoDir, "thread_siblings_list"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read thread siblings of CPU %d: %w", id, err)
+	}
+
+	return &CPUInfo{
+		ID:       id,
+		Socket:   socket,
+		Die:      die,
+		Core:     core,
+		Siblings: siblings,
+	}, nil
+}
+
+// discoverLLC returns the highest level cache of a CPU, or nil if the CPU
+// has no cache hierarchy in sysfs.
+func discoverLLC(sysfsRoot string, id int) (*Cache, error) {
+	cacheDir := filepath.Join(sysfsRoot, cpuDir, fmt.Sprintf("cpu%d", id), "cache")
+	entries, err := os.ReadDir(cacheDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to list caches of CPU %d: %w", id, err)
+	}
+
+	var llc *Cache
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), "index") {
+			continue
+		}
+		indexDir := filepath.Join(cacheDir, entry.Name())
+		level, err := readInt(filepath.Join(indexDir, "level"))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read cache level of CPU %d: %w", id, err)
+		}
+		if llc != nil && level <= llc.Level {
+			continue
+		}
+		cpus, err := readCPUList(filepath.Join(indexDir, "shared_cpu_list"))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read cache CPUs of CPU %d: %w", id, err)
+		}
+		// Some hypervisors expose caches shared by no CPU, which cannot
+		// be a domain.
+		if cpus.IsEmpty() {
+			continue
+		}
+		// Older kernels do not expose the cache id; the first CPU sharing the
+		// cache identifies the domain just as well.
+		cacheID, err := readInt(filepath.Join(indexDir, "id"))
+		if errors.Is(err, os.ErrNotExist) {
+			cacheID = cpus.List()[0]
+		} else if err != nil {
+			return nil, fmt.Errorf("unable to read cache id of CPU %d: %w", id, err)
+		}
+		size, err := readSize(filepath.Join(indexDir, "size"))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read cache size of CPU %d: %w", id, err)
+		}
+		llc = &Cache{
+			ID:    cacheID,
+			Level: level,
+			Size:  size,
+			CPUs:  cpus,
+		}
+	}
+
+	return llc, nil
+}
+
+// discoverCPUFreq returns the frequency scaling capabilities of a CPU, or
+// nil if the CPU has no cpufreq driver.
+func discoverCPUFreq(sysfsRoot string, id int) (*CPUFreq, error) {
+	freqDir := CPUFreqDir(sysfsRoot, id)
+	if _, err := os.Stat(freqDir); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	minKHz, err := readInt(filepath.Join(freqDir, "cpuinfo_min_freq"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read minimum frequency of CPU %d: %w", id, err)
+	}
+	maxKHz, err := readInt(filepath.Join(freqDir, "cpuinfo_max_freq"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read maximum frequency of CPU %d: %w", id, err)
+	}
+	governors, err := os.ReadFile(filepath.Join(freqDir, "scaling_available_governors"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read governors of CPU %d: %w", id, err)
+	}
+	policyCPUs, err := readCPUList(filepath.Join(freqDir, "related_cpus"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read cpufreq policy CPUs of CPU %d: %w", id, err)
+	}
+
+	return &CPUFreq{
+		MinKHz:     int64(minKHz),
+		MaxKHz:     int64(maxKHz),
+		Governors:  strings.Fields(string(governors)),
+		PolicyCPUs: policyCPUs,
+	}, nil
+}
+
+// CPUFreqDir returns the cpufreq directory of a CPU under sysfsRoot.
+func CPUFreqDir(sysfsRoot string, id int) string {
+	return filepath.Join(sysfsRoot, cpuDir, fmt.Sprintf("cpu%d", id), "cpufreq")
+}
+
+// CPUPowerDir returns the power management directory of a CPU under
+// sysfsRoot.
+func CPUPowerDir(sysfsRoot string, id int) string {
+	return filepath.Join(sysfsRoot, cpuDir, fmt.Sprintf("cpu%d", id), "power")
+}
+
+// discoverNUMANodes maps every CPU to the NUMA node it belongs to. On
+// machines without NUMA support the node hierarchy is absent and every CPU
+// is reported on node 0.
+func discoverNUMANodes(sysfsRoot string) (map[int]int, error) {
+	cpuToNode := make(map[int]int)
+
+	entries, err := os.ReadDir(filepath.Join(sysfsRoot, nodeDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return cpuToNode, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to list NUMA nodes: %w", err)
+	}
+
+	for _, entry := range entries {
+		name, found := strings.CutPrefix(entry.Name(), "node")
+		if !found {
+			continue
+		}
+		node, err := strconv.Atoi(name)
+		if err != nil {
+			continue
+		}
+		cpus, err := readCPUList(filepath.Join(sysfsRoot, nodeDir, entry.Name(), "cpulist"))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CPUs of NUMA node %d: %w", node, err)
+		}
+		for _, cpu := range cpus.List() {
+			cpuToNode[cpu] = node
+		}
+	}
+
+	return cpuToNode, nil
+}
+
+func readInt(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+// readSize parses cache sizes such as "32768K" into bytes.
+func readSize(path string) (int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	value := strings.TrimSpace(string(data))
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(value, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(value, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(value, "G"):
+		multiplier = 1 << 30
+	}
+	size, err := strconv.ParseInt(strings.TrimRight(value, "KMG"), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return size * multiplier, nil
+}
+
+func readCPUList(path string) (cpuset.CPUSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cpuset.New(), err
+	}
+	return cpuset.Parse(strings.TrimSpace(string(data)))
+}
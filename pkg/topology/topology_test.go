@@ -0,0 +1,278 @@
+/*
+ * Copyright 2025 The Kubernetes Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package topology
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/utils/cpuset"
+)
+
+// writeFile creates a sysfs-like file under root, creating parent
+// directories as needed.
+func writeFile(t *testing.T, root, path, content string) {
+	t.Helper()
+	full := filepath.Join(root, path)
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(full, []byte(content+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fakeCPU is the fixture description of a single logical CPU.
+type fakeCPU struct {
+	socket, die, core int
+	siblings          string
+	// llc is the shared_cpu_list of the L3 cache, whose id is the socket.
+	llc string
+}
+
+func newFakeSysfs(t *testing.T, online string, cpus map[int]fakeCPU, nodes map[int]string, withDie bool) string {
+	t.Helper()
+	root := t.TempDir()
+	writeFile(t, root, "devices/system/cpu/online", online)
+	for id, cpu := range cpus {
+		dir := fmt.Sprintf("devices/system/cpu/cpu%d/topology", id)
+		writeFile(t, root, dir+"/physical_package_id", fmt.Sprint(cpu.socket))
+		writeFile(t, root, dir+"/core_id", fmt.Sprint(cpu.core))
+		writeFile(t, root, dir+"/thread_siblings_list", cpu.siblings)
+		if withDie {
+			writeFile(t, root, dir+"/die_id", fmt.Sprint(cpu.die))
+		}
+		if cpu.llc != "" {
+			cacheDir := fmt.Sprintf("devices/system/cpu/cpu%d/cache", id)
+			writeFile(t, root, cacheDir+"/index0/level", "1")
+			writeFile(t, root, cacheDir+"/index0/id", fmt.Sprint(cpu.core))
+			writeFile(t, root, cacheDir+"/index0/size", "48K")
+			writeFile(t, root, cacheDir+"/index0/shared_cpu_list", cpu.siblings)
+			writeFile(t, root, cacheDir+"/index3/level", "3")
+			writeFile(t, root, cacheDir+"/index3/id", fmt.Sprint(cpu.socket))
+			writeFile(t, root, cacheDir+"/index3/size", "32768K")
+			writeFile(t, root, cacheDir+"/index3/shared_cpu_list", cpu.llc)
+		}
+	}
+	for node, cpulist := range nodes {
+		writeFile(t, root, fmt.Sprintf("devices/system/node/node%d/cpulist", node), cpulist)
+	}
+	return root
+}
+
+func TestDiscover(t *testing.T) {
+	// Two sockets, two cores per socket, two threads per core, with
+	// siblings numbered the way Linux usually enumerates them.
+	twoSocketCPUs := map[int]fakeCPU{
+		0: {socket: 0, die: 0, core: 0, siblings: "0,4", llc: "0-1,4-5"},
+		1: {socket: 0, die: 0, core: 1, siblings: "1,5", llc: "0-1,4-5"},
+		2: {socket: 1, die: 0, core: 0, siblings: "2,6", llc: "2-3,6-7"},
+		3: {socket: 1, die: 0, core: 1, siblings: "3,7", llc: "2-3,6-7"},
+		4: {socket: 0, die: 0, core: 0, siblings: "0,4", llc: "0-1,4-5"},
+		5: {socket: 0, die: 0, core: 1, siblings: "1,5", llc: "0-1,4-5"},
+		6: {socket: 1, die: 0, core: 0, siblings: "2,6", llc: "2-3,6-7"},
+		7: {socket: 1, die: 0, core: 1, siblings: "3,7", llc: "2-3,6-7"},
+	}
+
+	tests := map[string]struct {
+		online   string
+		cpus     map[int]fakeCPU
+		nodes    map[int]string
+		withDie  bool
+		expected map[int]*CPUInfo
+	}{
+		"two NUMA nodes with SMT": {
+			online:  "0-7",
+			cpus:    twoSocketCPUs,
+			nodes:   map[int]string{0: "0-1,4-5", 1: "2-3,6-7"},
+			withDie: true,
+			expected: map[int]*CPUInfo{
+				0: {ID: 0, NUMANode: 0, Socket: 0, Core: 0, Siblings: cpuset.New(0, 4), LLC: 0},
+				1: {ID: 1, NUMANode: 0, Socket: 0, Core: 1, Siblings: cpuset.New(1, 5), LLC: 0},
+				2: {ID: 2, NUMANode: 1, Socket: 1, Core: 0, Siblings: cpuset.New(2, 6), LLC: 1},
+				3: {ID: 3, NUMANode: 1, Socket: 1, Core: 1, Siblings: cpuset.New(3, 7), LLC: 1},
+				4: {ID: 4, NUMANode: 0, Socket: 0, Core: 0, Siblings: cpuset.New(0, 4), LLC: 0},
+				5: {ID: 5, NUMANode: 0, Socket: 0, Core: 1, Siblings: cpuset.New(1, 5), LLC: 0},
+				6: {ID: 6, NUMANode: 1, Socket: 1, Core: 0, Siblings: cpuset.New(2, 6), LLC: 1},
+				7: {ID: 7, NUMANode: 1, Socket: 1, Core: 1, Siblings: cpuset.New(3, 7), LLC: 1},
+			},
+		},
+		"offline CPUs are skipped": {
+			online: "0-1",
+			cpus: map[int]fakeCPU{
+				0: {socket: 0, core: 0, siblings: "0"},
+				1: {socket: 0, core: 1, siblings: "1"},
+			},
+			nodes: map[int]string{0: "0-3"},
+			expected: map[int]*CPUInfo{
+				0: {ID: 0, Siblings: cpuset.New(0), LLC: -1},
+				1: {ID: 1, Core: 1, Siblings: cpuset.New(1), LLC: -1},
+			},
+		},
+		"offline siblings are dropped": {
+			online: "0-1",
+			cpus: map[int]fakeCPU{
+				0: {socket: 0, core: 0, siblings: "0,2"},
+				1: {socket: 0, core: 1, siblings: "1,3"},
+			},
+			expected: map[int]*CPUInfo{
+				0: {ID: 0, Siblings: cpuset.New(0), LLC: -1},
+				1: {ID: 1, Core: 1, Siblings: cpuset.New(1), LLC: -1},
+			},
+		},
+		"no NUMA hierarchy and no die_id": {
+			online: "0-1",
+			cpus: map[int]fakeCPU{
+				0: {socket: 0, die: 3, core: 0, siblings: "0-1"},
+				1: {socket: 0, die: 3, core: 0, siblings: "0-1"},
+			},
+			expected: map[int]*CPUInfo{
+				0: {ID: 0, Siblings: cpuset.New(0, 1), LLC: -1},
+				1: {ID: 1, Siblings: cpuset.New(0, 1), LLC: -1},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			root := newFakeSysfs(t, test.online, test.cpus, test.nodes, test.withDie)
+			topo, err := Discover(root)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			assert.Equal(t, test.expected, topo.CPUs)
+		})
+	}
+}
+
+func TestDiscoverNUMANodesAndCaches(t *testing.T) {
+	root := newFakeSysfs(t, "0-3", map[int]fakeCPU{
+		0: {socket: 0, core: 0, siblings: "0", llc: "0-1"},
+		1: {socket: 0, core: 1, siblings: "1", llc: "0-1"},
+		2: {socket: 1, core: 0, siblings: "2", llc: "2-3"},
+		3: {socket: 1, core: 1, siblings: "3", llc: "2-3"},
+	}, map[int]string{0: "0-1", 1: "2-3"}, false)
+
+	topo, err := Discover(root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, map[int]cpuset.CPUSet{
+		0: cpuset.New(0, 1),
+		1: cpuset.New(2, 3),
+	}, topo.NUMANodes)
+	assert.Equal(t, map[int]*Cache{
+		0: {ID: 0, Level: 3, Size: 32 << 20, CPUs: cpuset.New(0, 1)},
+		1: {ID: 1, Level: 3, Size: 32 << 20, CPUs: cpuset.New(2, 3)},
+	}, topo.Caches)
+}
+
+func TestDiscoverEmptyCache(t *testing.T) {
+	root := newFakeSysfs(t, "0", map[int]fakeCPU{
+		0: {socket: 0, core: 0, siblings: "0"},
+	}, nil, false)
+	// An L3 cache without id shared by no CPU is skipped for the L2 cache.
+	writeFile(t, root, "devices/system/cpu/cpu0/cache/index2/level", "2")
+	writeFile(t, root, "devices/system/cpu/cpu0/cache/index2/id", "0")
+	writeFile(t, root, "devices/system/cpu/cpu0/cache/index2/size", "1024K")
+	writeFile(t, root, "devices/system/cpu/cpu0/cache/index2/shared_cpu_list", "0")
+	writeFile(t, root, "devices/system/cpu/cpu0/cache/index3/level", "3")
+	writeFile(t, root, "devices/system/cpu/cpu0/cache/index3/size", "32768K")
+	writeFile(t, root, "devices/system/cpu/cpu0/cache/index3/shared_cpu_list", "")
+
+	topo, err := Discover(root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, map[int]*Cache{
+		0: {ID: 0, Level: 2, Size: 1 << 20, CPUs: cpuset.New(0)},
+	}, topo.Caches)
+}
+
+func TestDiscoverMissingTopology(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "devices/system/cpu/online", "0")
+	_, err := Discover(root)
+	assert.Error(t, err)
+}
+
+func TestDiscoverCPUFreq(t *testing.T) {
+	root := newFakeSysfs(t, "0-2", map[int]fakeCPU{
+		0: {socket: 0, core: 0, siblings: "0"},
+		1: {socket: 0, core: 1, siblings: "1"},
+		2: {socket: 0, core: 2, siblings: "2"},
+	}, nil, false)
+	for _, id := range []int{0, 1} {
+		dir := fmt.Sprintf("devices/system/cpu/cpu%d/cpufreq", id)
+		writeFile(t, root, dir+"/cpuinfo_min_freq", "800000")
+		writeFile(t, root, dir+"/cpuinfo_max_freq", "3500000")
+		writeFile(t, root, dir+"/scaling_available_governors", "performance powersave")
+		writeFile(t, root, dir+"/related_cpus", "0-1")
+	}
+
+	topo, err := Discover(root)
+	assert.NoError(t, err)
+	expected := &CPUFreq{MinKHz: 800000, MaxKHz: 3500000, Governors: []string{"performance", "powersave"}, PolicyCPUs: cpuset.New(0, 1)}
+	assert.Equal(t, expected, topo.CPUs[0].Freq)
+	assert.Equal(t, expected, topo.CPUs[1].Freq)
+	assert.Nil(t, topo.CPUs[2].Freq)
+}
+
+func TestCPUMask(t *testing.T) {
+	tests := map[string]struct {
+		mask     string
+		cpus     cpuset.CPUSet
+		expected string
+	}{
+		"empty": {
+			mask:     "0",
+			cpus:     cpuset.New(),
+			expected: "00000000",
+		},
+		"single group": {
+			mask:     "f",
+			cpus:     cpuset.New(0, 1, 2, 3),
+			expected: "0000000f",
+		},
+		"several groups": {
+			mask:     "ff,00000001",
+			cpus:     cpuset.New(0, 32, 33, 34, 35, 36, 37, 38, 39),
+			expected: "000000ff,00000001",
+		},
+		"leading zero groups": {
+			mask:     "00000000,00000000,00000006",
+			cpus:     cpuset.New(1, 2),
+			expected: "00000006",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cpus, err := ParseCPUMask(test.mask)
+			assert.NoError(t, err)
+			assert.Equal(t, test.cpus, cpus)
+			assert.Equal(t, test.expected, FormatCPUMask(cpus))
+		})
+	}
+
+	_, err := ParseCPUMask("0-3")
+	assert.Error(t, err)
+}